@@ -414,3 +414,31 @@ func (cm *Manager) ConfigureBackend(
 
 	return cm.CaddyConfigurator.updateRoutes(ctx, routes)
 }
+
+// DeleteBackend removes the routes in Caddy for a specific process/service.
+// It is not an error to delete a backend that does not exist.
+func (cm *Manager) DeleteBackend(ctx context.Context, backendName string) error {
+	cm.Log.Info("deleting caddy backend",
+		zap.String("backend", backendName),
+	)
+	routes, err := cm.CaddyConfigurator.getRoutes(ctx)
+	if err != nil {
+		return err
+	}
+
+	remainingRoutes := make([]route, 0, len(routes))
+	for _, route := range routes {
+		if route.Group != backendName {
+			remainingRoutes = append(remainingRoutes, route)
+		}
+	}
+
+	if len(remainingRoutes) == len(routes) {
+		cm.Log.Debug("no routes found for backend",
+			zap.String("backend", backendName),
+		)
+		return nil
+	}
+
+	return cm.CaddyConfigurator.updateRoutes(ctx, remainingRoutes)
+}
@@ -381,3 +381,69 @@ func TestManager_ConfigureBackend(t *testing.T) {
 		})
 	}
 }
+
+func TestManager_DeleteBackend(t *testing.T) {
+	defaultRoute := route{
+		Handlers: handlers{
+			staticResponseHandler{
+				Body:       "default route",
+				StatusCode: "404",
+			},
+		},
+	}
+	fizzRoute := route{
+		Group: "fizz",
+		MatcherSets: []matcherSet{
+			{
+				Host: []string{"fizz.example.com"},
+			},
+		},
+		Terminal: true,
+	}
+	buzzRoute := route{
+		Group: "buzz",
+		MatcherSets: []matcherSet{
+			{
+				Host: []string{"buzz.example.com"},
+			},
+		},
+		Terminal: true,
+	}
+
+	tests := []struct {
+		name        string
+		routes      []route
+		backendName string
+		wantRoutes  []route
+	}{
+		{
+			name:        "existing backend",
+			routes:      []route{fizzRoute, buzzRoute, defaultRoute},
+			backendName: "fizz",
+			wantRoutes:  []route{buzzRoute, defaultRoute},
+		},
+		{
+			name:        "missing backend",
+			routes:      []route{buzzRoute, defaultRoute},
+			backendName: "fizz",
+			wantRoutes:  []route{buzzRoute, defaultRoute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAdmin := &mockCaddyConfigurator{
+				t:      t,
+				routes: append([]route{}, tt.routes...),
+			}
+			cm := Manager{
+				CaddyConfigurator: mockAdmin,
+				Log:               zaptest.NewLogger(t),
+			}
+
+			err := cm.DeleteBackend(context.Background(), tt.backendName)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRoutes, mockAdmin.routes)
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 type CleanupArgs struct {
 	ServiceName string
+	Lock        LockOptions
 }
 
 func (e *Engine) Cleanup(ctx context.Context, args CleanupArgs) error {
@@ -20,6 +21,12 @@ func (e *Engine) Cleanup(ctx context.Context, args CleanupArgs) error {
 		return err
 	}
 
+	lock, err := e.lockService(ctx, svc.Name, args.Lock)
+	if err != nil {
+		return err
+	}
+	defer e.unlockService(svc.Name, lock)
+
 	svcState, err := e.state.LoadServiceState(svc.Name)
 	if err != nil {
 		return err
@@ -58,7 +65,7 @@ func (e *Engine) Cleanup(ctx context.Context, args CleanupArgs) error {
 			continue
 		}
 
-		if deploy != strconv.Itoa(svcState.DeploymentID) {
+		if deploy != strconv.Itoa(svcState.ActiveDeploymentID) {
 			e.log.Debug(
 				"zombie container found; removing",
 				zap.String("service", svc.Name),
@@ -82,5 +89,5 @@ func (e *Engine) Cleanup(ctx context.Context, args CleanupArgs) error {
 		zap.Int("count", deleteCount),
 	)
 
-	return nil
+	return e.releaseStalePorts(ctx, svc.Name)
 }
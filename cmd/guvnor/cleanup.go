@@ -11,6 +11,7 @@ func newCleanupCommand(eP engineProvider) *cobra.Command {
 		Short: "Force kill zombie containers belonging to the service.",
 		Args:  cobra.RangeArgs(0, 1),
 	}
+	lockOptions := addLockFlags(cmd)
 
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
 		engine, _, err := eP()
@@ -47,7 +48,10 @@ func newCleanupCommand(eP engineProvider) *cobra.Command {
 
 		err = engine.Cleanup(
 			cmd.Context(),
-			guvnor.CleanupArgs{ServiceName: serviceName},
+			guvnor.CleanupArgs{
+				ServiceName: serviceName,
+				Lock:        lockOptions(),
+			},
 		)
 		if err != nil {
 			return err
@@ -27,6 +27,14 @@ func Test_newCleanupCmd(t *testing.T) {
 				ServiceName: "fizzler",
 			},
 		},
+		{
+			name: "wait for lock",
+			args: []string{"fizzler", "--wait"},
+			wantArgs: &guvnor.CleanupArgs{
+				ServiceName: "fizzler",
+				Lock:        guvnor.LockOptions{Wait: true},
+			},
+		},
 		{
 			name: "default service",
 			args: []string{},
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/krystal/guvnor"
+	"github.com/spf13/cobra"
+)
+
+func newConfigCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Commands for inspecting service configuration",
+	}
+
+	cmd.AddCommand(newConfigRenderCmd(eP))
+
+	return cmd
+}
+
+func newConfigRenderCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "render [service]",
+		Short: "Outputs the config of a service with shared defaults and includes merged into it",
+		Long: "Outputs the config of a service with the defaults from the " +
+			"Guvnor configuration and any included fragments merged into it. " +
+			"Templates are output as written.",
+		Args:         cobra.RangeArgs(0, 1),
+		SilenceUsage: true,
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		engine, _, err := eP()
+		if err != nil {
+			return err
+		}
+
+		serviceName := ""
+		if len(args) == 0 {
+			res, err := engine.GetDefaultService()
+			if err != nil {
+				return err
+			}
+			serviceName = res.Name
+		} else {
+			serviceName = args[0]
+		}
+
+		res, err := engine.RenderServiceConfig(
+			cmd.Context(),
+			guvnor.RenderServiceConfigArgs{ServiceName: serviceName},
+		)
+		if err != nil {
+			return err
+		}
+
+		// The config is output without colour so it can be piped elsewhere.
+		_, err = fmt.Fprint(cmd.OutOrStdout(), res.Config)
+		return err
+	}
+
+	return cmd
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/krystal/guvnor"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newConfigRenderCmd(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantArgs  guvnor.RenderServiceConfigArgs
+		engineRes *guvnor.RenderServiceConfigResult
+		engineErr error
+		wantErr   string
+	}{
+		{
+			name:     "service",
+			args:     []string{"render", "fizz"},
+			wantArgs: guvnor.RenderServiceConfigArgs{ServiceName: "fizz"},
+			engineRes: &guvnor.RenderServiceConfigResult{
+				Config: "defaults:\n  image: ghcr.io/krystal/fizz\n  imageTag: latest\n",
+			},
+		},
+		{
+			name:     "default service",
+			args:     []string{"render"},
+			wantArgs: guvnor.RenderServiceConfigArgs{ServiceName: "default"},
+			engineRes: &guvnor.RenderServiceConfigResult{
+				Config: "defaults:\n  image: ghcr.io/krystal/default\n",
+			},
+		},
+		{
+			name:      "error",
+			args:      []string{"render", "fizz"},
+			wantArgs:  guvnor.RenderServiceConfigArgs{ServiceName: "fizz"},
+			engineErr: errors.New("include shared/a.yaml: open shared/a.yaml: no such file or directory"),
+			wantErr:   "include shared/a.yaml: open shared/a.yaml: no such file or directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mEngine := NewMockengine(ctrl)
+
+			ctx := context.Background()
+			provider := func() (engine, *guvnor.EngineConfig, error) {
+				return mEngine, nil, nil
+			}
+
+			if len(tt.args) == 1 {
+				mEngine.EXPECT().
+					GetDefaultService().
+					Return(&guvnor.GetDefaultServiceResult{Name: "default"}, nil)
+			}
+			mEngine.EXPECT().
+				RenderServiceConfig(ctx, tt.wantArgs).
+				Return(tt.engineRes, tt.engineErr)
+
+			cmd := newConfigCmd(provider)
+			stdout := bytes.NewBufferString("")
+			stderr := bytes.NewBufferString("")
+			cmd.SetOut(stdout)
+			cmd.SetErr(stderr)
+			cmd.SetArgs(tt.args)
+
+			err := cmd.ExecuteContext(ctx)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assertGoldenOutput(t, stdout, stderr)
+		})
+	}
+}
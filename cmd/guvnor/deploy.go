@@ -18,6 +18,12 @@ func newDeployCmd(eP engineProvider) *cobra.Command {
 		"",
 		"Configures a specific image tag to deploy",
 	)
+	dryRunFlag := cmd.Flags().Bool(
+		"dry-run",
+		false,
+		"Shows the changes the deployment would make without deploying",
+	)
+	lockOptions := addLockFlags(cmd)
 
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
 		engine, _, err := eP()
@@ -43,11 +49,33 @@ func newDeployCmd(eP engineProvider) *cobra.Command {
 			serviceName = args[0]
 		}
 
-		_, err = infoColour.Fprintf(
-			cmd.OutOrStdout(),
-			"🔨 Deploying '%s'. Hold on tight!\n",
-			serviceName,
-		)
+		if *dryRunFlag {
+			res, err := engine.Plan(cmd.Context(), guvnor.PlanArgs{
+				ServiceName: serviceName,
+				Tag:         *tagFlag,
+			})
+			if err != nil {
+				return err
+			}
+
+			printPlan(cmd.OutOrStdout(), res)
+			return nil
+		}
+
+		if *tagFlag != "" {
+			_, err = infoColour.Fprintf(
+				cmd.OutOrStdout(),
+				"🔨 Deploying '%s' with tag '%s'. Hold on tight!\n",
+				serviceName,
+				*tagFlag,
+			)
+		} else {
+			_, err = infoColour.Fprintf(
+				cmd.OutOrStdout(),
+				"🔨 Deploying '%s'. Hold on tight!\n",
+				serviceName,
+			)
+		}
 		if err != nil {
 			return err
 		}
@@ -55,6 +83,7 @@ func newDeployCmd(eP engineProvider) *cobra.Command {
 		res, err := engine.Deploy(cmd.Context(), guvnor.DeployArgs{
 			ServiceName: serviceName,
 			Tag:         *tagFlag,
+			Lock:        lockOptions(),
 		})
 		if err != nil {
 			return err
@@ -14,12 +14,13 @@ import (
 
 func Test_newDeployCmd(t *testing.T) {
 	tests := []struct {
-		name      string
-		args      []string
-		wantArgs  *guvnor.DeployArgs
-		engineRes *guvnor.DeployResult
-		engineErr error
-		wantErr   string
+		name         string
+		args         []string
+		wantArgs     *guvnor.DeployArgs
+		wantPlanArgs *guvnor.PlanArgs
+		engineRes    *guvnor.DeployResult
+		engineErr    error
+		wantErr      string
 	}{
 		{
 			name: "success",
@@ -32,6 +33,42 @@ func Test_newDeployCmd(t *testing.T) {
 				DeploymentID: 100,
 			},
 		},
+		{
+			name: "with tag",
+			args: []string{"fizzler", "--tag", "v1.2.3"},
+			wantArgs: &guvnor.DeployArgs{
+				ServiceName: "fizzler",
+				Tag:         "v1.2.3",
+			},
+			engineRes: &guvnor.DeployResult{
+				ServiceName:  "fizzler",
+				DeploymentID: 101,
+				Tag:          "v1.2.3",
+			},
+		},
+		{
+			name: "lock flags",
+			args: []string{"fizzler", "--wait", "--force-unlock"},
+			wantArgs: &guvnor.DeployArgs{
+				ServiceName: "fizzler",
+				Lock: guvnor.LockOptions{
+					Wait:        true,
+					ForceUnlock: true,
+				},
+			},
+			engineRes: &guvnor.DeployResult{
+				ServiceName:  "fizzler",
+				DeploymentID: 102,
+			},
+		},
+		{
+			name: "dry run",
+			args: []string{"fizzler", "--dry-run", "--tag", "v2"},
+			wantPlanArgs: &guvnor.PlanArgs{
+				ServiceName: "fizzler",
+				Tag:         "v2",
+			},
+		},
 		{
 			name: "default service",
 			args: []string{},
@@ -75,6 +112,11 @@ func Test_newDeployCmd(t *testing.T) {
 					Return(&guvnor.GetDefaultServiceResult{Name: "boris"}, nil).
 					AnyTimes()
 			}
+			if tt.wantPlanArgs != nil {
+				mEngine.EXPECT().
+					Plan(ctx, *tt.wantPlanArgs).
+					Return(testPlanResult, nil)
+			}
 
 			cmd := newDeployCmd(provider)
 			stdout := bytes.NewBufferString("")
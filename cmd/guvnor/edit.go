@@ -1,15 +1,18 @@
 package main
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	"bufio"
+	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path"
+	"strings"
 
 	"github.com/krystal/guvnor"
+	"github.com/krystal/guvnor/state"
 	"github.com/spf13/cobra"
 )
 
@@ -35,32 +38,92 @@ func getEditor() string {
 	return path
 }
 
-func hashFile(path string) (string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
+// problemsPrefix marks the lines added to the top of a file being edited to
+// describe the problems with it. They are removed before the file is saved.
+const problemsPrefix = "# guvnor: "
+
+// addProblems returns data with the problems described in comments at the top
+// of it, so that they are shown when it is re-opened for editing. Lines within
+// the edited file are offset by the length of the comments.
+func addProblems(
+	data []byte, editPath string, problems []guvnor.ValidationProblem,
+) []byte {
+	lines := []string{
+		"The config was not saved due to the problems below, which should be",
+		"fixed before saving again. These lines will be removed on saving.",
+	}
+	offset := len(lines) + len(problems)
+	for _, problem := range problems {
+		if problem.File == editPath {
+			problem.File = path.Base(editPath)
+			if problem.Line > 0 {
+				problem.Line += offset
+			}
+		}
+		lines = append(lines, problem.String())
+	}
+
+	buf := &bytes.Buffer{}
+	for _, line := range lines {
+		buf.WriteString(problemsPrefix + line + "\n")
+	}
+	buf.Write(data)
+
+	return buf.Bytes()
+}
+
+// removeProblems removes the comments added by addProblems.
+func removeProblems(data []byte) []byte {
+	for bytes.HasPrefix(data, []byte(problemsPrefix)) {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return nil
+		}
+		data = data[i+1:]
 	}
 
-	hasher := md5.New()
-	if _, err = io.Copy(hasher, f); err != nil {
-		return "", err
+	return data
+}
+
+// confirm asks a yes or no question, returning true only if the answer is
+// yes.
+func confirm(cmd *cobra.Command, question string) (bool, error) {
+	_, err := labelColour.Fprintf(cmd.OutOrStdout(), "%s [y/N] ", question)
+	if err != nil {
+		return false, err
 	}
 
-	out := []byte{}
-	if _, err = hasher.Write(out); err != nil {
-		return "", err
+	answer, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
 	}
 
-	return hex.EncodeToString(hasher.Sum(nil)), nil
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
 }
 
 func newEditCommand(eP engineProvider) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:          "edit [service]",
-		Short:        "Opens a service configuration in your default editor and deploys it on saving.",
+		Use:   "edit [service]",
+		Short: "Opens a service configuration in your default editor and deploys it on saving.",
+		Long: "Opens a copy of a service configuration in your default editor. " +
+			"Once saved, the copy is validated, re-opening the editor if there " +
+			"are any problems, and the plan is shown before the configuration " +
+			"is replaced and deployed. The previous configuration is restored " +
+			"if the deployment fails.",
 		Args:         cobra.RangeArgs(0, 1),
 		SilenceUsage: true,
 	}
+	lockOptions := addLockFlags(cmd)
+	yesFlag := cmd.Flags().Bool(
+		"yes",
+		false,
+		"Deploys the changes without asking for confirmation",
+	)
 
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
 		engine, cfg, err := eP()
@@ -94,20 +157,37 @@ func newEditCommand(eP engineProvider) *cobra.Command {
 		}
 
 		servicePath := path.Join(cfg.Paths.Config, serviceName+".yaml")
-
-		// Hash file so we can tell if the user makes any changes, we don't want
-		// to deploy if they haven't.
-		before, err := hashFile(servicePath)
+		original, err := os.ReadFile(servicePath)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(servicePath)
 		if err != nil {
 			return err
 		}
+		// The service config is only ever replaced atomically, so that it is
+		// never left partially written.
+		writeServiceConfig := func(data []byte) error {
+			return state.WriteFileAtomic(servicePath, data, info.Mode().Perm())
+		}
 
-		editorCmd := exec.Command(
-			editorPath, servicePath,
-		)
-		editorCmd.Stdin = os.Stdin
-		editorCmd.Stdout = os.Stdout
-		editorCmd.Stderr = os.Stderr
+		// Changes are made to a copy, named after the service so that it can
+		// be validated and planned, which only replaces the service config
+		// once it is known to be valid and the changes have been confirmed.
+		editDir, err := os.MkdirTemp("", "guvnor-edit-")
+		if err != nil {
+			return err
+		}
+		keepEdits := false
+		defer func() {
+			if !keepEdits {
+				os.RemoveAll(editDir)
+			}
+		}()
+		editPath := path.Join(editDir, serviceName+".yaml")
+		if err := os.WriteFile(editPath, original, 0o600); err != nil {
+			return err
+		}
 
 		_, err = infoColour.Fprintf(
 			cmd.OutOrStdout(),
@@ -118,20 +198,116 @@ func newEditCommand(eP engineProvider) *cobra.Command {
 			return err
 		}
 
-		if err = editorCmd.Run(); err != nil {
-			return err
+		var edited, invalid []byte
+		for {
+			editorCmd := exec.Command(
+				editorPath, editPath,
+			)
+			editorCmd.Stdin = os.Stdin
+			editorCmd.Stdout = os.Stdout
+			editorCmd.Stderr = os.Stderr
+			if err = editorCmd.Run(); err != nil {
+				return err
+			}
+
+			edited, err = os.ReadFile(editPath)
+			if err != nil {
+				return err
+			}
+			edited = removeProblems(edited)
+
+			// We don't want to deploy if no changes have been made.
+			if bytes.Equal(edited, original) {
+				_, err = infoColour.Fprintln(
+					cmd.OutOrStdout(),
+					"🤷 No changes made to file, not deploying.",
+				)
+				return err
+			}
+			if invalid != nil && bytes.Equal(edited, invalid) {
+				return errors.New(
+					"no changes made to invalid config, discarding edits",
+				)
+			}
+
+			if err := os.WriteFile(editPath, edited, 0o600); err != nil {
+				return err
+			}
+			res, err := engine.ValidateService(
+				cmd.Context(),
+				guvnor.ValidateServiceArgs{
+					ServiceName: serviceName,
+					File:        editPath,
+				},
+			)
+			if err != nil {
+				return err
+			}
+
+			problems := []guvnor.ValidationProblem{}
+			for _, svc := range res.Services {
+				problems = append(problems, svc.Problems...)
+			}
+			if len(problems) == 0 {
+				break
+			}
+
+			_, err = errorColour.Fprintf(
+				cmd.OutOrStdout(),
+				"❌ %s has %d problem(s), re-opening for editing:\n",
+				serviceName,
+				len(problems),
+			)
+			if err != nil {
+				return err
+			}
+			for _, problem := range problems {
+				_, err = normalColour.Fprintf(
+					cmd.OutOrStdout(), "  %s\n", problem,
+				)
+				if err != nil {
+					return err
+				}
+			}
+
+			invalid = edited
+			err = os.WriteFile(
+				editPath, addProblems(edited, editPath, problems), 0o600,
+			)
+			if err != nil {
+				return err
+			}
 		}
 
-		after, err := hashFile(servicePath)
+		// Edits are kept from here on, so that they are not lost if the
+		// changes are not deployed.
+		keepEdits = true
+
+		plan, err := engine.Plan(cmd.Context(), guvnor.PlanArgs{
+			ServiceName: serviceName,
+			File:        editPath,
+		})
 		if err != nil {
-			return err
+			return fmt.Errorf("planning changes, edits kept in %s: %w", editPath, err)
 		}
+		printPlan(cmd.OutOrStdout(), plan)
 
-		if before == after {
-			_, err = infoColour.Fprintln(
-				cmd.OutOrStdout(),
-				"🤷 No changes made to file, not deploying.",
-			)
+		if !*yesFlag {
+			ok, err := confirm(cmd, fmt.Sprintf("Deploy '%s'?", serviceName))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				_, err = infoColour.Fprintf(
+					cmd.OutOrStdout(),
+					"🤷 Not deploying, edits kept in '%s'.\n",
+					editPath,
+				)
+				return err
+			}
+		}
+
+		if err := writeServiceConfig(edited); err != nil {
 			return err
 		}
 
@@ -146,10 +322,26 @@ func newEditCommand(eP engineProvider) *cobra.Command {
 
 		res, err := engine.Deploy(cmd.Context(), guvnor.DeployArgs{
 			ServiceName: serviceName,
+			Lock:        lockOptions(),
 		})
 		if err != nil {
+			if restoreErr := writeServiceConfig(original); restoreErr != nil {
+				return fmt.Errorf(
+					"%w (restoring previous config: %s)", err, restoreErr,
+				)
+			}
+			_, printErr := errorColour.Fprintf(
+				cmd.OutOrStdout(),
+				"⏪ Deployment failed, restored the previous '%s'. Edits kept in '%s'.\n",
+				servicePath,
+				editPath,
+			)
+			if printErr != nil {
+				return printErr
+			}
 			return err
 		}
+		keepEdits = false
 
 		_, err = successColour.Fprintf(
 			cmd.OutOrStdout(),
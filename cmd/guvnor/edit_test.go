@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/krystal/guvnor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEditor configures $EDITOR as a script that replaces the file being
+// edited with each of the edits in turn. The files it was given are recorded
+// so that what the user would have seen can be checked.
+func fakeEditor(t *testing.T, edits ...string) (seen func() []string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for i, edit := range edits {
+		require.NoError(t, os.WriteFile(
+			path.Join(dir, fmt.Sprintf("edit-%d", i)), []byte(edit), 0o644,
+		))
+	}
+
+	script := path.Join(dir, "editor")
+	require.NoError(t, os.WriteFile(script, []byte(fmt.Sprintf(`#!/bin/sh
+n=$(cat %[1]s/count 2>/dev/null || echo 0)
+cp "$1" %[1]s/seen-$n
+cp %[1]s/edit-$n "$1"
+echo $((n+1)) > %[1]s/count
+`, dir)), 0o755))
+	t.Setenv("EDITOR", script)
+
+	return func() []string {
+		files := []string{}
+		for i := range edits {
+			data, err := os.ReadFile(path.Join(dir, fmt.Sprintf("seen-%d", i)))
+			if err != nil {
+				break
+			}
+			files = append(files, string(data))
+		}
+		return files
+	}
+}
+
+func Test_newEditCommand(t *testing.T) {
+	original := "defaults:\n  image: foo\n  imageTag: v1\n"
+	updated := "defaults:\n  image: foo\n  imageTag: v2\n"
+	broken := "defaults:\n  image: foo\n  imag: v2\n"
+
+	invalid := func(file string) *guvnor.ValidateServiceResult {
+		return &guvnor.ValidateServiceResult{
+			Services: []guvnor.ServiceValidation{
+				{
+					ServiceName: "fizz",
+					File:        file,
+					Problems: []guvnor.ValidationProblem{
+						{
+							File:    file,
+							Line:    3,
+							Column:  3,
+							Message: "field imag not found in type guvnor.ServiceDefaultsConfig",
+						},
+					},
+				},
+			},
+		}
+	}
+	valid := func(file string) *guvnor.ValidateServiceResult {
+		return &guvnor.ValidateServiceResult{
+			Services: []guvnor.ServiceValidation{
+				{ServiceName: "fizz", File: file},
+			},
+		}
+	}
+	plan := &guvnor.PlanResult{
+		ServiceName:        "fizz",
+		ActiveDeploymentID: 1,
+		Processes: guvnor.ProcessPlans{
+			"web": {
+				Action:       guvnor.PlanActionReplace,
+				LiveReplicas: 1,
+				Changes: []guvnor.FieldChange{
+					{
+						Type:  guvnor.ChangeModified,
+						Field: "image",
+						From:  "foo:v1",
+						To:    "foo:v2",
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		edits       []string
+		args        []string
+		stdin       string
+		validations []func(file string) *guvnor.ValidateServiceResult
+		wantPlan    bool
+		wantDeploy  bool
+		deployErr   error
+		wantConfig  string
+		wantSeen    []string
+		wantOutput  []string
+		wantErr     string
+	}{
+		{
+			name:       "no changes",
+			edits:      []string{original},
+			args:       []string{"fizz"},
+			wantConfig: original,
+			wantSeen:   []string{original},
+			wantOutput: []string{"No changes made to file, not deploying."},
+		},
+		{
+			name:        "confirmed",
+			edits:       []string{updated},
+			args:        []string{"fizz"},
+			stdin:       "y\n",
+			validations: []func(string) *guvnor.ValidateServiceResult{valid},
+			wantPlan:    true,
+			wantDeploy:  true,
+			wantConfig:  updated,
+			wantOutput: []string{
+				`~ image: "foo:v1" => "foo:v2"`,
+				"Deploy 'fizz'? [y/N]",
+				"Succesfully deployed 'fizz'. Deployment ID is 2.",
+			},
+		},
+		{
+			name:        "yes flag",
+			edits:       []string{updated},
+			args:        []string{"fizz", "--yes"},
+			validations: []func(string) *guvnor.ValidateServiceResult{valid},
+			wantPlan:    true,
+			wantDeploy:  true,
+			wantConfig:  updated,
+		},
+		{
+			name:        "declined",
+			edits:       []string{updated},
+			args:        []string{"fizz"},
+			stdin:       "n\n",
+			validations: []func(string) *guvnor.ValidateServiceResult{valid},
+			wantPlan:    true,
+			wantConfig:  original,
+			wantOutput:  []string{"Not deploying, edits kept in"},
+		},
+		{
+			name:  "invalid then fixed",
+			edits: []string{broken, updated},
+			args:  []string{"fizz", "--yes"},
+			validations: []func(string) *guvnor.ValidateServiceResult{
+				invalid, valid,
+			},
+			wantPlan:   true,
+			wantDeploy: true,
+			wantConfig: updated,
+			wantSeen: []string{
+				original,
+				"# guvnor: The config was not saved due to the problems below, which should be\n" +
+					"# guvnor: fixed before saving again. These lines will be removed on saving.\n" +
+					"# guvnor: fizz.yaml:6:3: field imag not found in type guvnor.ServiceDefaultsConfig\n" +
+					broken,
+			},
+			wantOutput: []string{
+				"fizz has 1 problem(s), re-opening for editing:",
+				"field imag not found in type guvnor.ServiceDefaultsConfig",
+			},
+		},
+		{
+			name:  "invalid and unchanged",
+			edits: []string{broken, "# guvnor: comment\n" + broken},
+			args:  []string{"fizz"},
+			validations: []func(string) *guvnor.ValidateServiceResult{
+				invalid,
+			},
+			wantConfig: original,
+			wantErr:    "no changes made to invalid config, discarding edits",
+		},
+		{
+			name:        "deploy failure",
+			edits:       []string{updated},
+			args:        []string{"fizz", "--yes"},
+			validations: []func(string) *guvnor.ValidateServiceResult{valid},
+			wantPlan:    true,
+			wantDeploy:  true,
+			deployErr:   errors.New("ready check failed"),
+			wantConfig:  original,
+			wantOutput:  []string{"Deployment failed, restored the previous"},
+			wantErr:     "ready check failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mEngine := NewMockengine(ctrl)
+
+			dir := t.TempDir()
+			servicePath := path.Join(dir, "fizz.yaml")
+			require.NoError(t, os.WriteFile(servicePath, []byte(original), 0o640))
+			seen := fakeEditor(t, tt.edits...)
+
+			ctx := context.Background()
+			provider := func() (engine, *guvnor.EngineConfig, error) {
+				return mEngine, &guvnor.EngineConfig{
+					Paths: guvnor.PathsConfig{Config: dir},
+				}, nil
+			}
+
+			calls := []*gomock.Call{}
+			for _, validation := range tt.validations {
+				validation := validation
+				calls = append(calls, mEngine.EXPECT().
+					ValidateService(ctx, gomock.Any()).
+					DoAndReturn(func(
+						_ context.Context, args guvnor.ValidateServiceArgs,
+					) (*guvnor.ValidateServiceResult, error) {
+						assert.Equal(t, "fizz", args.ServiceName)
+						assert.Equal(t, "fizz.yaml", path.Base(args.File))
+						assert.NotEqual(t, servicePath, args.File)
+						return validation(args.File), nil
+					}))
+			}
+			if tt.wantPlan {
+				calls = append(calls, mEngine.EXPECT().
+					Plan(ctx, gomock.Any()).
+					DoAndReturn(func(
+						_ context.Context, args guvnor.PlanArgs,
+					) (*guvnor.PlanResult, error) {
+						assert.Equal(t, "fizz", args.ServiceName)
+						data, err := os.ReadFile(args.File)
+						require.NoError(t, err)
+						assert.Equal(t, updated, string(data))
+						return plan, nil
+					}))
+			}
+			if tt.wantDeploy {
+				calls = append(calls, mEngine.EXPECT().
+					Deploy(ctx, guvnor.DeployArgs{ServiceName: "fizz"}).
+					DoAndReturn(func(
+						_ context.Context, _ guvnor.DeployArgs,
+					) (*guvnor.DeployResult, error) {
+						data, err := os.ReadFile(servicePath)
+						require.NoError(t, err)
+						assert.Equal(t, updated, string(data))
+						if tt.deployErr != nil {
+							return nil, tt.deployErr
+						}
+						return &guvnor.DeployResult{
+							ServiceName:  "fizz",
+							DeploymentID: 2,
+						}, nil
+					}))
+			}
+			gomock.InOrder(calls...)
+
+			cmd := newEditCommand(provider)
+			stdout := bytes.NewBufferString("")
+			cmd.SetOut(stdout)
+			cmd.SetErr(stdout)
+			cmd.SetIn(bytes.NewBufferString(tt.stdin))
+			cmd.SetArgs(tt.args)
+
+			err := cmd.ExecuteContext(ctx)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			data, err := os.ReadFile(servicePath)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantConfig, string(data))
+
+			// The config is replaced atomically, leaving no temporary files
+			// behind and keeping its permissions.
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			info, err := entries[0].Info()
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+			if tt.wantSeen != nil {
+				assert.Equal(t, tt.wantSeen, seen())
+			}
+			for _, want := range tt.wantOutput {
+				assert.Contains(t, stdout.String(), want)
+			}
+		})
+	}
+}
+
+func Test_removeProblems(t *testing.T) {
+	data := []byte("# a comment\nfoo: bar\n")
+	problems := []guvnor.ValidationProblem{
+		{Message: "something is wrong"},
+		{File: "/etc/guvnor/services/shared/base.yaml", Line: 2, Message: "and here"},
+	}
+
+	withProblems := addProblems(data, "/tmp/fizz.yaml", problems)
+	assert.Contains(t, string(withProblems), "# guvnor: something is wrong\n")
+	assert.Contains(
+		t, string(withProblems),
+		"# guvnor: /etc/guvnor/services/shared/base.yaml:2: and here\n",
+	)
+	assert.Equal(t, data, removeProblems(withProblems))
+	assert.Equal(t, data, removeProblems(data))
+}
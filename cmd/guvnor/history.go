@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/krystal/guvnor"
+	"github.com/krystal/guvnor/state"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+func newHistoryCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history [service]",
+		Short: "Shows the deployment history of a specific service",
+		Args:  cobra.RangeArgs(0, 1),
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		engine, _, err := eP()
+		if err != nil {
+			return err
+		}
+
+		serviceName := ""
+		if len(args) == 0 {
+			_, err = infoColour.Fprintln(
+				cmd.OutOrStdout(),
+				"⚠️  No service argument provided. Finding default.",
+			)
+			if err != nil {
+				return err
+			}
+			res, err := engine.GetDefaultService()
+			if err != nil {
+				return err
+			}
+			serviceName = res.Name
+		} else {
+			serviceName = args[0]
+		}
+
+		res, err := engine.History(
+			cmd.Context(),
+			guvnor.HistoryArgs{ServiceName: serviceName},
+		)
+		if err != nil {
+			return err
+		}
+
+		infoColour.Fprintf(
+			cmd.OutOrStdout(),
+			"------ Service: %s ------\n",
+			serviceName,
+		)
+		tw := tablewriter.NewWriter(colorWriter{cmd.OutOrStdout(), tableColour})
+		tw.SetHeader([]string{"ID", "Status", "Started", "Duration", "Tag", "User", "Note"})
+		tw.SetBorder(false)
+		tw.SetRowLine(false)
+		tw.SetHeaderLine(false)
+		tw.SetColumnSeparator("")
+		for _, deployment := range res.Deployments {
+			status := string(deployment.Status)
+			switch deployment.Status {
+			case state.StatusSuccess:
+				status = successColour.Sprint(status)
+			case state.StatusFailure, state.StatusRolledBack:
+				status = errorColour.Sprint(status)
+			}
+
+			note := ""
+			if deployment.RollbackOf != 0 {
+				note = fmt.Sprintf("rollback to %d", deployment.RollbackOf)
+			}
+
+			tw.Append([]string{
+				fmt.Sprintf("%d", deployment.ID),
+				status,
+				deployment.StartedAt.Format(time.RFC1123),
+				deployment.FinishedAt.Sub(deployment.StartedAt).Round(time.Second).String(),
+				deployment.Tag,
+				deployment.TriggeredBy,
+				note,
+			})
+		}
+		tw.Render()
+
+		return nil
+	}
+
+	return cmd
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/jimeh/go-golden"
+	"github.com/krystal/guvnor"
+	"github.com/krystal/guvnor/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newHistoryCmd(t *testing.T) {
+	startedAt := time.Date(2000, 11, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		args      []string
+		wantArgs  *guvnor.HistoryArgs
+		engineRes *guvnor.HistoryResult
+		engineErr error
+		wantErr   string
+	}{
+		{
+			name: "success",
+			args: []string{"fizzler"},
+			wantArgs: &guvnor.HistoryArgs{
+				ServiceName: "fizzler",
+			},
+			engineRes: &guvnor.HistoryResult{
+				Deployments: []state.Deployment{
+					{
+						ID:          3,
+						Status:      state.StatusSuccess,
+						StartedAt:   startedAt.Add(time.Hour),
+						FinishedAt:  startedAt.Add(time.Hour + 30*time.Second),
+						TriggeredBy: "alice",
+						Tag:         "v1",
+						RollbackOf:  1,
+					},
+					{
+						ID:          2,
+						Status:      state.StatusFailure,
+						StartedAt:   startedAt.Add(time.Minute),
+						FinishedAt:  startedAt.Add(time.Minute + 5*time.Second),
+						TriggeredBy: "bob",
+						Tag:         "v2",
+					},
+					{
+						ID:          1,
+						Status:      state.StatusSuccess,
+						StartedAt:   startedAt,
+						FinishedAt:  startedAt.Add(time.Minute),
+						TriggeredBy: "alice",
+						Tag:         "v1",
+					},
+				},
+			},
+		},
+		{
+			name: "default service",
+			args: []string{},
+			wantArgs: &guvnor.HistoryArgs{
+				ServiceName: "boris",
+			},
+			engineRes: &guvnor.HistoryResult{},
+		},
+		{
+			name:      "error",
+			args:      []string{"oops"},
+			engineErr: errors.New("rats"),
+			wantArgs: &guvnor.HistoryArgs{
+				ServiceName: "oops",
+			},
+			wantErr: "rats",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mEngine := NewMockengine(ctrl)
+
+			ctx := context.Background()
+			provider := func() (engine, *guvnor.EngineConfig, error) {
+				return mEngine, nil, nil
+			}
+
+			if tt.wantArgs != nil {
+				mEngine.EXPECT().
+					History(
+						ctx,
+						*tt.wantArgs).
+					Return(tt.engineRes, tt.engineErr)
+				mEngine.EXPECT().
+					GetDefaultService().
+					Return(&guvnor.GetDefaultServiceResult{Name: "boris"}, nil).
+					AnyTimes()
+			}
+
+			cmd := newHistoryCmd(provider)
+			stdout := bytes.NewBufferString("")
+			stderr := bytes.NewBufferString("")
+			cmd.SetOut(stdout)
+			cmd.SetErr(stderr)
+			cmd.SetArgs(tt.args)
+
+			err := cmd.ExecuteContext(ctx)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if golden.Update() {
+				golden.SetP(t, "stdout", stdout.Bytes())
+				golden.SetP(t, "stderr", stderr.Bytes())
+			}
+			assert.Equal(t, golden.GetP(t, "stdout"), stdout.Bytes())
+			assert.Equal(t, golden.GetP(t, "stderr"), stderr.Bytes())
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/krystal/guvnor"
+	"github.com/spf13/cobra"
+)
+
+// addLockFlags registers the flags controlling how a command acquires the
+// lock of a service, returning a func to read their values once parsed.
+func addLockFlags(cmd *cobra.Command) func() guvnor.LockOptions {
+	waitFlag := cmd.Flags().Bool(
+		"wait",
+		false,
+		"Waits for another operation on the service to finish instead of failing",
+	)
+	forceUnlockFlag := cmd.Flags().Bool(
+		"force-unlock",
+		false,
+		"Removes an existing lock on the service, only use this if the holder has died",
+	)
+
+	return func() guvnor.LockOptions {
+		return guvnor.LockOptions{
+			Wait:        *waitFlag,
+			ForceUnlock: *forceUnlockFlag,
+		}
+	}
+}
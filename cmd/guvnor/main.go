@@ -86,9 +86,20 @@ type engine interface {
 	Cleanup(context.Context, guvnor.CleanupArgs) error
 	Deploy(context.Context, guvnor.DeployArgs) (*guvnor.DeployResult, error)
 	GetDefaultService() (*guvnor.GetDefaultServiceResult, error)
+	GetSecret(context.Context, guvnor.GetSecretArgs) (*guvnor.GetSecretResult, error)
+	History(context.Context, guvnor.HistoryArgs) (*guvnor.HistoryResult, error)
+	ListSecrets(context.Context, guvnor.ListSecretsArgs) (*guvnor.ListSecretsResult, error)
+	ListVolumes(context.Context, guvnor.ListVolumesArgs) (*guvnor.ListVolumesResult, error)
+	Plan(context.Context, guvnor.PlanArgs) (*guvnor.PlanResult, error)
 	Purge(context.Context) error
+	RemoveSecret(context.Context, guvnor.RemoveSecretArgs) error
+	RenderServiceConfig(context.Context, guvnor.RenderServiceConfigArgs) (*guvnor.RenderServiceConfigResult, error)
+	Rollback(context.Context, guvnor.RollbackArgs) (*guvnor.RollbackResult, error)
 	RunTask(context.Context, guvnor.RunTaskArgs) error
+	SetSecret(context.Context, guvnor.SetSecretArgs) error
 	Status(context.Context, guvnor.StatusArgs) (*guvnor.StatusResult, error)
+	ValidateService(context.Context, guvnor.ValidateServiceArgs) (*guvnor.ValidateServiceResult, error)
+	VerifyState(context.Context) (*guvnor.VerifyStateResult, error)
 }
 
 func main() {
@@ -105,12 +116,21 @@ func main() {
 	eProv := stdEngineProvider(log, &serviceRootOverride)
 	root := newRootCmd(
 		newCleanupCommand(eProv),
+		newConfigCmd(eProv),
 		newDeployCmd(eProv),
 		newEditCommand(eProv),
+		newHistoryCmd(eProv),
 		newInitCmd(),
+		newPlanCmd(eProv),
 		newPurgeCmd(eProv),
+		newRollbackCmd(eProv),
 		newRunCmd(eProv),
+		newSchemaCmd(),
+		newSecretsCmd(eProv),
+		newStateCmd(eProv),
 		newStatusCmd(eProv),
+		newValidateCmd(eProv),
+		newVolumesCmd(eProv),
 	)
 
 	root.PersistentFlags().StringVar(
@@ -79,6 +79,81 @@ func (mr *MockengineMockRecorder) GetDefaultService() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDefaultService", reflect.TypeOf((*Mockengine)(nil).GetDefaultService))
 }
 
+// GetSecret mocks base method.
+func (m *Mockengine) GetSecret(arg0 context.Context, arg1 guvnor.GetSecretArgs) (*guvnor.GetSecretResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSecret", arg0, arg1)
+	ret0, _ := ret[0].(*guvnor.GetSecretResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSecret indicates an expected call of GetSecret.
+func (mr *MockengineMockRecorder) GetSecret(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSecret", reflect.TypeOf((*Mockengine)(nil).GetSecret), arg0, arg1)
+}
+
+// History mocks base method.
+func (m *Mockengine) History(arg0 context.Context, arg1 guvnor.HistoryArgs) (*guvnor.HistoryResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", arg0, arg1)
+	ret0, _ := ret[0].(*guvnor.HistoryResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockengineMockRecorder) History(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*Mockengine)(nil).History), arg0, arg1)
+}
+
+// ListSecrets mocks base method.
+func (m *Mockengine) ListSecrets(arg0 context.Context, arg1 guvnor.ListSecretsArgs) (*guvnor.ListSecretsResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSecrets", arg0, arg1)
+	ret0, _ := ret[0].(*guvnor.ListSecretsResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSecrets indicates an expected call of ListSecrets.
+func (mr *MockengineMockRecorder) ListSecrets(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSecrets", reflect.TypeOf((*Mockengine)(nil).ListSecrets), arg0, arg1)
+}
+
+// ListVolumes mocks base method.
+func (m *Mockengine) ListVolumes(arg0 context.Context, arg1 guvnor.ListVolumesArgs) (*guvnor.ListVolumesResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListVolumes", arg0, arg1)
+	ret0, _ := ret[0].(*guvnor.ListVolumesResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListVolumes indicates an expected call of ListVolumes.
+func (mr *MockengineMockRecorder) ListVolumes(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListVolumes", reflect.TypeOf((*Mockengine)(nil).ListVolumes), arg0, arg1)
+}
+
+// Plan mocks base method.
+func (m *Mockengine) Plan(arg0 context.Context, arg1 guvnor.PlanArgs) (*guvnor.PlanResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Plan", arg0, arg1)
+	ret0, _ := ret[0].(*guvnor.PlanResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Plan indicates an expected call of Plan.
+func (mr *MockengineMockRecorder) Plan(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Plan", reflect.TypeOf((*Mockengine)(nil).Plan), arg0, arg1)
+}
+
 // Purge mocks base method.
 func (m *Mockengine) Purge(arg0 context.Context) error {
 	m.ctrl.T.Helper()
@@ -93,6 +168,50 @@ func (mr *MockengineMockRecorder) Purge(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*Mockengine)(nil).Purge), arg0)
 }
 
+// RemoveSecret mocks base method.
+func (m *Mockengine) RemoveSecret(arg0 context.Context, arg1 guvnor.RemoveSecretArgs) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveSecret", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveSecret indicates an expected call of RemoveSecret.
+func (mr *MockengineMockRecorder) RemoveSecret(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveSecret", reflect.TypeOf((*Mockengine)(nil).RemoveSecret), arg0, arg1)
+}
+
+// RenderServiceConfig mocks base method.
+func (m *Mockengine) RenderServiceConfig(arg0 context.Context, arg1 guvnor.RenderServiceConfigArgs) (*guvnor.RenderServiceConfigResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenderServiceConfig", arg0, arg1)
+	ret0, _ := ret[0].(*guvnor.RenderServiceConfigResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RenderServiceConfig indicates an expected call of RenderServiceConfig.
+func (mr *MockengineMockRecorder) RenderServiceConfig(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenderServiceConfig", reflect.TypeOf((*Mockengine)(nil).RenderServiceConfig), arg0, arg1)
+}
+
+// Rollback mocks base method.
+func (m *Mockengine) Rollback(arg0 context.Context, arg1 guvnor.RollbackArgs) (*guvnor.RollbackResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rollback", arg0, arg1)
+	ret0, _ := ret[0].(*guvnor.RollbackResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Rollback indicates an expected call of Rollback.
+func (mr *MockengineMockRecorder) Rollback(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rollback", reflect.TypeOf((*Mockengine)(nil).Rollback), arg0, arg1)
+}
+
 // RunTask mocks base method.
 func (m *Mockengine) RunTask(arg0 context.Context, arg1 guvnor.RunTaskArgs) error {
 	m.ctrl.T.Helper()
@@ -107,6 +226,20 @@ func (mr *MockengineMockRecorder) RunTask(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunTask", reflect.TypeOf((*Mockengine)(nil).RunTask), arg0, arg1)
 }
 
+// SetSecret mocks base method.
+func (m *Mockengine) SetSecret(arg0 context.Context, arg1 guvnor.SetSecretArgs) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetSecret", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetSecret indicates an expected call of SetSecret.
+func (mr *MockengineMockRecorder) SetSecret(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSecret", reflect.TypeOf((*Mockengine)(nil).SetSecret), arg0, arg1)
+}
+
 // Status mocks base method.
 func (m *Mockengine) Status(arg0 context.Context, arg1 guvnor.StatusArgs) (*guvnor.StatusResult, error) {
 	m.ctrl.T.Helper()
@@ -121,3 +254,33 @@ func (mr *MockengineMockRecorder) Status(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Status", reflect.TypeOf((*Mockengine)(nil).Status), arg0, arg1)
 }
+
+// ValidateService mocks base method.
+func (m *Mockengine) ValidateService(arg0 context.Context, arg1 guvnor.ValidateServiceArgs) (*guvnor.ValidateServiceResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateService", arg0, arg1)
+	ret0, _ := ret[0].(*guvnor.ValidateServiceResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ValidateService indicates an expected call of ValidateService.
+func (mr *MockengineMockRecorder) ValidateService(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateService", reflect.TypeOf((*Mockengine)(nil).ValidateService), arg0, arg1)
+}
+
+// VerifyState mocks base method.
+func (m *Mockengine) VerifyState(arg0 context.Context) (*guvnor.VerifyStateResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyState", arg0)
+	ret0, _ := ret[0].(*guvnor.VerifyStateResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyState indicates an expected call of VerifyState.
+func (mr *MockengineMockRecorder) VerifyState(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyState", reflect.TypeOf((*Mockengine)(nil).VerifyState), arg0)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/krystal/guvnor"
+	"github.com/spf13/cobra"
+)
+
+// printPlan renders the result of a plan in a human readable format.
+func printPlan(w io.Writer, res *guvnor.PlanResult) {
+	infoColour.Fprintf(
+		w,
+		"------ Service: %s ------\n",
+		res.ServiceName,
+	)
+	labelColour.Fprint(w, "Active deployment: ")
+	normalColour.Fprintln(w, res.ActiveDeploymentID)
+
+	for _, processName := range res.Processes.OrderedKeys() {
+		process := res.Processes[processName]
+		infoColour.Fprintf(
+			w, "---- Process: %s (%s) ----\n", processName, process.Action,
+		)
+		labelColour.Fprint(w, "Running replicas: ")
+		normalColour.Fprintln(w, process.LiveReplicas)
+
+		if process.Action == guvnor.PlanActionRemove {
+			errorColour.Fprintln(w, "Process removed from config, containers will be stopped")
+			continue
+		}
+		if len(process.Changes) == 0 {
+			normalColour.Fprintln(w, "No configuration changes")
+		}
+		for _, change := range process.Changes {
+			switch change.Type {
+			case guvnor.ChangeAdded:
+				successColour.Fprintf(w, "+ %s: %q\n", change.Field, change.To)
+			case guvnor.ChangeRemoved:
+				errorColour.Fprintf(w, "- %s: %q\n", change.Field, change.From)
+			case guvnor.ChangeModified:
+				infoColour.Fprintf(
+					w, "~ %s: %q => %q\n", change.Field, change.From, change.To,
+				)
+			}
+		}
+	}
+
+	if len(res.PreDeploymentTasks) > 0 {
+		labelColour.Fprint(w, "Pre-deployment tasks: ")
+		normalColour.Fprintln(w, strings.Join(res.PreDeploymentTasks, ", "))
+	}
+	if len(res.PostDeploymentTasks) > 0 {
+		labelColour.Fprint(w, "Post-deployment tasks: ")
+		normalColour.Fprintln(w, strings.Join(res.PostDeploymentTasks, ", "))
+	}
+}
+
+func printPlanJSON(w io.Writer, res *guvnor.PlanResult) error {
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func newPlanCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "plan [service]",
+		Short:        "Shows the changes a deployment of a given service would make",
+		Args:         cobra.RangeArgs(0, 1),
+		SilenceUsage: true,
+	}
+
+	tagFlag := cmd.Flags().String(
+		"tag",
+		"",
+		"Configures a specific image tag to plan a deployment of",
+	)
+	jsonFlag := cmd.Flags().Bool(
+		"json",
+		false,
+		"Outputs the plan as JSON",
+	)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		engine, _, err := eP()
+		if err != nil {
+			return err
+		}
+
+		serviceName := ""
+		if len(args) == 0 {
+			if !*jsonFlag {
+				_, err = infoColour.Fprintln(
+					cmd.OutOrStdout(),
+					"⚠️  No service argument provided. Finding default.",
+				)
+				if err != nil {
+					return err
+				}
+			}
+			res, err := engine.GetDefaultService()
+			if err != nil {
+				return err
+			}
+			serviceName = res.Name
+		} else {
+			serviceName = args[0]
+		}
+
+		res, err := engine.Plan(cmd.Context(), guvnor.PlanArgs{
+			ServiceName: serviceName,
+			Tag:         *tagFlag,
+		})
+		if err != nil {
+			return err
+		}
+
+		if *jsonFlag {
+			return printPlanJSON(cmd.OutOrStdout(), res)
+		}
+
+		printPlan(cmd.OutOrStdout(), res)
+		return nil
+	}
+
+	return cmd
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/jimeh/go-golden"
+	"github.com/krystal/guvnor"
+	"github.com/stretchr/testify/assert"
+)
+
+var testPlanResult = &guvnor.PlanResult{
+	ServiceName:        "fizzler",
+	ActiveDeploymentID: 12,
+	Processes: guvnor.ProcessPlans{
+		"web": {
+			Action:       guvnor.PlanActionReplace,
+			LiveReplicas: 2,
+			Changes: []guvnor.FieldChange{
+				{Type: guvnor.ChangeModified, Field: "image", From: "fizz:v1", To: "fizz:v2"},
+				{Type: guvnor.ChangeAdded, Field: "env.FOO", To: "bar"},
+				{Type: guvnor.ChangeRemoved, Field: "caddy.hostnames", From: "a.example.com"},
+			},
+		},
+		"worker": {
+			Action:       guvnor.PlanActionReplace,
+			LiveReplicas: 1,
+		},
+		"cron": {
+			Action:       guvnor.PlanActionRemove,
+			LiveReplicas: 1,
+		},
+	},
+	PreDeploymentTasks:  []string{"migrate"},
+	PostDeploymentTasks: []string{"notifySlack", "notifyEmail"},
+}
+
+func Test_newPlanCmd(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantArgs  *guvnor.PlanArgs
+		engineRes *guvnor.PlanResult
+		engineErr error
+		wantErr   string
+	}{
+		{
+			name: "success",
+			args: []string{"fizzler", "--tag", "v2"},
+			wantArgs: &guvnor.PlanArgs{
+				ServiceName: "fizzler",
+				Tag:         "v2",
+			},
+			engineRes: testPlanResult,
+		},
+		{
+			name: "json",
+			args: []string{"--json"},
+			wantArgs: &guvnor.PlanArgs{
+				ServiceName: "boris",
+			},
+			engineRes: testPlanResult,
+		},
+		{
+			name:      "error",
+			args:      []string{"oops"},
+			engineErr: errors.New("rats"),
+			wantArgs: &guvnor.PlanArgs{
+				ServiceName: "oops",
+			},
+			wantErr: "rats",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mEngine := NewMockengine(ctrl)
+
+			ctx := context.Background()
+			provider := func() (engine, *guvnor.EngineConfig, error) {
+				return mEngine, nil, nil
+			}
+
+			if tt.wantArgs != nil {
+				mEngine.EXPECT().
+					Plan(
+						ctx,
+						*tt.wantArgs).
+					Return(tt.engineRes, tt.engineErr)
+				mEngine.EXPECT().
+					GetDefaultService().
+					Return(&guvnor.GetDefaultServiceResult{Name: "boris"}, nil).
+					AnyTimes()
+			}
+
+			cmd := newPlanCmd(provider)
+			stdout := bytes.NewBufferString("")
+			stderr := bytes.NewBufferString("")
+			cmd.SetOut(stdout)
+			cmd.SetErr(stderr)
+			cmd.SetArgs(tt.args)
+
+			err := cmd.ExecuteContext(ctx)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if golden.Update() {
+				golden.SetP(t, "stdout", stdout.Bytes())
+				golden.SetP(t, "stderr", stderr.Bytes())
+			}
+			assert.Equal(t, golden.GetP(t, "stdout"), stdout.Bytes())
+			assert.Equal(t, golden.GetP(t, "stderr"), stderr.Bytes())
+		})
+	}
+}
@@ -9,7 +9,7 @@ import (
 func newPurgeCmd(eP engineProvider) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "purge",
-		Short: "Purges all containers created by Guvnor",
+		Short: "Purges all containers, networks and volumes created by Guvnor",
 	}
 
 	confirmFlag := cmd.Flags().Bool(
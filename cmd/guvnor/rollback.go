@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/krystal/guvnor"
+	"github.com/spf13/cobra"
+)
+
+func newRollbackCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "rollback [service]",
+		Short:        "Redeploys a previous deployment of a given service",
+		Args:         cobra.RangeArgs(0, 1),
+		SilenceUsage: true,
+	}
+
+	toFlag := cmd.Flags().Int(
+		"to",
+		0,
+		"Configures the deployment ID to roll back to, defaults to the previous successful deployment",
+	)
+	lockOptions := addLockFlags(cmd)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		engine, _, err := eP()
+		if err != nil {
+			return err
+		}
+
+		serviceName := ""
+		if len(args) == 0 {
+			_, err = infoColour.Fprintln(
+				cmd.OutOrStdout(),
+				"⚠️  No service argument provided. Finding default.",
+			)
+			if err != nil {
+				return err
+			}
+			res, err := engine.GetDefaultService()
+			if err != nil {
+				return err
+			}
+			serviceName = res.Name
+		} else {
+			serviceName = args[0]
+		}
+
+		_, err = infoColour.Fprintf(
+			cmd.OutOrStdout(),
+			"⏪ Rolling back '%s'. Hold on tight!\n",
+			serviceName,
+		)
+		if err != nil {
+			return err
+		}
+
+		res, err := engine.Rollback(cmd.Context(), guvnor.RollbackArgs{
+			ServiceName:  serviceName,
+			DeploymentID: *toFlag,
+			Lock:         lockOptions(),
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = successColour.Fprintf(
+			cmd.OutOrStdout(),
+			"✅ Succesfully rolled back '%s' to deployment %d. Deployment ID is %d.\n",
+			res.ServiceName,
+			res.RolledBackTo,
+			res.DeploymentID,
+		)
+		return err
+	}
+
+	return cmd
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/jimeh/go-golden"
+	"github.com/krystal/guvnor"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newRollbackCmd(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantArgs  *guvnor.RollbackArgs
+		engineRes *guvnor.RollbackResult
+		engineErr error
+		wantErr   string
+	}{
+		{
+			name: "success",
+			args: []string{"fizzler"},
+			wantArgs: &guvnor.RollbackArgs{
+				ServiceName: "fizzler",
+			},
+			engineRes: &guvnor.RollbackResult{
+				ServiceName:  "fizzler",
+				DeploymentID: 101,
+				RolledBackTo: 99,
+			},
+		},
+		{
+			name: "to deployment",
+			args: []string{"fizzler", "--to", "50"},
+			wantArgs: &guvnor.RollbackArgs{
+				ServiceName:  "fizzler",
+				DeploymentID: 50,
+			},
+			engineRes: &guvnor.RollbackResult{
+				ServiceName:  "fizzler",
+				DeploymentID: 101,
+				RolledBackTo: 50,
+			},
+		},
+		{
+			name: "default service",
+			args: []string{},
+			wantArgs: &guvnor.RollbackArgs{
+				ServiceName: "boris",
+			},
+			engineRes: &guvnor.RollbackResult{
+				ServiceName:  "boris",
+				DeploymentID: 200,
+				RolledBackTo: 198,
+			},
+		},
+		{
+			name:      "error",
+			args:      []string{"oops"},
+			engineErr: errors.New("rats"),
+			wantArgs: &guvnor.RollbackArgs{
+				ServiceName: "oops",
+			},
+			wantErr: "rats",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mEngine := NewMockengine(ctrl)
+
+			ctx := context.Background()
+			provider := func() (engine, *guvnor.EngineConfig, error) {
+				return mEngine, nil, nil
+			}
+
+			if tt.wantArgs != nil {
+				mEngine.EXPECT().
+					Rollback(
+						ctx,
+						*tt.wantArgs).
+					Return(tt.engineRes, tt.engineErr)
+				mEngine.EXPECT().
+					GetDefaultService().
+					Return(&guvnor.GetDefaultServiceResult{Name: "boris"}, nil).
+					AnyTimes()
+			}
+
+			cmd := newRollbackCmd(provider)
+			stdout := bytes.NewBufferString("")
+			stderr := bytes.NewBufferString("")
+			cmd.SetOut(stdout)
+			cmd.SetErr(stderr)
+			cmd.SetArgs(tt.args)
+
+			err := cmd.ExecuteContext(ctx)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if golden.Update() {
+				golden.SetP(t, "stdout", stdout.Bytes())
+				golden.SetP(t, "stderr", stderr.Bytes())
+			}
+			assert.Equal(t, golden.GetP(t, "stdout"), stdout.Bytes())
+			assert.Equal(t, golden.GetP(t, "stderr"), stderr.Bytes())
+		})
+	}
+}
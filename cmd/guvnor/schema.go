@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/krystal/guvnor"
+	"github.com/spf13/cobra"
+)
+
+func newSchemaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Outputs a JSON Schema for service configs",
+		Long: "Outputs a JSON Schema for service configs, which editors can " +
+			"use to provide completion and highlight mistakes.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+
+		return encoder.Encode(guvnor.ServiceConfigSchema())
+	}
+
+	return cmd
+}
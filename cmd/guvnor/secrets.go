@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/krystal/guvnor"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func newSecretsCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Commands for managing the encrypted secrets referenced by services",
+	}
+
+	cmd.AddCommand(
+		newSecretsGetCmd(eP),
+		newSecretsListCmd(eP),
+		newSecretsRmCmd(eP),
+		newSecretsSetCmd(eP),
+	)
+
+	return cmd
+}
+
+// secretArgs splits the arguments of a secrets command into the service and
+// name of the secret. When only a name is given, the secret is available to
+// all services.
+func secretArgs(args []string) (string, string) {
+	if len(args) == 2 {
+		return args[0], args[1]
+	}
+
+	return "", args[0]
+}
+
+func secretScope(serviceName string) string {
+	if serviceName == "" {
+		return "all services"
+	}
+
+	return serviceName
+}
+
+// readSecretValue prompts for the value of a secret without echoing it when
+// run in a terminal, otherwise the value is read from stdin.
+func readSecretValue(cmd *cobra.Command) (string, error) {
+	in := cmd.InOrStdin()
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		if _, err := fmt.Fprint(cmd.ErrOrStderr(), "Value: "); err != nil {
+			return "", err
+		}
+		value, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(cmd.ErrOrStderr())
+		return string(value), err
+	}
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+func newSecretsSetCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set [service] NAME",
+		Short: "Sets a secret, reading its value from stdin",
+		Long: "Sets a secret, reading its value from stdin. When no service " +
+			"is given, the secret is available to all services.",
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		engine, _, err := eP()
+		if err != nil {
+			return err
+		}
+
+		serviceName, name := secretArgs(args)
+		value, err := readSecretValue(cmd)
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			return errors.New("secret value cannot be empty")
+		}
+
+		err = engine.SetSecret(cmd.Context(), guvnor.SetSecretArgs{
+			ServiceName: serviceName,
+			Name:        name,
+			Value:       value,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = successColour.Fprintf(
+			cmd.OutOrStdout(),
+			"✅ Set secret %s for %s.\n",
+			name,
+			secretScope(serviceName),
+		)
+		return err
+	}
+
+	return cmd
+}
+
+func newSecretsGetCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "get [service] NAME",
+		Short:        "Outputs the value of a secret",
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		engine, _, err := eP()
+		if err != nil {
+			return err
+		}
+
+		serviceName, name := secretArgs(args)
+		res, err := engine.GetSecret(cmd.Context(), guvnor.GetSecretArgs{
+			ServiceName: serviceName,
+			Name:        name,
+		})
+		if err != nil {
+			return err
+		}
+
+		// The value is output without colour so it can be piped elsewhere.
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), res.Value)
+		return err
+	}
+
+	return cmd
+}
+
+func newSecretsListCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "list [service]",
+		Short:        "Lists the names of secrets, without their values",
+		Args:         cobra.RangeArgs(0, 1),
+		SilenceUsage: true,
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		engine, _, err := eP()
+		if err != nil {
+			return err
+		}
+
+		serviceName := ""
+		if len(args) == 1 {
+			serviceName = args[0]
+		}
+
+		res, err := engine.ListSecrets(
+			cmd.Context(),
+			guvnor.ListSecretsArgs{ServiceName: serviceName},
+		)
+		if err != nil {
+			return err
+		}
+
+		if len(res.Secrets) == 0 {
+			_, err = infoColour.Fprintln(
+				cmd.OutOrStdout(),
+				"🤷 No secrets found.",
+			)
+			return err
+		}
+
+		tw := tablewriter.NewWriter(colorWriter{cmd.OutOrStdout(), tableColour})
+		tw.SetHeader([]string{"Name", "Updated"})
+		tw.SetBorder(false)
+		tw.SetRowLine(false)
+		tw.SetHeaderLine(false)
+		tw.SetColumnSeparator("")
+		tw.SetAutoWrapText(false)
+		for _, secret := range res.Secrets {
+			tw.Append([]string{
+				secret.Name,
+				secret.UpdatedAt.Format(time.RFC1123),
+			})
+		}
+		tw.Render()
+
+		return nil
+	}
+
+	return cmd
+}
+
+func newSecretsRmCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "rm [service] NAME",
+		Short:        "Removes a secret",
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		engine, _, err := eP()
+		if err != nil {
+			return err
+		}
+
+		serviceName, name := secretArgs(args)
+		err = engine.RemoveSecret(cmd.Context(), guvnor.RemoveSecretArgs{
+			ServiceName: serviceName,
+			Name:        name,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = successColour.Fprintf(
+			cmd.OutOrStdout(),
+			"✅ Removed secret %s for %s.\n",
+			name,
+			secretScope(serviceName),
+		)
+		return err
+	}
+
+	return cmd
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/jimeh/go-golden"
+	"github.com/krystal/guvnor"
+	"github.com/krystal/guvnor/state"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func executeSecretsCmd(
+	t *testing.T, ctx context.Context, cmd *cobra.Command, args []string, stdin string,
+) (*bytes.Buffer, *bytes.Buffer, error) {
+	t.Helper()
+
+	stdout := bytes.NewBufferString("")
+	stderr := bytes.NewBufferString("")
+	cmd.SetOut(stdout)
+	cmd.SetErr(stderr)
+	cmd.SetIn(bytes.NewBufferString(stdin))
+	cmd.SetArgs(args)
+
+	return stdout, stderr, cmd.ExecuteContext(ctx)
+}
+
+func assertGoldenOutput(t *testing.T, stdout, stderr *bytes.Buffer) {
+	t.Helper()
+
+	if golden.Update() {
+		golden.SetP(t, "stdout", stdout.Bytes())
+		golden.SetP(t, "stderr", stderr.Bytes())
+	}
+	assert.Equal(t, golden.GetP(t, "stdout"), stdout.Bytes())
+	assert.Equal(t, golden.GetP(t, "stderr"), stderr.Bytes())
+}
+
+func Test_newSecretsSetCmd(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		stdin     string
+		wantArgs  *guvnor.SetSecretArgs
+		engineErr error
+		wantErr   string
+	}{
+		{
+			name:  "service",
+			args:  []string{"set", "fizz", "API_KEY"},
+			stdin: "hunter2\n",
+			wantArgs: &guvnor.SetSecretArgs{
+				ServiceName: "fizz",
+				Name:        "API_KEY",
+				Value:       "hunter2",
+			},
+		},
+		{
+			name:  "all services",
+			args:  []string{"set", "SMTP_PASSWORD"},
+			stdin: "correct horse",
+			wantArgs: &guvnor.SetSecretArgs{
+				Name:  "SMTP_PASSWORD",
+				Value: "correct horse",
+			},
+		},
+		{
+			name:    "empty value",
+			args:    []string{"set", "fizz", "API_KEY"},
+			stdin:   "\n",
+			wantErr: "secret value cannot be empty",
+		},
+		{
+			name:  "error",
+			args:  []string{"set", "fizz", "api-key"},
+			stdin: "hunter2",
+			wantArgs: &guvnor.SetSecretArgs{
+				ServiceName: "fizz",
+				Name:        "api-key",
+				Value:       "hunter2",
+			},
+			engineErr: errors.New("rats"),
+			wantErr:   "rats",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mEngine := NewMockengine(ctrl)
+
+			ctx := context.Background()
+			provider := func() (engine, *guvnor.EngineConfig, error) {
+				return mEngine, nil, nil
+			}
+
+			if tt.wantArgs != nil {
+				mEngine.EXPECT().
+					SetSecret(ctx, *tt.wantArgs).
+					Return(tt.engineErr)
+			}
+
+			stdout, stderr, err := executeSecretsCmd(
+				t, ctx, newSecretsCmd(provider), tt.args, tt.stdin,
+			)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assertGoldenOutput(t, stdout, stderr)
+		})
+	}
+}
+
+func Test_newSecretsGetCmd(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mEngine := NewMockengine(ctrl)
+
+	ctx := context.Background()
+	provider := func() (engine, *guvnor.EngineConfig, error) {
+		return mEngine, nil, nil
+	}
+
+	mEngine.EXPECT().
+		GetSecret(ctx, guvnor.GetSecretArgs{ServiceName: "fizz", Name: "API_KEY"}).
+		Return(&guvnor.GetSecretResult{Value: "hunter2"}, nil)
+
+	stdout, stderr, err := executeSecretsCmd(
+		t, ctx, newSecretsCmd(provider), []string{"get", "fizz", "API_KEY"}, "",
+	)
+	assert.NoError(t, err)
+	assertGoldenOutput(t, stdout, stderr)
+}
+
+func Test_newSecretsListCmd(t *testing.T) {
+	updatedAt := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		args      []string
+		wantArgs  guvnor.ListSecretsArgs
+		engineRes *guvnor.ListSecretsResult
+		engineErr error
+		wantErr   string
+	}{
+		{
+			name:     "service",
+			args:     []string{"list", "fizz"},
+			wantArgs: guvnor.ListSecretsArgs{ServiceName: "fizz"},
+			engineRes: &guvnor.ListSecretsResult{
+				Secrets: []state.SecretInfo{
+					{Service: "fizz", Name: "API_KEY", UpdatedAt: updatedAt},
+					{Service: "fizz", Name: "DATABASE_PASSWORD", UpdatedAt: updatedAt},
+				},
+			},
+		},
+		{
+			name:      "no secrets",
+			args:      []string{"list"},
+			wantArgs:  guvnor.ListSecretsArgs{},
+			engineRes: &guvnor.ListSecretsResult{Secrets: []state.SecretInfo{}},
+		},
+		{
+			name:      "error",
+			args:      []string{"list", "oops"},
+			wantArgs:  guvnor.ListSecretsArgs{ServiceName: "oops"},
+			engineErr: errors.New("rats"),
+			wantErr:   "rats",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mEngine := NewMockengine(ctrl)
+
+			ctx := context.Background()
+			provider := func() (engine, *guvnor.EngineConfig, error) {
+				return mEngine, nil, nil
+			}
+
+			mEngine.EXPECT().
+				ListSecrets(ctx, tt.wantArgs).
+				Return(tt.engineRes, tt.engineErr)
+
+			stdout, stderr, err := executeSecretsCmd(
+				t, ctx, newSecretsCmd(provider), tt.args, "",
+			)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assertGoldenOutput(t, stdout, stderr)
+		})
+	}
+}
+
+func Test_newSecretsRmCmd(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mEngine := NewMockengine(ctrl)
+
+	ctx := context.Background()
+	provider := func() (engine, *guvnor.EngineConfig, error) {
+		return mEngine, nil, nil
+	}
+
+	mEngine.EXPECT().
+		RemoveSecret(ctx, guvnor.RemoveSecretArgs{Name: "SMTP_PASSWORD"}).
+		Return(nil)
+
+	stdout, stderr, err := executeSecretsCmd(
+		t, ctx, newSecretsCmd(provider), []string{"rm", "SMTP_PASSWORD"}, "",
+	)
+	assert.NoError(t, err)
+	assertGoldenOutput(t, stdout, stderr)
+}
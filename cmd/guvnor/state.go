@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+func newStateCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Commands for managing the state stored by Guvnor",
+	}
+
+	cmd.AddCommand(newStateVerifyCmd(eP))
+
+	return cmd
+}
+
+func newStateVerifyCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "verify",
+		Short:        "Checks the stored state of every service can be read",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		engine, _, err := eP()
+		if err != nil {
+			return err
+		}
+
+		res, err := engine.VerifyState(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		if len(res.Files) == 0 {
+			_, err = infoColour.Fprintln(
+				cmd.OutOrStdout(),
+				"🤷 No state files found.",
+			)
+			return err
+		}
+
+		tw := tablewriter.NewWriter(colorWriter{cmd.OutOrStdout(), tableColour})
+		tw.SetHeader([]string{"Service", "File", "Version", "Status"})
+		tw.SetBorder(false)
+		tw.SetRowLine(false)
+		tw.SetHeaderLine(false)
+		tw.SetColumnSeparator("")
+		tw.SetAutoWrapText(false)
+		problems := 0
+		for _, file := range res.Files {
+			status := successColour.Sprint("OK")
+			if file.Err != nil {
+				problems++
+				status = errorColour.Sprint(file.Err.Error())
+			}
+
+			tw.Append([]string{
+				file.Service,
+				file.Path,
+				fmt.Sprintf("%d", file.Version),
+				status,
+			})
+		}
+		tw.Render()
+
+		if problems > 0 {
+			return fmt.Errorf("%d state file(s) are corrupt or unreadable", problems)
+		}
+
+		_, err = successColour.Fprintf(
+			cmd.OutOrStdout(),
+			"✅ All %d state files are valid.\n",
+			len(res.Files),
+		)
+		return err
+	}
+
+	return cmd
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/jimeh/go-golden"
+	"github.com/krystal/guvnor"
+	"github.com/krystal/guvnor/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newStateVerifyCmd(t *testing.T) {
+	tests := []struct {
+		name      string
+		engineRes *guvnor.VerifyStateResult
+		engineErr error
+		wantErr   string
+	}{
+		{
+			name: "valid",
+			engineRes: &guvnor.VerifyStateResult{
+				Files: []state.FileReport{
+					{
+						Service: "fizzler",
+						Path:    "/var/lib/guvnor/fizzler.json",
+						Version: 1,
+					},
+					{
+						Service: "fizzler",
+						Path:    "/var/lib/guvnor/history/fizzler.json",
+					},
+				},
+			},
+		},
+		{
+			name: "corrupt",
+			engineRes: &guvnor.VerifyStateResult{
+				Files: []state.FileReport{
+					{
+						Service: "fizzler",
+						Path:    "/var/lib/guvnor/fizzler.json",
+						Version: 1,
+					},
+					{
+						Service: "boris",
+						Path:    "/var/lib/guvnor/boris.json",
+						Err:     errors.New("unexpected end of JSON input"),
+					},
+				},
+			},
+			wantErr: "1 state file(s) are corrupt or unreadable",
+		},
+		{
+			name:      "no state",
+			engineRes: &guvnor.VerifyStateResult{Files: []state.FileReport{}},
+		},
+		{
+			name:      "error",
+			engineErr: errors.New("rats"),
+			wantErr:   "rats",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mEngine := NewMockengine(ctrl)
+
+			ctx := context.Background()
+			provider := func() (engine, *guvnor.EngineConfig, error) {
+				return mEngine, nil, nil
+			}
+
+			mEngine.EXPECT().
+				VerifyState(ctx).
+				Return(tt.engineRes, tt.engineErr)
+
+			cmd := newStateCmd(provider)
+			stdout := bytes.NewBufferString("")
+			stderr := bytes.NewBufferString("")
+			cmd.SetOut(stdout)
+			cmd.SetErr(stderr)
+			cmd.SetArgs([]string{"verify"})
+
+			err := cmd.ExecuteContext(ctx)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if golden.Update() {
+				golden.SetP(t, "stdout", stdout.Bytes())
+				golden.SetP(t, "stderr", stderr.Bytes())
+			}
+			assert.Equal(t, golden.GetP(t, "stdout"), stdout.Bytes())
+			assert.Equal(t, golden.GetP(t, "stderr"), stderr.Bytes())
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"time"
 
@@ -112,11 +113,12 @@ func newStatusCmd(eP engineProvider) *cobra.Command {
 				"Containers: ",
 			)
 			tw := tablewriter.NewWriter(colorWriter{cmd.OutOrStdout(), tableColour})
-			tw.SetHeader([]string{"Name", "ID", "Status"})
+			tw.SetHeader([]string{"Name", "ID", "Status", "Health", "Restarts"})
 			tw.SetBorder(false)
 			tw.SetRowLine(false)
 			tw.SetHeaderLine(false)
 			tw.SetColumnSeparator("")
+			tw.SetAutoWrapText(false)
 			for _, container := range process.Containers {
 				status := container.Status
 				switch status {
@@ -126,10 +128,30 @@ func newStatusCmd(eP engineProvider) *cobra.Command {
 				case "dead":
 					status = errorColour.Sprint(status)
 				}
+
+				health := container.Health
+				switch health {
+				case "healthy":
+					health = successColour.Sprint(health)
+				case "starting":
+					health = infoColour.Sprint(health)
+				case "unhealthy":
+					health = errorColour.Sprint(health)
+				case "":
+					health = "-"
+				}
+
+				restarts := fmt.Sprintf("%d", container.RestartCount)
+				if container.CrashLooping {
+					restarts = errorColour.Sprintf("%s (crash looping)", restarts)
+				}
+
 				tw.Append([]string{
 					container.ContainerName,
 					container.ContainerID,
 					status,
+					health,
+					restarts,
 				})
 			}
 			tw.Render()
@@ -39,6 +39,7 @@ func Test_newStatusCmd(t *testing.T) {
 								ContainerName: "a-name-1",
 								ContainerID:   "9a41bb9395f6eb342fdb1a2145560d91fdbf18d40691bcce93a9e6edaaedc1f8",
 								Status:        "running",
+								Health:        "healthy",
 							},
 						},
 					},
@@ -49,11 +50,15 @@ func Test_newStatusCmd(t *testing.T) {
 								ContainerName: "b-name-1",
 								ContainerID:   "8a5f8765250e01ec549a098a6438f3880a19f61e41d48586e73f269d98ceadf3",
 								Status:        "running",
+								RestartCount:  1,
 							},
 							{
 								ContainerName: "b-name-2",
 								ContainerID:   "8315d2b0cf0b8a7a8c1675d0ec1062b7b9d041b7381779e842b7dc157b8eea64",
 								Status:        "dead",
+								Health:        "unhealthy",
+								RestartCount:  7,
+								CrashLooping:  true,
 							},
 						},
 					},
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/krystal/guvnor"
+	"github.com/spf13/cobra"
+)
+
+func newValidateCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate [service]",
+		Short: "Checks the config of services without deploying them",
+		Long: "Checks the config of services without deploying them, " +
+			"reporting every problem found along with its position. " +
+			"Hostnames routed to by more than one process are also reported.",
+		Args:         cobra.RangeArgs(0, 1),
+		SilenceUsage: true,
+	}
+
+	allFlag := cmd.Flags().Bool(
+		"all",
+		false,
+		"Validates every service in the config directory",
+	)
+	fileFlag := cmd.Flags().String(
+		"file",
+		"",
+		"Validates a service config at a path outside of the config directory",
+	)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		targets := len(args)
+		if *allFlag {
+			targets++
+		}
+		if *fileFlag != "" {
+			targets++
+		}
+		if targets > 1 {
+			return errors.New("only one of a service, --all or --file may be given")
+		}
+
+		engine, _, err := eP()
+		if err != nil {
+			return err
+		}
+
+		validateArgs := guvnor.ValidateServiceArgs{
+			File: *fileFlag,
+			All:  *allFlag,
+		}
+		if len(args) == 1 {
+			validateArgs.ServiceName = args[0]
+		} else if targets == 0 {
+			_, err = infoColour.Fprintln(
+				cmd.OutOrStdout(),
+				"⚠️  No service argument provided. Finding default.",
+			)
+			if err != nil {
+				return err
+			}
+			res, err := engine.GetDefaultService()
+			if err != nil {
+				return err
+			}
+			validateArgs.ServiceName = res.Name
+		}
+
+		res, err := engine.ValidateService(cmd.Context(), validateArgs)
+		if err != nil {
+			return err
+		}
+
+		if len(res.Services) == 0 {
+			_, err = infoColour.Fprintln(
+				cmd.OutOrStdout(),
+				"🤷 No services found.",
+			)
+			return err
+		}
+
+		invalid := 0
+		for _, svc := range res.Services {
+			if len(svc.Problems) == 0 {
+				_, err = successColour.Fprintf(
+					cmd.OutOrStdout(),
+					"✅ %s is valid.\n",
+					svc.ServiceName,
+				)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			invalid++
+			_, err = errorColour.Fprintf(
+				cmd.OutOrStdout(),
+				"❌ %s has %d problem(s):\n",
+				svc.ServiceName,
+				len(svc.Problems),
+			)
+			if err != nil {
+				return err
+			}
+			for _, problem := range svc.Problems {
+				_, err = normalColour.Fprintf(
+					cmd.OutOrStdout(), "  %s\n", problem,
+				)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if invalid > 0 {
+			return fmt.Errorf("%d service(s) have invalid config", invalid)
+		}
+
+		return nil
+	}
+
+	return cmd
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/krystal/guvnor"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newValidateCmd(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantArgs  *guvnor.ValidateServiceArgs
+		engineRes *guvnor.ValidateServiceResult
+		engineErr error
+		wantErr   string
+	}{
+		{
+			name:     "valid",
+			args:     []string{"fizz"},
+			wantArgs: &guvnor.ValidateServiceArgs{ServiceName: "fizz"},
+			engineRes: &guvnor.ValidateServiceResult{
+				Services: []guvnor.ServiceValidation{
+					{ServiceName: "fizz", File: "/etc/guvnor/services/fizz.yaml"},
+				},
+			},
+		},
+		{
+			name:     "default service",
+			args:     []string{},
+			wantArgs: &guvnor.ValidateServiceArgs{ServiceName: "default"},
+			engineRes: &guvnor.ValidateServiceResult{
+				Services: []guvnor.ServiceValidation{
+					{ServiceName: "default", File: "/etc/guvnor/services/default.yaml"},
+				},
+			},
+		},
+		{
+			name:     "all",
+			args:     []string{"--all"},
+			wantArgs: &guvnor.ValidateServiceArgs{All: true},
+			engineRes: &guvnor.ValidateServiceResult{
+				Services: []guvnor.ServiceValidation{
+					{
+						ServiceName: "buzz",
+						File:        "/etc/guvnor/services/buzz.yaml",
+						Problems: []guvnor.ValidationProblem{
+							{
+								File:    "/etc/guvnor/services/shared/base.yaml",
+								Line:    3,
+								Column:  3,
+								Message: "field imag not found in type guvnor.ServiceDefaultsConfig",
+							},
+							{
+								File:    "/etc/guvnor/services/buzz.yaml",
+								Message: "process (web) image must be specified when there is no default image",
+							},
+						},
+					},
+					{ServiceName: "fizz", File: "/etc/guvnor/services/fizz.yaml"},
+				},
+			},
+			wantErr: "1 service(s) have invalid config",
+		},
+		{
+			name:     "file",
+			args:     []string{"--file", "/tmp/fizz.yaml"},
+			wantArgs: &guvnor.ValidateServiceArgs{File: "/tmp/fizz.yaml"},
+			engineRes: &guvnor.ValidateServiceResult{
+				Services: []guvnor.ServiceValidation{
+					{ServiceName: "fizz", File: "/tmp/fizz.yaml"},
+				},
+			},
+		},
+		{
+			name:    "service and all",
+			args:    []string{"fizz", "--all"},
+			wantErr: "only one of a service, --all or --file may be given",
+		},
+		{
+			name:      "error",
+			args:      []string{"fizz"},
+			wantArgs:  &guvnor.ValidateServiceArgs{ServiceName: "fizz"},
+			engineErr: errors.New("rats"),
+			wantErr:   "rats",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mEngine := NewMockengine(ctrl)
+
+			ctx := context.Background()
+			provider := func() (engine, *guvnor.EngineConfig, error) {
+				return mEngine, nil, nil
+			}
+
+			if tt.wantArgs != nil {
+				if tt.wantArgs.ServiceName == "default" {
+					mEngine.EXPECT().
+						GetDefaultService().
+						Return(&guvnor.GetDefaultServiceResult{Name: "default"}, nil)
+				}
+				mEngine.EXPECT().
+					ValidateService(ctx, *tt.wantArgs).
+					Return(tt.engineRes, tt.engineErr)
+			}
+
+			cmd := newValidateCmd(provider)
+			stdout := bytes.NewBufferString("")
+			stderr := bytes.NewBufferString("")
+			cmd.SetOut(stdout)
+			cmd.SetErr(stderr)
+			cmd.SetArgs(tt.args)
+
+			err := cmd.ExecuteContext(ctx)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assertGoldenOutput(t, stdout, stderr)
+		})
+	}
+}
+
+func Test_newSchemaCmd(t *testing.T) {
+	cmd := newSchemaCmd()
+	stdout := bytes.NewBufferString("")
+	stderr := bytes.NewBufferString("")
+	cmd.SetOut(stdout)
+	cmd.SetErr(stderr)
+	cmd.SetArgs([]string{})
+
+	assert.NoError(t, cmd.Execute())
+	assertGoldenOutput(t, stdout, stderr)
+}
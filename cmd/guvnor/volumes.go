@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/krystal/guvnor"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+func newVolumesCmd(eP engineProvider) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "volumes [service]",
+		Short: "Lists the volumes managed by Guvnor, optionally for a specific service",
+		Args:  cobra.RangeArgs(0, 1),
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		engine, _, err := eP()
+		if err != nil {
+			return err
+		}
+
+		serviceName := ""
+		if len(args) == 1 {
+			serviceName = args[0]
+		}
+
+		res, err := engine.ListVolumes(
+			cmd.Context(),
+			guvnor.ListVolumesArgs{ServiceName: serviceName},
+		)
+		if err != nil {
+			return err
+		}
+
+		if len(res.Volumes) == 0 {
+			_, err = infoColour.Fprintln(
+				cmd.OutOrStdout(),
+				"🤷 No volumes found.",
+			)
+			return err
+		}
+
+		tw := tablewriter.NewWriter(colorWriter{cmd.OutOrStdout(), tableColour})
+		tw.SetHeader([]string{"Service", "Volume", "Name", "Driver", "Created"})
+		tw.SetBorder(false)
+		tw.SetRowLine(false)
+		tw.SetHeaderLine(false)
+		tw.SetColumnSeparator("")
+		tw.SetAutoWrapText(false)
+		for _, volume := range res.Volumes {
+			tw.Append([]string{
+				volume.Service,
+				volume.Volume,
+				volume.Name,
+				volume.Driver,
+				volume.CreatedAt,
+			})
+		}
+		tw.Render()
+
+		return nil
+	}
+
+	return cmd
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/jimeh/go-golden"
+	"github.com/krystal/guvnor"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newVolumesCmd(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantArgs  guvnor.ListVolumesArgs
+		engineRes *guvnor.ListVolumesResult
+		engineErr error
+		wantErr   string
+	}{
+		{
+			name:     "all services",
+			args:     []string{},
+			wantArgs: guvnor.ListVolumesArgs{},
+			engineRes: &guvnor.ListVolumesResult{
+				Volumes: []guvnor.VolumeInfo{
+					{
+						Name:      "guvnor-buzz_cache",
+						Service:   "buzz",
+						Volume:    "cache",
+						Driver:    "local",
+						CreatedAt: "2022-03-01T12:00:00Z",
+					},
+					{
+						Name:      "guvnor-fizz_data",
+						Service:   "fizz",
+						Volume:    "data",
+						Driver:    "local",
+						CreatedAt: "2022-03-02T12:00:00Z",
+					},
+				},
+			},
+		},
+		{
+			name: "single service",
+			args: []string{"fizz"},
+			wantArgs: guvnor.ListVolumesArgs{
+				ServiceName: "fizz",
+			},
+			engineRes: &guvnor.ListVolumesResult{
+				Volumes: []guvnor.VolumeInfo{
+					{
+						Name:      "guvnor-fizz_data",
+						Service:   "fizz",
+						Volume:    "data",
+						Driver:    "local",
+						CreatedAt: "2022-03-02T12:00:00Z",
+					},
+				},
+			},
+		},
+		{
+			name:      "no volumes",
+			args:      []string{},
+			wantArgs:  guvnor.ListVolumesArgs{},
+			engineRes: &guvnor.ListVolumesResult{Volumes: []guvnor.VolumeInfo{}},
+		},
+		{
+			name:      "error",
+			args:      []string{"oops"},
+			wantArgs:  guvnor.ListVolumesArgs{ServiceName: "oops"},
+			engineErr: errors.New("rats"),
+			wantErr:   "rats",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mEngine := NewMockengine(ctrl)
+
+			ctx := context.Background()
+			provider := func() (engine, *guvnor.EngineConfig, error) {
+				return mEngine, nil, nil
+			}
+
+			mEngine.EXPECT().
+				ListVolumes(ctx, tt.wantArgs).
+				Return(tt.engineRes, tt.engineErr)
+
+			cmd := newVolumesCmd(provider)
+			stdout := bytes.NewBufferString("")
+			stderr := bytes.NewBufferString("")
+			cmd.SetOut(stdout)
+			cmd.SetErr(stderr)
+			cmd.SetArgs(tt.args)
+
+			err := cmd.ExecuteContext(ctx)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if golden.Update() {
+				golden.SetP(t, "stdout", stdout.Bytes())
+				golden.SetP(t, "stderr", stderr.Bytes())
+			}
+			assert.Equal(t, golden.GetP(t, "stdout"), stdout.Bytes())
+			assert.Equal(t, golden.GetP(t, "stderr"), stderr.Bytes())
+		})
+	}
+}
@@ -2,6 +2,7 @@ package guvnor
 
 import (
 	"bytes"
+	"fmt"
 	"os"
 
 	"github.com/go-playground/validator/v10"
@@ -12,6 +13,19 @@ import (
 type EngineConfig struct {
 	Caddy caddy.Config `yaml:"caddy"`
 	Paths PathsConfig  `yaml:"paths"`
+	State StateConfig  `yaml:"state"`
+	Ports PortsConfig  `yaml:"ports"`
+	// Defaults are shared by every service, and are merged beneath the
+	// defaults of each service config.
+	Defaults ServiceDefaultsConfig `yaml:"defaults,omitempty"`
+	// defaultsNode holds the defaults as they were written, so that only the
+	// values that have been set are merged into service configs.
+	defaultsNode *yaml.Node
+	// path is the file the config was loaded from, if any.
+	path string
+	// Vars are values that can be used in service configs with
+	// ${vars.NAME}, e.g a domain shared by several services.
+	Vars map[string]string `yaml:"vars,omitempty"`
 }
 
 type PathsConfig struct {
@@ -19,6 +33,81 @@ type PathsConfig struct {
 	Config string `yaml:"config" validate:"required"`
 	// State is the path to store state about deployments etc
 	State string `yaml:"state" validate:"required"`
+	// Secrets is the path to the directory that secrets referenced by
+	// services are read from, defaulting to /etc/guvnor/secrets. It must only
+	// be accessible by its owner.
+	Secrets string `yaml:"secrets"`
+	// SecretsKey is the path to the key used to encrypt secrets set with
+	// guvnor secrets, defaulting to /etc/guvnor/secrets.key. It is generated
+	// when the first secret is set.
+	SecretsKey string `yaml:"secretsKey"`
+}
+
+func (pc PathsConfig) GetSecrets() string {
+	if pc.Secrets == "" {
+		return "/etc/guvnor/secrets"
+	}
+
+	return pc.Secrets
+}
+
+func (pc PathsConfig) GetSecretsKey() string {
+	if pc.SecretsKey == "" {
+		return "/etc/guvnor/secrets.key"
+	}
+
+	return pc.SecretsKey
+}
+
+const (
+	// StateBackendFile stores the state of each service in a JSON file within
+	// the state directory.
+	StateBackendFile = "file"
+	// StateBackendBolt stores all state in a single bbolt database within the
+	// state directory.
+	StateBackendBolt = "bolt"
+)
+
+type StateConfig struct {
+	// Backend selects how state is stored, defaulting to StateBackendFile.
+	Backend string `yaml:"backend" validate:"omitempty,oneof=file bolt"`
+}
+
+const (
+	defaultPortsMin = 20000
+	defaultPortsMax = 29999
+)
+
+// PortsConfig is the range of host ports that guvnor allocates to process
+// containers from. It should not overlap with the ephemeral port range of the
+// host, or ports used by anything else on the host.
+type PortsConfig struct {
+	// Min is the lowest port that may be allocated, defaulting to 20000.
+	Min int `yaml:"min" validate:"omitempty,gte=1024,lte=65535"`
+	// Max is the highest port that may be allocated, defaulting to 29999.
+	Max int `yaml:"max" validate:"omitempty,gte=1024,lte=65535"`
+}
+
+// GetRange returns the lowest and highest port that may be allocated.
+func (pc PortsConfig) GetRange() (int, int) {
+	min, max := pc.Min, pc.Max
+	if min == 0 {
+		min = defaultPortsMin
+	}
+	if max == 0 {
+		max = defaultPortsMax
+	}
+
+	return min, max
+}
+
+func (pc PortsConfig) Validate() error {
+	min, max := pc.GetRange()
+	if min > max {
+		return fmt.Errorf("ports min (%d) must not exceed max (%d)", min, max)
+	}
+
+	return nil
 }
 
 func LoadConfig(validate *validator.Validate, pathOverride string) (*EngineConfig, error) {
@@ -35,14 +124,27 @@ func LoadConfig(validate *validator.Validate, pathOverride string) (*EngineConfi
 	decoder := yaml.NewDecoder(bytes.NewBuffer(data))
 	decoder.KnownFields(true)
 
-	cfg := &EngineConfig{}
+	cfg := &EngineConfig{path: path}
 	if err := decoder.Decode(cfg); err != nil {
 		return nil, err
 	}
 
+	raw := struct {
+		Defaults yaml.Node `yaml:"defaults"`
+	}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw.Defaults.Kind != 0 {
+		cfg.defaultsNode = &raw.Defaults
+	}
+
 	if err := validate.Struct(cfg); err != nil {
 		return nil, err
 	}
+	if err := cfg.Ports.Validate(); err != nil {
+		return nil, err
+	}
 
 	return cfg, nil
 }
@@ -16,12 +16,30 @@ var (
 )
 
 func (e *Engine) GetDefaultService() (*GetDefaultServiceResult, error) {
+	serviceNames, err := e.listServiceNames()
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(serviceNames) {
+	case 0:
+		return nil, ErrNoService
+	case 1:
+		return &GetDefaultServiceResult{Name: serviceNames[0]}, nil
+	default:
+		return nil, ErrMultipleServices
+	}
+}
+
+// listServiceNames returns the names of the services with a config in the
+// config directory, in alphabetical order.
+func (e *Engine) listServiceNames() ([]string, error) {
 	entries, err := os.ReadDir(e.config.Paths.Config)
 	if err != nil {
 		return nil, err
 	}
 
-	serviceName := ""
+	serviceNames := []string{}
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
@@ -32,16 +50,8 @@ func (e *Engine) GetDefaultService() (*GetDefaultServiceResult, error) {
 			continue
 		}
 
-		if serviceName != "" {
-			return nil, ErrMultipleServices
-		}
-
-		serviceName = strings.TrimSuffix(entry.Name(), ".yaml")
-	}
-
-	if serviceName == "" {
-		return nil, ErrNoService
+		serviceNames = append(serviceNames, strings.TrimSuffix(entry.Name(), ".yaml"))
 	}
 
-	return &GetDefaultServiceResult{Name: serviceName}, nil
+	return serviceNames, nil
 }
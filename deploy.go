@@ -3,8 +3,7 @@ package guvnor
 import (
 	"context"
 	"fmt"
-	"net"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -18,12 +17,16 @@ import (
 
 type DeployArgs struct {
 	ServiceName string
-	Tag         string
+	// Tag overrides the default image tag configured for the service.
+	Tag  string
+	Lock LockOptions
 }
 
 type DeployResult struct {
 	ServiceName  string
 	DeploymentID int
+	// Tag is the default image tag that was deployed.
+	Tag string
 }
 
 func containerFullName(
@@ -41,7 +44,9 @@ func containerFullName(
 	)
 }
 
-func mergeEnv(toMerge ...map[string]string) []string {
+// mergeEnvMap merges the provided maps, with values from later maps taking
+// precedence.
+func mergeEnvMap(toMerge ...map[string]string) map[string]string {
 	outMap := map[string]string{}
 	for _, mp := range toMerge {
 		for k, v := range mp {
@@ -49,6 +54,12 @@ func mergeEnv(toMerge ...map[string]string) []string {
 		}
 	}
 
+	return outMap
+}
+
+func mergeEnv(toMerge ...map[string]string) []string {
+	outMap := mergeEnvMap(toMerge...)
+
 	outSlice := make([]string, 0, len(outMap))
 	for k, v := range outMap {
 		outSlice = append(outSlice, fmt.Sprintf("%s=%s", k, v))
@@ -57,34 +68,38 @@ func mergeEnv(toMerge ...map[string]string) []string {
 	return outSlice
 }
 
+// mergeMounts merges two lists of mounts. Mounts in b replace any mount in a
+// with the same container path.
 func mergeMounts(a, b []ServiceMountConfig) []ServiceMountConfig {
 	out := make([]ServiceMountConfig, 0, len(a)+len(b))
 	out = append(out, a...)
-	out = append(out, b...)
 
-	return out
-}
+	for _, mnt := range b {
+		replaced := false
+		for i := range out {
+			if out[i].Container == mnt.Container {
+				out[i] = mnt
+				replaced = true
+				break
+			}
+		}
 
-// findFreePort is pretty hacky way of finding ports but avoids storing state
-// for now. We may want to replace this in future.
-func findFreePort() (string, error) {
-	a, err := net.ResolveTCPAddr("tcp", "localhost:0")
-	if err != nil {
-		return "", err
+		if !replaced {
+			out = append(out, mnt)
+		}
 	}
 
-	l, err := net.ListenTCP("tcp", a)
-	if err != nil {
-		return "", err
-	}
-	defer l.Close()
+	return out
+}
 
-	lAddr := l.Addr().(*net.TCPAddr)
-	return strconv.Itoa(lAddr.Port), nil
+// caddyBackendName returns the name of the route group used in Caddy for a
+// process.
+func caddyBackendName(svcName, processName string) string {
+	return fmt.Sprintf("%s-%s", svcName, processName)
 }
 
 func (e *Engine) updateLoadbalancerForDeployment(ctx context.Context, svcName string, process *ServiceProcessConfig, containers []deployedProcessContainer) error {
-	caddyBackendName := fmt.Sprintf("%s-%s", svcName, process.name)
+	caddyBackendName := caddyBackendName(svcName, process.name)
 	upstreams := []string{}
 	for _, container := range containers {
 		if container.Port != "" {
@@ -99,7 +114,9 @@ func (e *Engine) updateLoadbalancerForDeployment(ctx context.Context, svcName st
 	)
 }
 
-func (e *Engine) getLastDeploymentContainers(ctx context.Context, svc, process string, deploymentID int) (deployedContainerList, error) {
+// getLastDeploymentContainers returns the running containers of a process that
+// belong to the specified previous deployment.
+func (e *Engine) getLastDeploymentContainers(ctx context.Context, svc, process string, previousDeploymentID int) (deployedContainerList, error) {
 	dockerContainers, err := e.docker.ContainerList(ctx, types.ContainerListOptions{
 		Filters: filters.NewArgs(
 			filters.Arg(
@@ -112,7 +129,7 @@ func (e *Engine) getLastDeploymentContainers(ctx context.Context, svc, process s
 			),
 			filters.Arg(
 				"label",
-				fmt.Sprintf("%s=%d", deploymentLabel, deploymentID-1),
+				fmt.Sprintf("%s=%d", deploymentLabel, previousDeploymentID),
 			),
 		),
 	})
@@ -132,28 +149,63 @@ func (e *Engine) getLastDeploymentContainers(ctx context.Context, svc, process s
 	return deployedContainers, nil
 }
 
-func (e *Engine) startContainerForProcess(ctx context.Context, i int, svc *ServiceConfig, process *ServiceProcessConfig, deploymentID int, image string) (*deployedProcessContainer, error) {
+func (e *Engine) startContainerForProcess(ctx context.Context, i int, svc *ServiceConfig, process *ServiceProcessConfig, deploymentID int, image string) (_ *deployedProcessContainer, err error) {
 	fullName := containerFullName(svc.Name, deploymentID, process.name, i)
-	selectedPort, err := findFreePort()
+	allocatePort := func() (string, error) {
+		return e.allocatePort(svc.Name, fullName)
+	}
+	// Ports are held by the container once it has been created, so are only
+	// released here if it never comes into existence.
+	created := false
+	defer func() {
+		if err != nil && !created {
+			e.releasePorts(svc.Name, fullName)
+		}
+	}()
+
+	selectedPort, err := allocatePort()
 	if err != nil {
 		return nil, err
 	}
 
-	// Merge default, process and guvnor provided environment
-	env := mergeEnv(
-		svc.Defaults.Env,
-		process.Env,
-		map[string]string{
-			"PORT":              selectedPort,
-			"GUVNOR_SERVICE":    svc.Name,
-			"GUVNOR_PROCESS":    process.name,
-			"GUVNOR_DEPLOYMENT": fmt.Sprintf("%d", deploymentID),
-		},
+	networkMode := process.GetNetworkMode()
+	ports, err := resolvePorts(
+		process.Ports, networkMode == NetworkModeHost, allocatePort,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	guvnorEnv := map[string]string{
+		"PORT":              selectedPort,
+		"GUVNOR_SERVICE":    svc.Name,
+		"GUVNOR_PROCESS":    process.name,
+		"GUVNOR_DEPLOYMENT": fmt.Sprintf("%d", deploymentID),
+	}
+	for _, port := range ports {
+		guvnorEnv[port.config.envName()] = port.containerPort
+	}
+
+	late := map[string]string{
+		templateDeployment: fmt.Sprintf("%d", deploymentID),
+		templateReplica:    fmt.Sprintf("%d", i),
+	}
+	configuredEnv, err := e.resolveEnv(
+		svc.Name, late, svc.Defaults.envLayer(), process.envLayer(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	command, err := expandLateList(process.Command, late)
+	if err != nil {
+		return nil, fmt.Errorf("command: %w", err)
+	}
+	// Merge configured and guvnor provided environment
+	env := mergeEnv(configuredEnv, guvnorEnv)
 
 	portProtocolBinding := selectedPort + "/tcp"
 	containerConfig := &container.Config{
-		Cmd:   process.Command,
+		Cmd:   command,
 		Image: image,
 		Env:   env,
 		Labels: map[string]string{
@@ -166,15 +218,23 @@ func (e *Engine) startContainerForProcess(ctx context.Context, i int, svc *Servi
 		ExposedPorts: nat.PortSet{},
 		User:         process.GetUser(),
 	}
-	hostConfig := &container.HostConfig{
-		PortBindings: nat.PortMap{},
-		RestartPolicy: container.RestartPolicy{
-			Name: "always",
-		},
-		Mounts:     process.GetMounts(),
-		Privileged: process.Privileged,
+	if process.HealthCheck != nil {
+		containerConfig.Healthcheck = process.HealthCheck.dockerConfig()
 	}
-	if process.GetNetworkMode() == NetworkModeHost {
+	resources, err := process.GetResources().dockerResources()
+	if err != nil {
+		return nil, err
+	}
+	hostConfig := &container.HostConfig{
+		PortBindings:  nat.PortMap{},
+		RestartPolicy: process.GetRestartPolicy(),
+		Mounts:        process.GetMounts(),
+		Privileged:    process.Privileged,
+		Resources:     resources,
+	}
+	process.GetSecurity().applyTo(hostConfig)
+	networkingConfig := &network.NetworkingConfig{}
+	if networkMode == NetworkModeHost {
 		hostConfig.NetworkMode = "host"
 	} else {
 		natPort := nat.Port(portProtocolBinding)
@@ -186,11 +246,30 @@ func (e *Engine) startContainerForProcess(ctx context.Context, i int, svc *Servi
 		}
 		containerConfig.ExposedPorts[natPort] = struct{}{}
 
+		for _, port := range ports {
+			natPort := port.natPort()
+			hostConfig.PortBindings[natPort] = append(
+				hostConfig.PortBindings[natPort],
+				nat.PortBinding{
+					HostPort: port.hostPort,
+					HostIP:   port.config.GetHostIP(),
+				},
+			)
+			containerConfig.ExposedPorts[natPort] = struct{}{}
+		}
+
 		hostConfig.ExtraHosts = append(hostConfig.ExtraHosts,
 			// host-gateway is a special argument that tells docker to insert
 			// the IP of the host's gateway on the container network.
 			"host.docker.internal:host-gateway",
 		)
+
+		if networkMode == NetworkModeService {
+			hostConfig.NetworkMode = container.NetworkMode(
+				managedNetworkName(svc.Name),
+			)
+			networkingConfig = serviceNetworkingConfig(svc.Name, process.name)
+		}
 	}
 
 	e.log.Debug("starting new process container",
@@ -202,13 +281,14 @@ func (e *Engine) startContainerForProcess(ctx context.Context, i int, svc *Servi
 		ctx,
 		containerConfig,
 		hostConfig,
-		&network.NetworkingConfig{},
+		networkingConfig,
 		nil,
 		fullName,
 	)
 	if err != nil {
 		return nil, err
 	}
+	created = true
 
 	err = e.docker.ContainerStart(
 		ctx, res.ID, types.ContainerStartOptions{},
@@ -229,6 +309,107 @@ func (e *Engine) startContainerForProcess(ctx context.Context, i int, svc *Servi
 	}, nil
 }
 
+// waitForContainerReady blocks until the ready check of a process passes for
+// a newly started container. Processes without a ready check are considered
+// ready immediately.
+func (e *Engine) waitForContainerReady(
+	ctx context.Context,
+	process *ServiceProcessConfig,
+	container *deployedProcessContainer,
+) error {
+	check := process.ReadyCheck
+	if check == nil {
+		if process.HealthCheck != nil {
+			return e.waitForContainerHealthy(ctx, container)
+		}
+
+		return nil
+	}
+
+	// Point the check at the container that has just been started
+	if check.HTTP != nil {
+		check.HTTP.Host = "localhost:" + container.Port
+	}
+	if check.TCP != nil {
+		check.TCP.Host = "localhost:" + container.Port
+	}
+	if check.Exec != nil {
+		check.Exec.ContainerID = container.ID
+		check.Exec.Execer = &dockerExecer{docker: e.docker}
+	}
+
+	return check.Wait(ctx, e.log.Named("ready"))
+}
+
+// healthPollInterval is how often the health of a container is inspected when
+// waiting for it to become healthy.
+var healthPollInterval = time.Second
+
+// waitForContainerHealthy blocks until Docker reports a container as healthy,
+// failing if it becomes unhealthy or stops running.
+func (e *Engine) waitForContainerHealthy(
+	ctx context.Context, container *deployedProcessContainer,
+) error {
+	e.log.Debug("waiting for container to become healthy",
+		zap.String("container", container.Name),
+	)
+	for {
+		inspect, err := e.docker.ContainerInspect(ctx, container.ID)
+		if err != nil {
+			return err
+		}
+
+		if !inspect.State.Running {
+			return fmt.Errorf(
+				"container %s stopped before becoming healthy (status: %s)",
+				container.Name,
+				inspect.State.Status,
+			)
+		}
+
+		switch containerHealth(inspect) {
+		case types.Healthy:
+			e.log.Debug("container is healthy",
+				zap.String("container", container.Name),
+			)
+			return nil
+		case types.Unhealthy:
+			return fmt.Errorf(
+				"container %s is unhealthy: %s",
+				container.Name,
+				lastHealthOutput(inspect),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(healthPollInterval):
+		}
+	}
+}
+
+// containerHealth returns the health status reported by Docker for a
+// container, or an empty string if it has no healthcheck.
+func containerHealth(inspect types.ContainerJSON) string {
+	if inspect.ContainerJSONBase == nil || inspect.State == nil || inspect.State.Health == nil {
+		return ""
+	}
+
+	return inspect.State.Health.Status
+}
+
+// lastHealthOutput returns the trimmed output of the most recent healthcheck
+// of a container.
+func lastHealthOutput(inspect types.ContainerJSON) string {
+	if containerHealth(inspect) == "" || len(inspect.State.Health.Log) == 0 {
+		return ""
+	}
+
+	log := inspect.State.Health.Log
+	return strings.TrimSpace(log[len(log)-1].Output)
+}
+
 type deployedProcessContainer struct {
 	ID   string
 	Name string
@@ -269,15 +450,8 @@ func (e *Engine) deployServiceProcessDefaultStrategy(
 	*newDeploymentContainers = append(*newDeploymentContainers, *container)
 
 	// Ensure new container is ready
-	if process.ReadyCheck != nil {
-		if process.ReadyCheck.HTTP != nil {
-			process.ReadyCheck.HTTP.Host = "localhost:" + container.Port
-		}
-		if err := process.ReadyCheck.Wait(
-			ctx, e.log.Named("ready"),
-		); err != nil {
-			return err
-		}
+	if err := e.waitForContainerReady(ctx, process, container); err != nil {
+		return err
 	}
 
 	containerToReplace := lastDeploymentContainers.pop()
@@ -374,15 +548,8 @@ func (e *Engine) deployServiceProcessReplaceStrategy(
 	*newDeploymentContainers = append(*newDeploymentContainers, *container)
 
 	// Ensure new container is ready
-	if process.ReadyCheck != nil {
-		if process.ReadyCheck.HTTP != nil {
-			process.ReadyCheck.HTTP.Host = "localhost:" + container.Port
-		}
-		if err := process.ReadyCheck.Wait(
-			ctx, e.log.Named("ready"),
-		); err != nil {
-			return err
-		}
+	if err := e.waitForContainerReady(ctx, process, container); err != nil {
+		return err
 	}
 
 	// Add new healthy container to load balancer
@@ -423,9 +590,9 @@ func (e *Engine) deployServiceProcess(
 	var err error
 	lastDeploymentContainers := deployedContainerList{}
 	newDeploymentContainers := deployedContainerList{}
-	if svcState.DeploymentID > 1 {
+	if svcState.ActiveDeploymentID > 0 {
 		lastDeploymentContainers, err = e.getLastDeploymentContainers(
-			ctx, svc.Name, process.name, deploymentID,
+			ctx, svc.Name, process.name, svcState.ActiveDeploymentID,
 		)
 		if err != nil {
 			return err
@@ -524,6 +691,91 @@ func (e *Engine) deployServiceProcess(
 	return nil
 }
 
+// removeDeletedProcesses drains and stops the containers of any process that
+// is no longer present in the service config, and removes its routes from the
+// load balancer.
+func (e *Engine) removeDeletedProcesses(
+	ctx context.Context, svc *ServiceConfig, svcState *state.ServiceState,
+) error {
+	containers, err := e.docker.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", fmt.Sprintf("%s=%s", serviceLabel, svc.Name)),
+			filters.Arg("label", processLabel),
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	deletedProcesses := map[string]deployedContainerList{}
+	for _, container := range containers {
+		processName := container.Labels[processLabel]
+		if _, ok := svc.Processes[processName]; ok {
+			continue
+		}
+
+		deletedProcesses[processName] = append(
+			deletedProcesses[processName],
+			deployedProcessContainer{
+				ID:   container.ID,
+				Name: container.Names[0],
+			},
+		)
+	}
+
+	// The previous deployment's config lets us clear out routes for deleted
+	// processes that have no running containers, and tells us how long to
+	// wait for the containers that remain to shut down.
+	previousProcesses := map[string]ServiceProcessConfig{}
+	if svcState.ActiveDeploymentID > 0 {
+		previousSvc, err := e.loadDeploymentConfig(svc.Name, svcState.ActiveDeploymentID)
+		if err != nil {
+			e.log.Debug("could not load config of previous deployment",
+				zap.String("service", svc.Name),
+				zap.Error(err),
+			)
+		} else {
+			previousProcesses = previousSvc.Processes
+		}
+	}
+	for processName := range previousProcesses {
+		if _, ok := svc.Processes[processName]; ok {
+			continue
+		}
+		if _, ok := deletedProcesses[processName]; !ok {
+			deletedProcesses[processName] = deployedContainerList{}
+		}
+	}
+
+	for processName, containers := range deletedProcesses {
+		e.log.Info("removing process deleted from service config",
+			zap.String("process", processName),
+			zap.String("service", svc.Name),
+		)
+		err := e.caddy.DeleteBackend(ctx, caddyBackendName(svc.Name, processName))
+		if err != nil {
+			return err
+		}
+
+		previousProcess := previousProcesses[processName]
+		gracePeriod := previousProcess.GetShutdownGracePeriod()
+		for _, container := range containers {
+			e.log.Debug("stopping container of deleted process",
+				zap.String("process", processName),
+				zap.String("service", svc.Name),
+				zap.String("container", container.Name),
+				zap.Duration("gracePeriod", gracePeriod),
+			)
+			err := e.docker.ContainerStop(ctx, container.ID, &gracePeriod)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func (e *Engine) runCallbacks(
 	ctx context.Context,
 	svc *ServiceConfig,
@@ -554,7 +806,7 @@ func (e *Engine) runCallbacks(
 		e.log.Info("running callback task",
 			zap.String("task", taskName),
 		)
-		err := e.runTask(ctx, &task, svc, injectEnv)
+		err := e.runTask(ctx, &task, svc, deploymentID, injectEnv)
 		if err != nil {
 			return err
 		}
@@ -564,28 +816,90 @@ func (e *Engine) runCallbacks(
 }
 
 func (e *Engine) Deploy(ctx context.Context, args DeployArgs) (*DeployResult, error) {
-	// Load config & state
 	svc, err := e.loadServiceConfig(args.ServiceName)
 	if err != nil {
 		return nil, err
 	}
 
+	if args.Tag != "" {
+		if err := svc.overrideImageTag(args.Tag); err != nil {
+			return nil, err
+		}
+	}
+
+	lock, err := e.lockService(ctx, svc.Name, args.Lock)
+	if err != nil {
+		return nil, err
+	}
+	defer e.unlockService(svc.Name, lock)
+
+	return e.deploy(ctx, svc, 0)
+}
+
+// deploy rolls out the provided service configuration as a new deployment.
+// rollbackOf should be set to the ID of the deployment being restored when
+// the deployment is a rollback. The caller must hold the lock of the service.
+func (e *Engine) deploy(ctx context.Context, svc *ServiceConfig, rollbackOf int) (*DeployResult, error) {
 	svcState, err := e.state.LoadServiceState(svc.Name)
 	if err != nil {
 		return nil, err
 	}
 
+	// Snapshot the config and images so the deployment can be repeated
+	snapshot, err := svc.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	images := map[string]string{}
+	for processName, process := range svc.Processes {
+		image, _, err := process.GetImage()
+		if err != nil {
+			return nil, err
+		}
+		images[processName] = image
+	}
+
 	// Prepare state with values we will want to persist
 	svcState.DeploymentID += 1
 	svcState.LastDeployedAt = time.Now()
+	svcState.Tag = svc.Defaults.ImageTag
 	// Default to failure, we will set to success if we make it to the end.
 	svcState.DeploymentStatus = state.StatusFailure
+	deployment := &state.Deployment{
+		ID:          svcState.DeploymentID,
+		StartedAt:   svcState.LastDeployedAt,
+		TriggeredBy: triggeringUser(),
+		Tag:         svcState.Tag,
+		Images:      images,
+		Config:      string(snapshot),
+		RollbackOf:  rollbackOf,
+	}
 	defer func() {
+		if svcState.DeploymentStatus != state.StatusRolledBack {
+			svcState.ActiveDeploymentID = svcState.DeploymentID
+		}
+		deployment.Status = svcState.DeploymentStatus
+		deployment.FinishedAt = time.Now()
+		if err := e.state.SaveDeployment(svc.Name, deployment); err != nil {
+			e.log.Error("failed to persist deployment history", zap.Error(err))
+		}
 		if err := e.state.SaveServiceState(svc.Name, svcState); err != nil {
 			e.log.Error("failed to persist service state", zap.Error(err))
 		}
 	}()
 
+	if err := e.checkPortConflicts(ctx, svc); err != nil {
+		return nil, err
+	}
+
+	if err := e.ensureVolumes(ctx, svc); err != nil {
+		return nil, err
+	}
+
+	if err := e.ensureNetwork(ctx, svc); err != nil {
+		return nil, err
+	}
+
 	if err := e.runCallbacks(ctx, svc, true, svcState.DeploymentID); err != nil {
 		return nil, err
 	}
@@ -598,7 +912,23 @@ func (e *Engine) Deploy(ctx context.Context, args DeployArgs) (*DeployResult, er
 	for _, process := range svc.Processes {
 		err = e.deployServiceProcess(ctx, svc, svcState, &process)
 		if err != nil {
-			return nil, err
+			if !svc.RollbackOnFailure {
+				return nil, err
+			}
+
+			e.log.Warn("deployment failed, rolling back",
+				zap.String("service", svc.Name),
+				zap.Error(err),
+			)
+			if rollbackErr := e.rollbackFailedDeployment(ctx, svc, svcState); rollbackErr != nil {
+				return nil, fmt.Errorf(
+					"deployment failed: %w (rollback also failed: %s)",
+					err, rollbackErr,
+				)
+			}
+			svcState.DeploymentStatus = state.StatusRolledBack
+
+			return nil, fmt.Errorf("deployment failed and was rolled back: %w", err)
 		}
 	}
 
@@ -606,12 +936,14 @@ func (e *Engine) Deploy(ctx context.Context, args DeployArgs) (*DeployResult, er
 		return nil, err
 	}
 
-	// TODO: Tidy up any processes/containers that may have been removed from
-	// the spec.
+	if err := e.removeDeletedProcesses(ctx, svc, svcState); err != nil {
+		return nil, err
+	}
 
 	svcState.DeploymentStatus = state.StatusSuccess
 	return &DeployResult{
 		ServiceName:  svc.Name,
 		DeploymentID: svcState.DeploymentID,
+		Tag:          svcState.Tag,
 	}, nil
 }
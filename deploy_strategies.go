@@ -2,6 +2,8 @@ package guvnor
 
 import (
 	"fmt"
+
+	"gopkg.in/yaml.v3"
 )
 
 type DeploymentStrategy int
@@ -47,17 +49,20 @@ func (s DeploymentStrategy) MarshalYAML() (interface{}, error) {
 	return s.String(), nil
 }
 
-func (s *DeploymentStrategy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+func (s *DeploymentStrategy) UnmarshalYAML(value *yaml.Node) error {
 	stringValue := ""
-	if err := unmarshal(&stringValue); err != nil {
+	if err := value.Decode(&stringValue); err != nil {
 		return err
 	}
 
 	strategy, ok := stringToStrategy[stringValue]
 	if !ok {
-		return fmt.Errorf(
-			"deployment strategy '%s' not recognised", stringValue,
-		)
+		// Returned as a TypeError so it is reported with its line, alongside
+		// any other invalid values.
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf(
+			"line %d: deployment strategy '%s' not recognised",
+			value.Line, stringValue,
+		)}}
 	}
 	*s = strategy
 
@@ -82,7 +82,7 @@ func TestDeploymentStrategy_UnmarshalYAML(t *testing.T) {
 			name:    "unknown type",
 			data:    "deploymentStrategy: buzzcock\n",
 			want:    testStruct{},
-			wantErr: "deployment strategy 'buzzcock' not recognised",
+			wantErr: "yaml: unmarshal errors:\n  line 1: deployment strategy 'buzzcock' not recognised",
 		},
 	}
 
@@ -3,6 +3,7 @@ package guvnor
 import (
 	"testing"
 
+	"github.com/docker/docker/api/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -111,6 +112,39 @@ func Test_mergeMounts(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "b overrides a by container path",
+			a: []ServiceMountConfig{
+				{
+					Host:      "/path/on/host/a",
+					Container: "/path/on/container",
+				},
+				{
+					Host:      "/path/on/host/other",
+					Container: "/path/on/container/other",
+				},
+			},
+			b: []ServiceMountConfig{
+				{
+					Type:      MountTypeVolume,
+					Volume:    "data",
+					Container: "/path/on/container",
+					ReadOnly:  true,
+				},
+			},
+			want: []ServiceMountConfig{
+				{
+					Type:      MountTypeVolume,
+					Volume:    "data",
+					Container: "/path/on/container",
+					ReadOnly:  true,
+				},
+				{
+					Host:      "/path/on/host/other",
+					Container: "/path/on/container/other",
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -138,3 +172,50 @@ func Test_deployedContainerList_Pop(t *testing.T) {
 	container = list.pop()
 	assert.Nil(t, container)
 }
+
+func Test_containerHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		inspect    types.ContainerJSON
+		want       string
+		wantOutput string
+	}{
+		{
+			name:    "no state",
+			inspect: types.ContainerJSON{},
+		},
+		{
+			name: "no healthcheck",
+			inspect: types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{
+					State: &types.ContainerState{Status: "running"},
+				},
+			},
+		},
+		{
+			name: "unhealthy",
+			inspect: types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{
+					State: &types.ContainerState{
+						Health: &types.Health{
+							Status: types.Unhealthy,
+							Log: []*types.HealthcheckResult{
+								{ExitCode: 1, Output: "first\n"},
+								{ExitCode: 1, Output: "connection refused\n"},
+							},
+						},
+					},
+				},
+			},
+			want:       types.Unhealthy,
+			wantOutput: "connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, containerHealth(tt.inspect))
+			assert.Equal(t, tt.wantOutput, lastHealthOutput(tt.inspect))
+		})
+	}
+}
@@ -10,9 +10,11 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
 	"github.com/docker/docker/registry"
 	"go.uber.org/zap"
 )
@@ -135,3 +137,64 @@ func (e *Engine) pullImage(ctx context.Context, image string) error {
 
 	return nil
 }
+
+// dockerExecer runs commands inside containers using the Docker exec API. It
+// is used by exec ready checks.
+type dockerExecer struct {
+	docker client.APIClient
+}
+
+func (de *dockerExecer) Exec(
+	ctx context.Context, containerID string, cmd []string,
+) (int, error) {
+	exec, err := de.docker.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	attach, err := de.docker.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return 0, err
+	}
+	defer attach.Close()
+
+	// The hijacked connection does not respect the context, so close it to
+	// unblock reading if the context is cancelled.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			attach.Close()
+		case <-done:
+		}
+	}()
+
+	// Wait for the command to finish by draining its output
+	if _, err := io.Copy(io.Discard, attach.Reader); err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, err
+	}
+
+	for {
+		inspect, err := de.docker.ContainerExecInspect(ctx, exec.ID)
+		if err != nil {
+			return 0, err
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
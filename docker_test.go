@@ -1,12 +1,86 @@
 package guvnor
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/docker/docker/api/types"
+	volumetypes "github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/stretchr/testify/assert"
 )
 
+// fakeDockerClient implements the parts of the Docker API used by tests,
+// panicking if any other method is called.
+type fakeDockerClient struct {
+	client.APIClient
+
+	containers []types.Container
+	volumes    map[string]types.Volume
+	networks   map[string]types.NetworkResource
+}
+
+func (f *fakeDockerClient) ContainerList(
+	_ context.Context, _ types.ContainerListOptions,
+) ([]types.Container, error) {
+	return f.containers, nil
+}
+
+func (f *fakeDockerClient) NetworkInspect(
+	_ context.Context, name string, _ types.NetworkInspectOptions,
+) (types.NetworkResource, error) {
+	resource, ok := f.networks[name]
+	if !ok {
+		return types.NetworkResource{}, errdefs.NotFound(errors.New("no such network"))
+	}
+
+	return resource, nil
+}
+
+func (f *fakeDockerClient) NetworkCreate(
+	_ context.Context, name string, options types.NetworkCreate,
+) (types.NetworkCreateResponse, error) {
+	if f.networks == nil {
+		f.networks = map[string]types.NetworkResource{}
+	}
+	f.networks[name] = types.NetworkResource{
+		Name:   name,
+		Driver: options.Driver,
+		Labels: options.Labels,
+	}
+
+	return types.NetworkCreateResponse{ID: name}, nil
+}
+
+func (f *fakeDockerClient) VolumeInspect(
+	_ context.Context, name string,
+) (types.Volume, error) {
+	volume, ok := f.volumes[name]
+	if !ok {
+		return types.Volume{}, errdefs.NotFound(errors.New("no such volume"))
+	}
+
+	return volume, nil
+}
+
+func (f *fakeDockerClient) VolumeCreate(
+	_ context.Context, body volumetypes.VolumeCreateBody,
+) (types.Volume, error) {
+	volume := types.Volume{
+		Name:   body.Name,
+		Driver: body.Driver,
+		Labels: body.Labels,
+	}
+	if f.volumes == nil {
+		f.volumes = map[string]types.Volume{}
+	}
+	f.volumes[body.Name] = volume
+
+	return volume, nil
+}
+
 func Test_getIndexforImage(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -0,0 +1,349 @@
+package guvnor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/krystal/guvnor/state"
+)
+
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SecretConfig is the source of the value of a secret environment variable.
+// Exactly one of File or Key must be set.
+type SecretConfig struct {
+	// File is the path of the file containing the value, relative to the
+	// secrets directory. A single trailing newline is removed from the value.
+	File string `yaml:"file,omitempty" validate:"required_without=Key,excluded_with=Key"`
+	// Key is the name of a secret set with guvnor secrets. A secret set for
+	// the service takes precedence over one set for all services.
+	Key string `yaml:"key,omitempty"`
+}
+
+// Validate ensures the secret file is within the secrets directory, or that
+// the key is a valid secret name.
+func (sc SecretConfig) Validate() error {
+	if sc.Key != "" {
+		return validateSecretName(sc.Key)
+	}
+
+	cleaned := path.Clean(sc.File)
+	if path.IsAbs(sc.File) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf(
+			"file %q must be a relative path within the secrets directory", sc.File,
+		)
+	}
+
+	return nil
+}
+
+// description summarises the source of the secret without its value.
+func (sc SecretConfig) description() string {
+	if sc.Key != "" {
+		return fmt.Sprintf("key %s", sc.Key)
+	}
+
+	return fmt.Sprintf("file %s", sc.File)
+}
+
+// envLayer is the environment configured at one level of a service config,
+// i.e the service defaults or a process or task.
+type envLayer struct {
+	files   []string
+	env     map[string]string
+	secrets map[string]SecretConfig
+}
+
+func (sdc ServiceDefaultsConfig) envLayer() envLayer {
+	return envLayer{files: sdc.EnvFiles, env: sdc.Env, secrets: sdc.Secrets}
+}
+
+func (spc ServiceProcessConfig) envLayer() envLayer {
+	return envLayer{files: spc.EnvFiles, env: spc.Env, secrets: spc.Secrets}
+}
+
+func (stc ServiceTaskConfig) envLayer() envLayer {
+	return envLayer{files: stc.EnvFiles, env: stc.Env, secrets: stc.Secrets}
+}
+
+func (el envLayer) Validate() error {
+	for _, file := range el.files {
+		if file == "" {
+			return errors.New("envFiles cannot contain an empty path")
+		}
+	}
+
+	names := make([]string, 0, len(el.secrets))
+	for name := range el.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !envNameRegex.MatchString(name) {
+			return fmt.Errorf("secret name %q is not a valid environment variable name", name)
+		}
+		if _, ok := el.env[name]; ok {
+			return fmt.Errorf("secret %s is also defined in env", name)
+		}
+		if err := el.secrets[name].Validate(); err != nil {
+			return fmt.Errorf("secret %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateEnv ensures the env files and secrets of the service are valid. The
+// files themselves are only read when a container is started.
+func (sc *ServiceConfig) validateEnv() error {
+	if err := sc.Defaults.envLayer().Validate(); err != nil {
+		return withPath(fmt.Errorf("default env: %w", err), "defaults")
+	}
+
+	for _, processName := range sc.orderedProcessNames() {
+		if err := sc.Processes[processName].envLayer().Validate(); err != nil {
+			return withPath(
+				fmt.Errorf("process (%s) env: %w", processName, err),
+				"processes", processName,
+			)
+		}
+	}
+
+	for taskName, task := range sc.Tasks {
+		if err := task.envLayer().Validate(); err != nil {
+			return withPath(
+				fmt.Errorf("task (%s) env: %w", taskName, err),
+				"tasks", taskName,
+			)
+		}
+	}
+
+	return nil
+}
+
+// parseEnvFile parses a file in dotenv format. Each line is a KEY=value pair,
+// optionally prefixed with export. Values may be wrapped in double quotes,
+// which support escape sequences such as \n, or single quotes, which are taken
+// literally. Blank lines and lines starting with # are ignored, as is anything
+// following a # preceded by whitespace in an unquoted value.
+func parseEnvFile(data []byte) (map[string]string, error) {
+	out := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNumber)
+		}
+		key := strings.TrimSpace(line[:i])
+		if !envNameRegex.MatchString(key) {
+			return nil, fmt.Errorf(
+				"line %d: %q is not a valid environment variable name", lineNumber, key,
+			)
+		}
+
+		value, err := parseEnvValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", lineNumber, key, err)
+		}
+		out[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// parseEnvValue parses the value of a line in a dotenv file. Errors must not
+// include the value, as it may be sensitive.
+func parseEnvValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := strings.LastIndex(value, `"`)
+		if end == 0 || !isEnvComment(value[end+1:]) {
+			return "", errors.New("unterminated double quoted value")
+		}
+		unquoted, err := strconv.Unquote(value[:end+1])
+		if err != nil {
+			return "", errors.New("invalid escape sequence in double quoted value")
+		}
+
+		return unquoted, nil
+	case strings.HasPrefix(value, "'"):
+		end := strings.LastIndex(value, "'")
+		if end == 0 || !isEnvComment(value[end+1:]) {
+			return "", errors.New("unterminated single quoted value")
+		}
+
+		return value[1:end], nil
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+
+		return strings.TrimSpace(value), nil
+	}
+}
+
+// isEnvComment reports whether the remainder of a line after a quoted value is
+// empty or a comment.
+func isEnvComment(rest string) bool {
+	rest = strings.TrimSpace(rest)
+	return rest == "" || strings.HasPrefix(rest, "#")
+}
+
+// readEnvFile reads a dotenv file. Relative paths are resolved against the
+// service config directory.
+func (e *Engine) readEnvFile(file string) (map[string]string, error) {
+	if !path.IsAbs(file) {
+		file = path.Join(e.config.Paths.Config, file)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseEnvFile(data)
+}
+
+// checkSecretPermissions ensures a file or directory holding secrets cannot
+// be accessed by anyone other than its owner.
+func checkSecretPermissions(name string, info os.FileInfo) error {
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return fmt.Errorf(
+			"%s must only be accessible by its owner, but has mode %04o", name, perm,
+		)
+	}
+
+	return nil
+}
+
+// readSecret reads the value of a secret for a service, either from the
+// secrets directory or the encrypted secrets store. The value is registered
+// for redaction from logs.
+func (e *Engine) readSecret(serviceName string, secret SecretConfig) (string, error) {
+	if err := secret.Validate(); err != nil {
+		return "", err
+	}
+
+	var value string
+	var err error
+	if secret.Key != "" {
+		value, err = e.lookupSecret(serviceName, secret.Key)
+	} else {
+		value, err = e.readSecretFile(secret.File)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	e.redactor.add(value)
+	return value, nil
+}
+
+// lookupSecret decrypts a secret set for the service, falling back to one set
+// for all services.
+func (e *Engine) lookupSecret(serviceName, name string) (string, error) {
+	value, err := e.secrets.Get(serviceName, name)
+	if errors.Is(err, state.ErrSecretNotFound) {
+		value, err = e.secrets.Get("", name)
+	}
+	if errors.Is(err, state.ErrSecretNotFound) {
+		return "", fmt.Errorf("key %s has not been set with guvnor secrets", name)
+	}
+
+	return value, err
+}
+
+// readSecretFile reads the value of a secret from a file in the secrets
+// directory.
+func (e *Engine) readSecretFile(file string) (string, error) {
+	dir := e.config.Paths.GetSecrets()
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := checkSecretPermissions(dir, dirInfo); err != nil {
+		return "", err
+	}
+
+	file = path.Join(dir, file)
+	// Lstat ensures a symlink cannot point outside of the secrets directory
+	info, err := os.Lstat(file)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s must be a regular file", file)
+	}
+	if err := checkSecretPermissions(file, info); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(value, "\r"), nil
+}
+
+// resolveEnv builds the environment of a container from layers of config,
+// with later layers taking precedence. Within a layer, env files are applied
+// in order, followed by env and then secrets. late are the template values
+// interpolated into env, which are only known when the container is created.
+//
+// The values returned may be sensitive, so must never be logged.
+func (e *Engine) resolveEnv(
+	serviceName string, late map[string]string, layers ...envLayer,
+) (map[string]string, error) {
+	out := map[string]string{}
+	for _, layer := range layers {
+		for _, file := range layer.files {
+			fileEnv, err := e.readEnvFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("env file %s: %w", file, err)
+			}
+			for k, v := range fileEnv {
+				out[k] = v
+			}
+		}
+
+		for k, v := range layer.env {
+			value, err := expandLate(v, late)
+			if err != nil {
+				return nil, fmt.Errorf("env %s: %w", k, err)
+			}
+			out[k] = value
+		}
+
+		for name, secret := range layer.secrets {
+			value, err := e.readSecret(serviceName, secret)
+			if err != nil {
+				return nil, fmt.Errorf("secret %s: %w", name, err)
+			}
+			out[name] = value
+		}
+	}
+
+	return out, nil
+}
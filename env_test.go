@@ -0,0 +1,315 @@
+package guvnor
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/krystal/guvnor/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func Test_parseEnvFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			data: `
+# database
+DATABASE_HOST=db.internal
+export DATABASE_PORT = 5432
+GREETING="hello\nworld" # comment
+LITERAL='no \n escapes'
+TRAILING=value # comment
+HASH=a#b
+EMPTY=
+`,
+			want: map[string]string{
+				"DATABASE_HOST": "db.internal",
+				"DATABASE_PORT": "5432",
+				"GREETING":      "hello\nworld",
+				"LITERAL":       `no \n escapes`,
+				"TRAILING":      "value",
+				"HASH":          "a#b",
+				"EMPTY":         "",
+			},
+		},
+		{
+			name:    "missing equals",
+			data:    "FOO=bar\nBAZ\n",
+			wantErr: "line 2: expected KEY=value",
+		},
+		{
+			name:    "invalid name",
+			data:    "MY-VAR=bar\n",
+			wantErr: `line 1: "MY-VAR" is not a valid environment variable name`,
+		},
+		{
+			name:    "unterminated quote",
+			data:    `PASSWORD="hunter2`,
+			wantErr: "line 1: PASSWORD: unterminated double quoted value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEnvFile([]byte(tt.data))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_Engine_resolveEnv(t *testing.T) {
+	configDir := t.TempDir()
+	secretsDir := path.Join(t.TempDir(), "secrets")
+	require.NoError(t, os.Mkdir(secretsDir, 0o700))
+
+	require.NoError(t, os.WriteFile(
+		path.Join(configDir, "shared.env"),
+		[]byte("RAILS_ENV=staging\nLOG_LEVEL=info\nAPI_KEY=placeholder\nLITERAL=${guvnor.deployment}\n"),
+		0o644,
+	))
+	require.NoError(t, os.WriteFile(
+		path.Join(configDir, "web.env"), []byte("LOG_LEVEL=debug\n"), 0o644,
+	))
+	require.NoError(t, os.WriteFile(
+		path.Join(secretsDir, "api_key"), []byte("s3cret\n"), 0o600,
+	))
+
+	log := zaptest.NewLogger(t)
+	e := &Engine{
+		config: EngineConfig{
+			Paths: PathsConfig{Config: configDir, Secrets: secretsDir},
+		},
+		secrets: &state.SecretStore{
+			Path:    path.Join(t.TempDir(), "secrets.json"),
+			KeyFile: path.Join(t.TempDir(), "secrets.key"),
+			Log:     log,
+		},
+		redactor: newRedactor(),
+	}
+	require.NoError(t, e.secrets.Set("fizz", "DATABASE_PASSWORD", "hunter2"))
+	require.NoError(t, e.secrets.Set("", "DATABASE_PASSWORD", "global"))
+	require.NoError(t, e.secrets.Set("", "SMTP_PASSWORD", "correct horse"))
+
+	got, err := e.resolveEnv(
+		"fizz",
+		map[string]string{"deployment": "3"},
+		envLayer{
+			files: []string{"shared.env"},
+			env: map[string]string{
+				"RAILS_ENV": "production",
+				"RELEASE":   "v${guvnor.deployment}",
+			},
+		},
+		envLayer{
+			files: []string{path.Join(configDir, "web.env")},
+			secrets: map[string]SecretConfig{
+				"API_KEY":           {File: "api_key"},
+				"DATABASE_PASSWORD": {Key: "DATABASE_PASSWORD"},
+				"SMTP_PASSWORD":     {Key: "SMTP_PASSWORD"},
+			},
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		// env takes precedence over env files in the same layer
+		"RAILS_ENV": "production",
+		// templates are only interpolated in env, not env files or secrets
+		"RELEASE": "v3",
+		"LITERAL": "${guvnor.deployment}",
+		// later layers take precedence over earlier ones
+		"LOG_LEVEL": "debug",
+		"API_KEY":   "s3cret",
+		// secrets of the service take precedence over those for all services
+		"DATABASE_PASSWORD": "hunter2",
+		"SMTP_PASSWORD":     "correct horse",
+	}, got)
+	assert.Equal(t, "[redacted] and [redacted]", e.redactor.redact("s3cret and hunter2"))
+
+	_, err = e.resolveEnv("fizz", nil, envLayer{files: []string{"missing.env"}})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = e.resolveEnv("fizz", nil, envLayer{
+		secrets: map[string]SecretConfig{"API_KEY": {Key: "STRIPE_KEY"}},
+	})
+	assert.EqualError(t, err,
+		"secret API_KEY: key STRIPE_KEY has not been set with guvnor secrets")
+}
+
+func Test_Engine_readSecret(t *testing.T) {
+	secretsDir := path.Join(t.TempDir(), "secrets")
+	require.NoError(t, os.Mkdir(secretsDir, 0o700))
+	e := &Engine{
+		config: EngineConfig{Paths: PathsConfig{Secrets: secretsDir}},
+	}
+
+	require.NoError(t, os.WriteFile(
+		path.Join(secretsDir, "token"), []byte("abc\r\n"), 0o400,
+	))
+	got, err := e.readSecret("fizz", SecretConfig{File: "token"})
+	require.NoError(t, err)
+	assert.Equal(t, "abc", got)
+
+	require.NoError(t, os.WriteFile(
+		path.Join(secretsDir, "readable"), []byte("abc"), 0o644,
+	))
+	_, err = e.readSecret("fizz", SecretConfig{File: "readable"})
+	assert.EqualError(t, err, path.Join(secretsDir, "readable")+
+		" must only be accessible by its owner, but has mode 0644")
+
+	require.NoError(t, os.Symlink(
+		path.Join(secretsDir, "token"), path.Join(secretsDir, "link"),
+	))
+	_, err = e.readSecret("fizz", SecretConfig{File: "link"})
+	assert.EqualError(t, err, path.Join(secretsDir, "link")+
+		" must be a regular file")
+
+	_, err = e.readSecret("fizz", SecretConfig{File: "../token"})
+	assert.EqualError(t, err,
+		`file "../token" must be a relative path within the secrets directory`)
+
+	require.NoError(t, os.Chmod(secretsDir, 0o755))
+	_, err = e.readSecret("fizz", SecretConfig{File: "token"})
+	assert.EqualError(t, err, secretsDir+
+		" must only be accessible by its owner, but has mode 0755")
+}
+
+func Test_Engine_parseServiceConfig_env(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			config: `
+defaults:
+  image: foo
+  envFiles: [shared.env]
+  secrets:
+    SECRET_KEY_BASE:
+      file: fizz/secret_key_base
+processes:
+  web:
+    envFiles: [web.env]
+    secrets:
+      API_KEY:
+        file: fizz/api_key
+tasks:
+  migrate:
+    secrets:
+      DATABASE_PASSWORD:
+        key: DATABASE_PASSWORD
+`,
+		},
+		{
+			name: "missing file and key",
+			config: `
+defaults:
+  image: foo
+processes:
+  web:
+    secrets:
+      API_KEY: {}
+`,
+			wantErr: "Key: 'ServiceConfig.Processes[web].Secrets[API_KEY].File' " +
+				"Error:Field validation for 'File' failed on the 'required_without' tag",
+		},
+		{
+			name: "file outside secrets directory",
+			config: `
+defaults:
+  image: foo
+  secrets:
+    API_KEY:
+      file: /etc/passwd
+`,
+			wantErr: `default env: secret API_KEY: file "/etc/passwd" must be ` +
+				`a relative path within the secrets directory`,
+		},
+		{
+			name: "invalid name",
+			config: `
+defaults:
+  image: foo
+tasks:
+  migrate:
+    secrets:
+      api-key:
+        file: api_key
+`,
+			wantErr: `task (migrate) env: secret name "api-key" is not a ` +
+				`valid environment variable name`,
+		},
+		{
+			name: "also in env",
+			config: `
+defaults:
+  image: foo
+processes:
+  web:
+    env:
+      API_KEY: foo
+    secrets:
+      API_KEY:
+        file: api_key
+`,
+			wantErr: "process (web) env: secret API_KEY is also defined in env",
+		},
+		{
+			name: "file and key",
+			config: `
+defaults:
+  image: foo
+processes:
+  web:
+    secrets:
+      API_KEY:
+        file: api_key
+        key: API_KEY
+`,
+			wantErr: "Key: 'ServiceConfig.Processes[web].Secrets[API_KEY].File' " +
+				"Error:Field validation for 'File' failed on the 'excluded_with' tag",
+		},
+		{
+			name: "invalid key",
+			config: `
+defaults:
+  image: foo
+  secrets:
+    API_KEY:
+      key: stripe-key
+`,
+			wantErr: `default env: secret API_KEY: secret name "stripe-key" must ` +
+				`start with a letter or underscore and only contain letters, ` +
+				`numbers and underscores`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Engine{validate: validator.New()}
+			_, err := e.parseServiceConfig("fizz", []byte(tt.config))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package guvnor
 
 import (
+	"path"
+
 	"github.com/docker/docker/client"
 	"github.com/go-playground/validator/v10"
 	"github.com/krystal/guvnor/caddy"
@@ -15,6 +17,7 @@ const (
 	deploymentLabel = "io.k.guvnor.deployment"
 	managedLabel    = "io.k.guvnor.managed"
 	portLabel       = "io.k.guvnor.port"
+	volumeLabel     = "io.k.guvnor.volume"
 )
 
 type Engine struct {
@@ -22,7 +25,9 @@ type Engine struct {
 	docker   client.APIClient
 	config   EngineConfig
 	caddy    *caddy.Manager
-	state    *state.FileBasedStore
+	state    state.Store
+	secrets  *state.SecretStore
+	redactor *redactor
 	validate *validator.Validate
 }
 
@@ -33,6 +38,10 @@ func NewEngine(log *zap.Logger, docker client.APIClient, cfg EngineConfig, valid
 	if log == nil {
 		log = zap.NewNop()
 	}
+	// Secrets are redacted from everything logged by the engine, including
+	// errors returned by Docker.
+	redactor := newRedactor()
+	log = withRedaction(log, redactor)
 
 	return &Engine{
 		log:    log,
@@ -50,9 +59,26 @@ func NewEngine(log *zap.Logger, docker client.APIClient, cfg EngineConfig, valid
 			),
 		},
 		validate: validate,
-		state: &state.FileBasedStore{
-			RootPath: cfg.Paths.State,
-			Log:      log.Named("state"),
+		state:    newStateStore(log.Named("state"), cfg),
+		secrets: &state.SecretStore{
+			Path:    path.Join(cfg.Paths.State, "secrets", "secrets.json"),
+			KeyFile: cfg.Paths.GetSecretsKey(),
+			Log:     log.Named("secrets"),
 		},
+		redactor: redactor,
+	}
+}
+
+func newStateStore(log *zap.Logger, cfg EngineConfig) state.Store {
+	if cfg.State.Backend == StateBackendBolt {
+		return &state.BoltStore{
+			Path: path.Join(cfg.Paths.State, "state.db"),
+			Log:  log,
+		}
+	}
+
+	return &state.FileBasedStore{
+		RootPath: cfg.Paths.State,
+		Log:      log,
 	}
 }
@@ -0,0 +1,53 @@
+package guvnor
+
+import (
+	"context"
+	"os"
+	"os/user"
+
+	"github.com/krystal/guvnor/state"
+)
+
+type HistoryArgs struct {
+	ServiceName string
+}
+
+type HistoryResult struct {
+	// Deployments is the retained history of the service, ordered from
+	// newest to oldest.
+	Deployments []state.Deployment
+}
+
+// triggeringUser returns the name of the user responsible for the current
+// invocation of guvnor. When running under sudo, the invoking user is
+// preferred over root.
+func triggeringUser() string {
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		return sudoUser
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+
+	return u.Username
+}
+
+func (e *Engine) History(
+	ctx context.Context, args HistoryArgs,
+) (*HistoryResult, error) {
+	deployments, err := e.state.ListDeployments(args.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	reversed := make([]state.Deployment, 0, len(deployments))
+	for i := len(deployments) - 1; i >= 0; i-- {
+		reversed = append(reversed, deployments[i])
+	}
+
+	return &HistoryResult{
+		Deployments: reversed,
+	}, nil
+}
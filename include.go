@@ -0,0 +1,279 @@
+package guvnor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cloneYAML deep copies a node, replacing aliases with the node they refer
+// to so that the copy can be merged with nodes from other documents.
+func cloneYAML(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		return cloneYAML(node.Alias)
+	}
+
+	clone := *node
+	clone.Anchor = ""
+	clone.Content = make([]*yaml.Node, 0, len(node.Content))
+	for _, child := range node.Content {
+		clone.Content = append(clone.Content, cloneYAML(child))
+	}
+
+	return &clone
+}
+
+// mergeYAML deep merges src over dst, returning the result. Mappings are
+// merged key by key, and any other value in src, including a sequence,
+// replaces the value in dst. A null value in src leaves dst unchanged.
+func mergeYAML(dst, src *yaml.Node) *yaml.Node {
+	if dst == nil {
+		return src
+	}
+	if src.Kind == yaml.ScalarNode && src.Tag == "!!null" {
+		return dst
+	}
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		return src
+	}
+
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		if j := mappingIndex(dst, key.Value); j >= 0 {
+			dst.Content[j+1] = mergeYAML(dst.Content[j+1], value)
+			continue
+		}
+		dst.Content = append(dst.Content, key, value)
+	}
+
+	return dst
+}
+
+// mappingIndex returns the index of the key within a mapping node, or -1 if
+// it is not present.
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// recordFile records the file that a node and its children were read from.
+func recordFile(files map[*yaml.Node]string, node *yaml.Node, file string) {
+	files[node] = file
+	for _, child := range node.Content {
+		recordFile(files, child, file)
+	}
+}
+
+// configFileError is an error decoding a service config file. The file and
+// its document are kept so that the position of the problem can be found.
+type configFileError struct {
+	file string
+	// doc is nil when the file is not valid YAML.
+	doc *yaml.Node
+	err error
+}
+
+func (cfe *configFileError) Error() string {
+	return cfe.err.Error()
+}
+
+func (cfe *configFileError) Unwrap() error {
+	return cfe.err
+}
+
+// mergedServiceConfig is a service config merged from several files. files
+// records which file each node was read from, so that problems can be
+// reported against the file they were written in.
+type mergedServiceConfig struct {
+	root  *yaml.Node
+	files map[*yaml.Node]string
+}
+
+// defaultsLayer returns the engine defaults as a service config, to be merged
+// beneath each service. nil is returned when no defaults are configured.
+func (c EngineConfig) defaultsLayer() (*yaml.Node, error) {
+	defaults := c.defaultsNode
+	if defaults == nil {
+		if reflect.ValueOf(c.Defaults).IsZero() {
+			return nil, nil
+		}
+
+		defaults = &yaml.Node{}
+		if err := defaults.Encode(c.Defaults); err != nil {
+			return nil, err
+		}
+	}
+
+	return &yaml.Node{
+		Kind: yaml.MappingNode,
+		Tag:  "!!map",
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "defaults"},
+			cloneYAML(defaults),
+		},
+	}, nil
+}
+
+// loadConfigLayer reads a service config or fragment, merging any fragments it
+// includes beneath it. name is the path of the file relative to the config
+// directory, and stack is the chain of files including it, so that cycles can
+// be detected.
+func (e *Engine) loadConfigLayer(
+	name string, filePath string, stack []string, files map[*yaml.Node]string,
+) (*yaml.Node, error) {
+	for _, parent := range stack {
+		if parent == name {
+			return nil, fmt.Errorf(
+				"include cycle: %s", strings.Join(append(stack, name), " -> "),
+			)
+		}
+	}
+	stack = append(stack, name)
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, &configFileError{file: filePath, err: err}
+	}
+
+	// Each file is decoded on its own so that unknown fields and invalid
+	// values are reported with the line they are on.
+	decoder := yaml.NewDecoder(bytes.NewBuffer(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&ServiceConfig{}); err != nil && !errors.Is(err, io.EOF) {
+		return nil, &configFileError{file: filePath, doc: doc, err: err}
+	}
+
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	root := cloneYAML(doc.Content[0])
+	recordFile(files, root, filePath)
+
+	includes := []string{}
+	if i := mappingIndex(root, "include"); i >= 0 {
+		if err := root.Content[i+1].Decode(&includes); err != nil {
+			return nil, err
+		}
+		root.Content = append(root.Content[:i], root.Content[i+2:]...)
+	}
+
+	var merged *yaml.Node
+	for _, include := range includes {
+		clean := path.Clean(include)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf(
+				"include %q must be a relative path within the config directory",
+				include,
+			)
+		}
+
+		fragment, err := e.loadConfigLayer(
+			clean, path.Join(e.config.Paths.Config, clean), stack, files,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("include %s: %w", clean, err)
+		}
+		merged = mergeYAML(merged, fragment)
+	}
+
+	return mergeYAML(merged, root), nil
+}
+
+// mergeServiceConfig merges the engine defaults and the fragments included by
+// the service config at filePath beneath it. Later values take precedence, so
+// fragments override the engine defaults in the order they are included, and
+// the service config overrides them all.
+func (e *Engine) mergeServiceConfig(
+	serviceName string, filePath string,
+) (*mergedServiceConfig, error) {
+	merged := &mergedServiceConfig{files: map[*yaml.Node]string{}}
+
+	defaults, err := e.config.defaultsLayer()
+	if err != nil {
+		return nil, fmt.Errorf("engine defaults: %w", err)
+	}
+	if defaults != nil && e.config.defaultsNode != nil {
+		recordFile(merged.files, defaults.Content[1], e.config.path)
+	}
+
+	layer, err := e.loadConfigLayer(
+		serviceName+".yaml", filePath, nil, merged.files,
+	)
+	if err != nil {
+		return nil, err
+	}
+	merged.root = mergeYAML(defaults, layer)
+
+	return merged, nil
+}
+
+// encode returns the merged config as YAML.
+func (msc *mergedServiceConfig) encode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(msc.root); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// renderServiceConfig returns the YAML config of a service from the config
+// directory, with the engine defaults and the fragments it includes merged
+// into it.
+func (e *Engine) renderServiceConfig(serviceName string) ([]byte, error) {
+	merged, err := e.mergeServiceConfig(
+		serviceName,
+		path.Join(e.config.Paths.Config, serviceName+".yaml"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return merged.encode()
+}
+
+type RenderServiceConfigArgs struct {
+	ServiceName string
+}
+
+type RenderServiceConfigResult struct {
+	// Config is the YAML config of the service with the engine defaults and
+	// included fragments merged into it. Templates are left as written.
+	Config string
+}
+
+// RenderServiceConfig returns the effective config of a service, once the
+// engine defaults and the fragments it includes have been merged into it.
+func (e *Engine) RenderServiceConfig(
+	ctx context.Context, args RenderServiceConfigArgs,
+) (*RenderServiceConfigResult, error) {
+	data, err := e.renderServiceConfig(args.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RenderServiceConfigResult{Config: string(data)}, nil
+}
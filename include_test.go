@@ -0,0 +1,179 @@
+package guvnor
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, data := range files {
+		filePath := path.Join(dir, name)
+		require.NoError(t, os.MkdirAll(path.Dir(filePath), 0o755))
+		require.NoError(t, os.WriteFile(filePath, []byte(data), 0o644))
+	}
+}
+
+func Test_Engine_renderServiceConfig(t *testing.T) {
+	v := validator.New()
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"config.yaml": `
+paths:
+  config: ` + path.Join(dir, "services") + `
+  state: /var/lib/guvnor
+defaults:
+  image: ghcr.io/krystal/base
+  imageTag: latest
+  user: "1000"
+  env:
+    TZ: UTC
+    LOG_LEVEL: info
+`,
+		"services/shared/rails.yaml": `
+include: [shared/logging.yaml]
+defaults:
+  image: ghcr.io/krystal/rails
+  env:
+    RAILS_ENV: production
+  mounts:
+    - host: /etc/ssl
+      container: /etc/ssl
+processes:
+  web:
+    command: ["bin/rails", "server"]
+    quantity: 2
+`,
+		"services/shared/logging.yaml": `
+defaults:
+  env:
+    LOG_LEVEL: warn
+    LOG_FORMAT: json
+`,
+		"services/fizz.yaml": `
+include:
+  - shared/rails.yaml
+defaults:
+  imageTag: v1.2.3
+  env:
+    LOG_LEVEL: debug
+  mounts: []
+processes:
+  web:
+    quantity: 3
+`,
+	})
+
+	cfg, err := LoadConfig(v, path.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+	e := &Engine{validate: v, config: *cfg}
+
+	got, err := e.renderServiceConfig("fizz")
+	require.NoError(t, err)
+	assert.Equal(t, `defaults:
+  image: ghcr.io/krystal/rails
+  imageTag: v1.2.3
+  user: "1000"
+  env:
+    TZ: UTC
+    LOG_LEVEL: debug
+    LOG_FORMAT: json
+    RAILS_ENV: production
+  mounts: []
+processes:
+  web:
+    command: ["bin/rails", "server"]
+    quantity: 3
+`, string(got))
+
+	svc, err := e.loadServiceConfig("fizz")
+	require.NoError(t, err)
+	assert.Empty(t, svc.Include)
+	assert.Equal(t, "1000", svc.Processes["web"].GetUser())
+	image, _, err := svc.Processes["web"].GetImage()
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/krystal/rails:v1.2.3", image)
+}
+
+func Test_Engine_renderServiceConfig_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"fizz.yaml":     "include: [shared/a.yaml]\n",
+				"shared/a.yaml": "include: [shared/b.yaml]\n",
+				"shared/b.yaml": "include: [./shared/a.yaml]\n",
+			},
+			wantErr: "include shared/a.yaml: include shared/b.yaml: include " +
+				"shared/a.yaml: include cycle: fizz.yaml -> shared/a.yaml -> " +
+				"shared/b.yaml -> shared/a.yaml",
+		},
+		{
+			name: "outside config directory",
+			files: map[string]string{
+				"fizz.yaml": "include: [../secrets.yaml]\n",
+			},
+			wantErr: `include "../secrets.yaml" must be a relative path ` +
+				`within the config directory`,
+		},
+		{
+			name: "unknown field in fragment",
+			files: map[string]string{
+				"fizz.yaml":     "include: [shared/a.yaml]\n",
+				"shared/a.yaml": "defaults:\n  image: foo\n  imag: bar\n",
+			},
+			wantErr: "include shared/a.yaml: yaml: unmarshal errors:\n  " +
+				"line 3: field imag not found in type guvnor.ServiceDefaultsConfig",
+		},
+		{
+			name: "not a mapping",
+			files: map[string]string{
+				"fizz.yaml":     "include: [shared/a.yaml]\n",
+				"shared/a.yaml": "\n- foo\n",
+			},
+			wantErr: "include shared/a.yaml: yaml: unmarshal errors:\n  " +
+				"line 2: cannot unmarshal !!seq into guvnor.ServiceConfig",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfigFiles(t, dir, tt.files)
+			e := &Engine{config: EngineConfig{Paths: PathsConfig{Config: dir}}}
+
+			_, err := e.renderServiceConfig("fizz")
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+
+	e := &Engine{config: EngineConfig{Paths: PathsConfig{Config: t.TempDir()}}}
+	_, err := e.renderServiceConfig("fizz")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func Test_EngineConfig_defaultsLayer(t *testing.T) {
+	layer, err := EngineConfig{}.defaultsLayer()
+	require.NoError(t, err)
+	assert.Nil(t, layer)
+
+	// Defaults set in code, rather than loaded from a config file, are
+	// merged in full.
+	layer, err = EngineConfig{
+		Defaults: ServiceDefaultsConfig{Image: "foo"},
+	}.defaultsLayer()
+	require.NoError(t, err)
+	defaults := &ServiceConfig{}
+	require.NoError(t, layer.Decode(defaults))
+	assert.Equal(t, "foo", defaults.Defaults.Image)
+}
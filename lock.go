@@ -0,0 +1,72 @@
+package guvnor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/krystal/guvnor/state"
+	"go.uber.org/zap"
+)
+
+// lockPollInterval is how often an unavailable service lock is retried when
+// waiting for it.
+var lockPollInterval = 500 * time.Millisecond
+
+// LockOptions controls how the lock on a service is acquired by operations
+// that modify it.
+type LockOptions struct {
+	// Wait causes the operation to wait for the lock to be released rather
+	// than failing immediately.
+	Wait bool
+	// ForceUnlock removes any existing lock before acquiring it. This should
+	// only be used if the holder is known to have died.
+	ForceUnlock bool
+}
+
+// lockService acquires the lock of a service, preventing other invocations of
+// guvnor from modifying it until it is released.
+func (e *Engine) lockService(
+	ctx context.Context, serviceName string, opts LockOptions,
+) (state.Lock, error) {
+	if opts.ForceUnlock {
+		if err := e.state.ForceUnlock(serviceName); err != nil {
+			return nil, err
+		}
+	}
+
+	info := state.LockInfo{
+		PID:  os.Getpid(),
+		User: triggeringUser(),
+	}
+	for {
+		info.AcquiredAt = time.Now()
+		lock, err := e.state.Lock(serviceName, info)
+		heldErr := &state.LockHeldError{}
+		if !opts.Wait || !errors.As(err, &heldErr) {
+			return lock, err
+		}
+
+		e.log.Info("waiting for service lock to be released",
+			zap.String("service", serviceName),
+			zap.Error(err),
+		)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// unlockService releases a lock acquired by lockService, logging rather than
+// returning any error so it can be deferred.
+func (e *Engine) unlockService(serviceName string, lock state.Lock) {
+	if err := lock.Unlock(); err != nil {
+		e.log.Warn("failed to release service lock",
+			zap.String("service", serviceName),
+			zap.Error(err),
+		)
+	}
+}
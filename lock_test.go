@@ -0,0 +1,43 @@
+package guvnor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/krystal/guvnor/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func Test_Engine_lockService(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	e := &Engine{
+		log: log,
+		state: &state.FileBasedStore{
+			RootPath: t.TempDir(),
+			Log:      log,
+		},
+	}
+	ctx := context.Background()
+
+	held, err := e.lockService(ctx, "fizz", LockOptions{})
+	require.NoError(t, err)
+
+	_, err = e.lockService(ctx, "fizz", LockOptions{})
+	assert.ErrorAs(t, err, new(*state.LockHeldError))
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = e.lockService(timeoutCtx, "fizz", LockOptions{Wait: true})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		e.unlockService("fizz", held)
+	}()
+	lock, err := e.lockService(ctx, "fizz", LockOptions{Wait: true})
+	require.NoError(t, err)
+	e.unlockService("fizz", lock)
+}
@@ -0,0 +1,115 @@
+package guvnor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"go.uber.org/zap"
+)
+
+// managedNetworkName returns the name of the Docker network shared by the
+// containers of a service using the service network mode.
+func managedNetworkName(serviceName string) string {
+	return fmt.Sprintf("guvnor-%s", serviceName)
+}
+
+// serviceNetworkingConfig attaches a container to the network of the service,
+// so that other containers of the service can resolve it by alias.
+func serviceNetworkingConfig(
+	serviceName string, alias string,
+) *network.NetworkingConfig {
+	return &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			managedNetworkName(serviceName): {
+				Aliases: []string{alias},
+			},
+		},
+	}
+}
+
+// usesServiceNetwork reports whether any process or task of the service uses
+// the service network mode.
+func (sc *ServiceConfig) usesServiceNetwork() bool {
+	for _, process := range sc.Processes {
+		if process.GetNetworkMode() == NetworkModeService {
+			return true
+		}
+	}
+	for _, task := range sc.Tasks {
+		if task.GetNetworkMode() == NetworkModeService {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ensureNetwork creates the network of the service if it is needed and does
+// not yet exist.
+func (e *Engine) ensureNetwork(ctx context.Context, svc *ServiceConfig) error {
+	if !svc.usesServiceNetwork() {
+		return nil
+	}
+
+	name := managedNetworkName(svc.Name)
+	existing, err := e.docker.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	if err == nil {
+		// Networks are only reused if guvnor created them for the service,
+		// so containers are never attached to a network shared with others.
+		if existing.Labels[managedLabel] != "1" ||
+			existing.Labels[serviceLabel] != svc.Name {
+			return fmt.Errorf(
+				"network %s already exists but was not created by guvnor for service %s",
+				name, svc.Name,
+			)
+		}
+		return nil
+	} else if !client.IsErrNotFound(err) {
+		return err
+	}
+
+	e.log.Info("creating network",
+		zap.String("service", svc.Name),
+		zap.String("network", name),
+	)
+	_, err = e.docker.NetworkCreate(ctx, name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Labels: map[string]string{
+			serviceLabel: svc.Name,
+			managedLabel: "1",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("creating network %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// purgeNetworks removes all networks created by guvnor. Any containers
+// attached to them must already have been removed.
+func (e *Engine) purgeNetworks(ctx context.Context) error {
+	networks, err := e.docker.NetworkList(ctx, types.NetworkListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", managedLabel),
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, managedNetwork := range networks {
+		e.log.Debug("purging network", zap.String("network", managedNetwork.Name))
+
+		if err := e.docker.NetworkRemove(ctx, managedNetwork.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package guvnor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func Test_serviceNetworkingConfig(t *testing.T) {
+	assert.Equal(t, &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			"guvnor-fizz": {
+				Aliases: []string{"web"},
+			},
+		},
+	}, serviceNetworkingConfig("fizz", "web"))
+}
+
+func Test_ServiceConfig_usesServiceNetwork(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   bool
+	}{
+		{
+			name: "no network",
+			config: `
+defaults:
+  image: foo
+processes:
+  web: {}
+`,
+			want: false,
+		},
+		{
+			name: "default network",
+			config: `
+defaults:
+  image: foo
+  network:
+    mode: service
+processes:
+  web: {}
+`,
+			want: true,
+		},
+		{
+			name: "task network",
+			config: `
+defaults:
+  image: foo
+processes:
+  web:
+    network:
+      mode: host
+tasks:
+  migrate:
+    network:
+      mode: service
+`,
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Engine{validate: validator.New()}
+			svc, err := e.parseServiceConfig("fizz", []byte(tt.config))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, tt.want, svc.usesServiceNetwork())
+		})
+	}
+}
+
+func Test_Engine_parseServiceConfig_invalidNetworkMode(t *testing.T) {
+	e := &Engine{validate: validator.New()}
+	_, err := e.parseServiceConfig("fizz", []byte(`
+defaults:
+  image: foo
+processes:
+  web:
+    network:
+      mode: bridge
+`))
+	assert.EqualError(t, err,
+		"Key: 'ServiceConfig.Processes[web].Network.Mode' Error:"+
+			"Field validation for 'Mode' failed on the 'oneof' tag",
+	)
+}
+
+func Test_Engine_ensureNetwork(t *testing.T) {
+	svc, err := (&Engine{validate: validator.New()}).parseServiceConfig(
+		"fizz", []byte(`
+defaults:
+  image: foo
+  network:
+    mode: service
+processes:
+  web: {}
+`),
+	)
+	require.NoError(t, err)
+
+	t.Run("creates missing network", func(t *testing.T) {
+		docker := &fakeDockerClient{}
+		e := &Engine{docker: docker, log: zap.NewNop()}
+
+		require.NoError(t, e.ensureNetwork(context.Background(), svc))
+		assert.Equal(t, map[string]string{
+			serviceLabel: "fizz",
+			managedLabel: "1",
+		}, docker.networks["guvnor-fizz"].Labels)
+
+		// Existing networks are reused.
+		require.NoError(t, e.ensureNetwork(context.Background(), svc))
+	})
+
+	t.Run("existing network of another owner", func(t *testing.T) {
+		docker := &fakeDockerClient{
+			networks: map[string]types.NetworkResource{
+				"guvnor-fizz": {
+					Name: "guvnor-fizz",
+					Labels: map[string]string{
+						serviceLabel: "buzz",
+						managedLabel: "1",
+					},
+				},
+			},
+		}
+		e := &Engine{docker: docker, log: zap.NewNop()}
+
+		err := e.ensureNetwork(context.Background(), svc)
+		assert.EqualError(
+			t, err,
+			"network guvnor-fizz already exists but was not created by "+
+				"guvnor for service fizz",
+		)
+	})
+}
@@ -0,0 +1,381 @@
+package guvnor
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"go.uber.org/zap"
+)
+
+type PlanArgs struct {
+	ServiceName string
+	// Tag overrides the default image tag configured for the service, as it
+	// would be for a deployment.
+	Tag string
+	// File is the path to a service config to plan instead of the one in the
+	// config directory, so that changes can be reviewed before they are
+	// saved.
+	File string
+}
+
+type PlanAction string
+
+var (
+	// PlanActionCreate indicates a process will be deployed for the first
+	// time.
+	PlanActionCreate PlanAction = "create"
+	// PlanActionReplace indicates the containers of a process will be
+	// replaced using its deployment strategy.
+	PlanActionReplace PlanAction = "replace"
+	// PlanActionRemove indicates a process has been deleted from the service
+	// config and its containers will be stopped.
+	PlanActionRemove PlanAction = "remove"
+)
+
+type ChangeType string
+
+var (
+	ChangeAdded    ChangeType = "added"
+	ChangeRemoved  ChangeType = "removed"
+	ChangeModified ChangeType = "modified"
+)
+
+// FieldChange describes a change to a single configuration value between the
+// last deployment and the one being planned.
+type FieldChange struct {
+	Type  ChangeType `json:"type"`
+	Field string     `json:"field"`
+	From  string     `json:"from,omitempty"`
+	To    string     `json:"to,omitempty"`
+}
+
+type ProcessPlan struct {
+	Action PlanAction `json:"action"`
+	// LiveReplicas is the number of containers of the process that are
+	// currently running.
+	LiveReplicas int           `json:"liveReplicas"`
+	Changes      []FieldChange `json:"changes"`
+}
+
+type ProcessPlans map[string]ProcessPlan
+
+func (pp ProcessPlans) OrderedKeys() []string {
+	keys := make([]string, 0, len(pp))
+	for k := range pp {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+type PlanResult struct {
+	ServiceName string `json:"serviceName"`
+	// ActiveDeploymentID is the deployment the plan has been compared against.
+	ActiveDeploymentID  int          `json:"activeDeploymentID"`
+	Processes           ProcessPlans `json:"processes"`
+	PreDeploymentTasks  []string     `json:"preDeploymentTasks"`
+	PostDeploymentTasks []string     `json:"postDeploymentTasks"`
+}
+
+// planValues are the comparable values of a process configuration.
+type planValues struct {
+	image     string
+	replicas  string
+	command   string
+	env       map[string]string
+	envFiles  map[string]string
+	secrets   map[string]string
+	mounts    map[string]string
+	ports     map[string]string
+	hostnames map[string]string
+	path      string
+}
+
+func processPlanValues(process *ServiceProcessConfig) (*planValues, error) {
+	if process == nil {
+		return &planValues{}, nil
+	}
+
+	image, _, err := process.GetImage()
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := map[string]string{}
+	for _, mnt := range process.GetMounts() {
+		mounts[mnt.Target] = mountDescription(mnt)
+	}
+
+	ports := map[string]string{}
+	for _, port := range process.Ports {
+		ports[port.Name] = port.description()
+	}
+
+	envFiles := map[string]string{}
+	for _, file := range append(
+		append([]string{}, process.parent.Defaults.EnvFiles...), process.EnvFiles...,
+	) {
+		envFiles[file] = file
+	}
+
+	// Only the source of secrets is compared, so their values are never
+	// displayed.
+	secrets := map[string]string{}
+	for _, layer := range []envLayer{
+		process.parent.Defaults.envLayer(), process.envLayer(),
+	} {
+		for name, secret := range layer.secrets {
+			secrets[name] = secret.description()
+		}
+	}
+
+	hostnames := map[string]string{}
+	for _, hostname := range process.Caddy.Hostnames {
+		hostnames[hostname] = hostname
+	}
+
+	return &planValues{
+		image:     image,
+		replicas:  strconv.Itoa(process.GetQuantity()),
+		command:   strings.Join(process.Command, " "),
+		env:       mergeEnvMap(process.parent.Defaults.Env, process.Env),
+		envFiles:  envFiles,
+		secrets:   secrets,
+		mounts:    mounts,
+		ports:     ports,
+		hostnames: hostnames,
+		path:      process.Caddy.Path,
+	}, nil
+}
+
+// mountDescription summarises the source of a mount for display in a plan.
+func mountDescription(mnt mount.Mount) string {
+	desc := mnt.Source
+	switch mnt.Type {
+	case mount.TypeVolume:
+		desc = fmt.Sprintf("volume %s", mnt.Source)
+	case mount.TypeTmpfs:
+		desc = "tmpfs"
+	}
+
+	if mnt.ReadOnly {
+		desc += " (read only)"
+	}
+
+	return desc
+}
+
+func diffValue(field, from, to string) []FieldChange {
+	switch {
+	case from == to:
+		return nil
+	case from == "":
+		return []FieldChange{{Type: ChangeAdded, Field: field, To: to}}
+	case to == "":
+		return []FieldChange{{Type: ChangeRemoved, Field: field, From: from}}
+	default:
+		return []FieldChange{{
+			Type:  ChangeModified,
+			Field: field,
+			From:  from,
+			To:    to,
+		}}
+	}
+}
+
+// diffMap compares two maps, reporting changes in a stable order. When keyed
+// is false, the key is not appended to the field name, which is useful for
+// diffing sets.
+func diffMap(field string, from, to map[string]string, keyed bool) []FieldChange {
+	keys := []string{}
+	for k := range from {
+		keys = append(keys, k)
+	}
+	for k := range to {
+		if _, ok := from[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := []FieldChange{}
+	for _, k := range keys {
+		name := field
+		if keyed {
+			name = fmt.Sprintf("%s.%s", field, k)
+		}
+
+		fromValue, inFrom := from[k]
+		toValue, inTo := to[k]
+		switch {
+		case !inFrom:
+			changes = append(changes, FieldChange{
+				Type: ChangeAdded, Field: name, To: toValue,
+			})
+		case !inTo:
+			changes = append(changes, FieldChange{
+				Type: ChangeRemoved, Field: name, From: fromValue,
+			})
+		case fromValue != toValue:
+			changes = append(changes, FieldChange{
+				Type: ChangeModified, Field: name, From: fromValue, To: toValue,
+			})
+		}
+	}
+
+	return changes
+}
+
+func diffProcess(previous, next *ServiceProcessConfig) ([]FieldChange, error) {
+	from, err := processPlanValues(previous)
+	if err != nil {
+		return nil, err
+	}
+	to, err := processPlanValues(next)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []FieldChange{}
+	changes = append(changes, diffValue("image", from.image, to.image)...)
+	changes = append(changes, diffValue("replicas", from.replicas, to.replicas)...)
+	changes = append(changes, diffValue("command", from.command, to.command)...)
+	changes = append(changes, diffMap("env", from.env, to.env, true)...)
+	changes = append(changes, diffMap("envFiles", from.envFiles, to.envFiles, false)...)
+	changes = append(changes, diffMap("secrets", from.secrets, to.secrets, true)...)
+	changes = append(changes, diffMap("mounts", from.mounts, to.mounts, true)...)
+	changes = append(changes, diffMap("ports", from.ports, to.ports, true)...)
+	changes = append(changes, diffMap("caddy.hostnames", from.hostnames, to.hostnames, false)...)
+	changes = append(changes, diffValue("caddy.path", from.path, to.path)...)
+
+	return changes, nil
+}
+
+// planService compares the config about to be deployed with the config of
+// the active deployment and the running containers of each process.
+func planService(
+	previous, next *ServiceConfig, liveReplicas map[string]int,
+) (*PlanResult, error) {
+	res := &PlanResult{
+		ServiceName:         next.Name,
+		Processes:           ProcessPlans{},
+		PreDeploymentTasks:  next.Callbacks.PreDeployment,
+		PostDeploymentTasks: next.Callbacks.PostDeployment,
+	}
+
+	for processName, process := range next.Processes {
+		process := process
+
+		var previousProcess *ServiceProcessConfig
+		if previous != nil {
+			if p, ok := previous.Processes[processName]; ok {
+				previousProcess = &p
+			}
+		}
+
+		action := PlanActionCreate
+		if previousProcess != nil || liveReplicas[processName] > 0 {
+			action = PlanActionReplace
+		}
+
+		changes, err := diffProcess(previousProcess, &process)
+		if err != nil {
+			return nil, fmt.Errorf("process %s: %w", processName, err)
+		}
+
+		res.Processes[processName] = ProcessPlan{
+			Action:       action,
+			LiveReplicas: liveReplicas[processName],
+			Changes:      changes,
+		}
+	}
+
+	// Find processes that have been deleted from the config
+	deletedProcesses := []string{}
+	for processName := range liveReplicas {
+		deletedProcesses = append(deletedProcesses, processName)
+	}
+	if previous != nil {
+		for processName := range previous.Processes {
+			deletedProcesses = append(deletedProcesses, processName)
+		}
+	}
+	for _, processName := range deletedProcesses {
+		if _, ok := next.Processes[processName]; ok {
+			continue
+		}
+
+		res.Processes[processName] = ProcessPlan{
+			Action:       PlanActionRemove,
+			LiveReplicas: liveReplicas[processName],
+			Changes:      []FieldChange{},
+		}
+	}
+
+	return res, nil
+}
+
+// Plan calculates the changes that deploying the current configuration of a
+// service would make, without making them.
+func (e *Engine) Plan(ctx context.Context, args PlanArgs) (*PlanResult, error) {
+	filePath := args.File
+	if filePath == "" {
+		filePath = path.Join(e.config.Paths.Config, args.ServiceName+".yaml")
+	}
+	svc, err := e.loadServiceConfigFile(args.ServiceName, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Tag != "" {
+		if err := svc.overrideImageTag(args.Tag); err != nil {
+			return nil, err
+		}
+	}
+
+	svcState, err := e.state.LoadServiceState(svc.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *ServiceConfig
+	if svcState.ActiveDeploymentID > 0 {
+		previous, err = e.loadDeploymentConfig(svc.Name, svcState.ActiveDeploymentID)
+		if err != nil {
+			e.log.Warn("could not load config of active deployment",
+				zap.String("service", svc.Name),
+				zap.Error(err),
+			)
+		}
+	}
+
+	containers, err := e.docker.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", fmt.Sprintf("%s=%s", serviceLabel, svc.Name)),
+			filters.Arg("label", processLabel),
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+	liveReplicas := map[string]int{}
+	for _, container := range containers {
+		liveReplicas[container.Labels[processLabel]]++
+	}
+
+	res, err := planService(previous, svc, liveReplicas)
+	if err != nil {
+		return nil, err
+	}
+	res.ActiveDeploymentID = svcState.ActiveDeploymentID
+
+	return res, nil
+}
@@ -0,0 +1,137 @@
+package guvnor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_diffMap(t *testing.T) {
+	got := diffMap(
+		"env",
+		map[string]string{"KEPT": "a", "CHANGED": "a", "REMOVED": "a"},
+		map[string]string{"KEPT": "a", "CHANGED": "b", "ADDED": "b"},
+		true,
+	)
+	assert.Equal(t, []FieldChange{
+		{Type: ChangeAdded, Field: "env.ADDED", To: "b"},
+		{Type: ChangeModified, Field: "env.CHANGED", From: "a", To: "b"},
+		{Type: ChangeRemoved, Field: "env.REMOVED", From: "a"},
+	}, got)
+}
+
+func Test_planService(t *testing.T) {
+	previous := &ServiceConfig{
+		Name: "fizz",
+		Defaults: ServiceDefaultsConfig{
+			Image:    "fizz",
+			ImageTag: "v1",
+			Env: map[string]string{
+				"RAILS_ENV": "production",
+			},
+		},
+		Processes: map[string]ServiceProcessConfig{
+			"web": {
+				name:     "web",
+				Quantity: 2,
+				Caddy: ProcessCaddyConfig{
+					Hostnames: []string{"a.example.com", "b.example.com"},
+				},
+			},
+			"cron": {
+				name: "cron",
+			},
+		},
+	}
+	previous.Processes["web"] = withParent(previous.Processes["web"], previous)
+	previous.Processes["cron"] = withParent(previous.Processes["cron"], previous)
+
+	next := &ServiceConfig{
+		Name: "fizz",
+		Defaults: ServiceDefaultsConfig{
+			Image:    "fizz",
+			ImageTag: "v2",
+			Env: map[string]string{
+				"RAILS_ENV": "production",
+			},
+		},
+		Processes: map[string]ServiceProcessConfig{
+			"web": {
+				name:     "web",
+				Quantity: 3,
+				Env: map[string]string{
+					"FOO": "bar",
+				},
+				EnvFiles: []string{"web.env"},
+				Secrets: map[string]SecretConfig{
+					"API_KEY": {File: "fizz/api_key"},
+				},
+				Mounts: []ServiceMountConfig{
+					{Host: "/host/data", Container: "/data"},
+				},
+				Ports: []ServicePortConfig{
+					{Name: "metrics", ContainerPort: 9090},
+				},
+				Caddy: ProcessCaddyConfig{
+					Hostnames: []string{"b.example.com", "c.example.com"},
+					Path:      "/web/*",
+				},
+			},
+			"worker": {
+				name:    "worker",
+				Command: []string{"rake", "worker"},
+			},
+		},
+		Callbacks: ServiceCallbacksConfig{
+			PreDeployment: []string{"migrate"},
+		},
+	}
+	next.Processes["web"] = withParent(next.Processes["web"], next)
+	next.Processes["worker"] = withParent(next.Processes["worker"], next)
+
+	got, err := planService(previous, next, map[string]int{"web": 2, "cron": 1})
+	require.NoError(t, err)
+
+	assert.Equal(t, &PlanResult{
+		ServiceName: "fizz",
+		Processes: ProcessPlans{
+			"web": {
+				Action:       PlanActionReplace,
+				LiveReplicas: 2,
+				Changes: []FieldChange{
+					{Type: ChangeModified, Field: "image", From: "fizz:v1", To: "fizz:v2"},
+					{Type: ChangeModified, Field: "replicas", From: "2", To: "3"},
+					{Type: ChangeAdded, Field: "env.FOO", To: "bar"},
+					{Type: ChangeAdded, Field: "envFiles", To: "web.env"},
+					{Type: ChangeAdded, Field: "secrets.API_KEY", To: "file fizz/api_key"},
+					{Type: ChangeAdded, Field: "mounts./data", To: "/host/data"},
+					{Type: ChangeAdded, Field: "ports.metrics", To: "127.0.0.1:auto->9090/tcp"},
+					{Type: ChangeRemoved, Field: "caddy.hostnames", From: "a.example.com"},
+					{Type: ChangeAdded, Field: "caddy.hostnames", To: "c.example.com"},
+					{Type: ChangeAdded, Field: "caddy.path", To: "/web/*"},
+				},
+			},
+			"cron": {
+				Action:       PlanActionRemove,
+				LiveReplicas: 1,
+				Changes:      []FieldChange{},
+			},
+			"worker": {
+				Action: PlanActionCreate,
+				Changes: []FieldChange{
+					{Type: ChangeAdded, Field: "image", To: "fizz:v2"},
+					{Type: ChangeAdded, Field: "replicas", To: "1"},
+					{Type: ChangeAdded, Field: "command", To: "rake worker"},
+					{Type: ChangeAdded, Field: "env.RAILS_ENV", To: "production"},
+				},
+			},
+		},
+		PreDeploymentTasks: []string{"migrate"},
+	}, got)
+}
+
+func withParent(spc ServiceProcessConfig, parent *ServiceConfig) ServiceProcessConfig {
+	spc.parent = parent
+	return spc
+}
@@ -0,0 +1,448 @@
+package guvnor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/go-connections/nat"
+	"github.com/krystal/guvnor/state"
+	"go.uber.org/zap"
+)
+
+type PortProtocol string
+
+var (
+	PortProtocolTCP PortProtocol = "tcp"
+	PortProtocolUDP PortProtocol = "udp"
+)
+
+var portNameRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// ServicePortConfig is an additional port exposed by the containers of a
+// process. The port the process should listen on is provided in the
+// PORT_<NAME> environment variable.
+type ServicePortConfig struct {
+	// Name identifies the port, and is used to name its environment
+	// variable.
+	Name string `yaml:"name" validate:"required"`
+	// Protocol is either tcp or udp, defaulting to tcp.
+	Protocol PortProtocol `yaml:"protocol,omitempty" validate:"omitempty,oneof=tcp udp"`
+	// ContainerPort is the port the process listens on inside the container.
+	// When unset, a free port is selected and used on both the host and in
+	// the container.
+	ContainerPort int `yaml:"containerPort,omitempty" validate:"gte=0,lte=65535"`
+	// HostIP is the address on the host to publish the port on, defaulting
+	// to the loopback address.
+	HostIP string `yaml:"hostIP,omitempty" validate:"omitempty,ip"`
+	// HostPort is a fixed port on the host to publish the port on. When
+	// unset, a free port is selected.
+	HostPort int `yaml:"hostPort,omitempty" validate:"gte=0,lte=65535"`
+}
+
+func (spc ServicePortConfig) GetProtocol() PortProtocol {
+	if spc.Protocol == "" {
+		return PortProtocolTCP
+	}
+
+	return spc.Protocol
+}
+
+func (spc ServicePortConfig) GetHostIP() string {
+	if spc.HostIP == "" {
+		return "127.0.0.1"
+	}
+
+	return spc.HostIP
+}
+
+// description summarises the port for display in a plan, e.g
+// "127.0.0.1:8080->9090/tcp". Ports that are selected automatically are
+// shown as "auto".
+func (spc ServicePortConfig) description() string {
+	hostPort, containerPort := "auto", "auto"
+	if spc.HostPort != 0 {
+		hostPort = strconv.Itoa(spc.HostPort)
+	}
+	if spc.ContainerPort != 0 {
+		containerPort = strconv.Itoa(spc.ContainerPort)
+	}
+
+	return fmt.Sprintf(
+		"%s:%s->%s/%s",
+		spc.GetHostIP(), hostPort, containerPort, spc.GetProtocol(),
+	)
+}
+
+// envName returns the name of the environment variable that contains the
+// port the process should listen on.
+func (spc ServicePortConfig) envName() string {
+	return fmt.Sprintf("PORT_%s", strings.ToUpper(spc.Name))
+}
+
+// overlaps reports whether two ports would be published on the same host
+// address.
+func (spc ServicePortConfig) overlaps(other ServicePortConfig) bool {
+	if spc.HostPort == 0 || spc.HostPort != other.HostPort {
+		return false
+	}
+	if spc.GetProtocol() != other.GetProtocol() {
+		return false
+	}
+
+	return hostIPsOverlap(spc.GetHostIP(), other.GetHostIP())
+}
+
+func hostIPsOverlap(a, b string) bool {
+	isAny := func(ip string) bool {
+		return ip == "" || ip == "0.0.0.0" || ip == "::"
+	}
+
+	return a == b || isAny(a) || isAny(b)
+}
+
+// validatePorts ensures the ports of a process are valid and cannot conflict
+// with each other as replicas are rolled out. hostNetwork is whether the
+// process uses the host network mode.
+func (spc ServiceProcessConfig) validatePorts(hostNetwork bool) error {
+	names := map[string]bool{}
+	for i, port := range spc.Ports {
+		if !portNameRegex.MatchString(port.Name) {
+			return fmt.Errorf(
+				"port name %q must start with a letter and only contain letters, numbers and underscores",
+				port.Name,
+			)
+		}
+		if names[port.envName()] {
+			return fmt.Errorf("port %s is defined more than once", port.Name)
+		}
+		names[port.envName()] = true
+
+		if hostNetwork && port.ContainerPort != 0 && port.HostPort != 0 &&
+			port.ContainerPort != port.HostPort {
+			return fmt.Errorf(
+				"port %s cannot map containerPort to a different hostPort with host networking",
+				port.Name,
+			)
+		}
+
+		if port.HostPort == 0 {
+			continue
+		}
+
+		if spc.GetQuantity() > 1 {
+			return fmt.Errorf(
+				"port %s has a fixed hostPort, so quantity cannot be greater than 1",
+				port.Name,
+			)
+		}
+		if spc.DeploymentStrategy != ReplaceStrategy {
+			return fmt.Errorf(
+				"port %s has a fixed hostPort, so the %s deployment strategy must be used",
+				port.Name,
+				ReplaceStrategy,
+			)
+		}
+
+		for _, other := range spc.Ports[:i] {
+			if port.overlaps(other) {
+				return fmt.Errorf(
+					"ports %s and %s use the same hostPort", other.Name, port.Name,
+				)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validatePorts ensures that no two processes publish the same fixed host
+// port.
+func (sc *ServiceConfig) validatePorts() error {
+	type processPort struct {
+		process string
+		port    ServicePortConfig
+	}
+	seen := []processPort{}
+
+	for _, processName := range sc.orderedProcessNames() {
+		process := sc.Processes[processName]
+		networkMode := sc.Defaults.Network.Mode
+		if process.Network.Mode != nil {
+			networkMode = process.Network.Mode
+		}
+		hostNetwork := networkMode != nil && *networkMode == NetworkModeHost
+		if err := process.validatePorts(hostNetwork); err != nil {
+			return withPath(
+				fmt.Errorf("process (%s) ports: %w", processName, err),
+				"processes", processName, "ports",
+			)
+		}
+
+		for i, port := range process.Ports {
+			for _, other := range seen {
+				if port.overlaps(other.port) {
+					return withPath(fmt.Errorf(
+						"process (%s) port %s uses the same hostPort as process (%s) port %s",
+						processName, port.Name, other.process, other.port.Name,
+					), "processes", processName, "ports", fmt.Sprintf("[%d]", i), "hostPort")
+				}
+			}
+			seen = append(seen, processPort{process: processName, port: port})
+		}
+	}
+
+	return nil
+}
+
+// resolvedPort is a port of a process with any free ports selected.
+type resolvedPort struct {
+	config        ServicePortConfig
+	containerPort string
+	hostPort      string
+}
+
+// resolvePorts selects the ports to use for a new container of a process.
+func resolvePorts(
+	ports []ServicePortConfig, hostNetwork bool, freePort func() (string, error),
+) ([]resolvedPort, error) {
+	resolved := make([]resolvedPort, 0, len(ports))
+	for _, port := range ports {
+		rp := resolvedPort{config: port}
+		if port.ContainerPort != 0 {
+			rp.containerPort = strconv.Itoa(port.ContainerPort)
+		}
+		if port.HostPort != 0 {
+			rp.hostPort = strconv.Itoa(port.HostPort)
+		}
+
+		switch {
+		case rp.containerPort == "" && rp.hostPort == "":
+			selected, err := freePort()
+			if err != nil {
+				return nil, err
+			}
+			rp.containerPort = selected
+			rp.hostPort = selected
+		case rp.containerPort == "":
+			rp.containerPort = rp.hostPort
+		case rp.hostPort == "" && hostNetwork:
+			rp.hostPort = rp.containerPort
+		case rp.hostPort == "":
+			selected, err := freePort()
+			if err != nil {
+				return nil, err
+			}
+			rp.hostPort = selected
+		}
+
+		resolved = append(resolved, rp)
+	}
+
+	return resolved, nil
+}
+
+func (rp resolvedPort) natPort() nat.Port {
+	return nat.Port(fmt.Sprintf("%s/%s", rp.containerPort, rp.config.GetProtocol()))
+}
+
+// ErrPortConflict is returned when a fixed host port of a process is already
+// published by another container.
+var ErrPortConflict = errors.New("port conflict")
+
+// checkPortConflicts ensures that the fixed host ports of the service are
+// not published by containers other than those of the same process, which
+// will be replaced during the deployment.
+func (e *Engine) checkPortConflicts(ctx context.Context, svc *ServiceConfig) error {
+	fixed := false
+	for _, process := range svc.Processes {
+		for _, port := range process.Ports {
+			fixed = fixed || port.HostPort != 0
+		}
+	}
+	if !fixed {
+		return nil
+	}
+
+	containers, err := e.docker.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("status", "running"),
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, processName := range svc.orderedProcessNames() {
+		process := svc.Processes[processName]
+		for _, port := range process.Ports {
+			if port.HostPort == 0 {
+				continue
+			}
+
+			runningProcess := false
+			for _, container := range containers {
+				// Containers of the process are about to be replaced, so the
+				// port may be held by them. Containers using the host
+				// network do not list the ports they listen on.
+				if container.Labels[serviceLabel] == svc.Name &&
+					container.Labels[processLabel] == processName {
+					runningProcess = true
+					continue
+				}
+
+				for _, published := range container.Ports {
+					if int(published.PublicPort) != port.HostPort ||
+						published.Type != string(port.GetProtocol()) ||
+						!hostIPsOverlap(published.IP, port.GetHostIP()) {
+						continue
+					}
+
+					return fmt.Errorf(
+						"%w: process (%s) port %s: %s:%d/%s is already published by container %s",
+						ErrPortConflict,
+						processName,
+						port.Name,
+						port.GetHostIP(),
+						port.HostPort,
+						port.GetProtocol(),
+						strings.TrimPrefix(container.Names[0], "/"),
+					)
+				}
+			}
+
+			// Catch listeners outside of Docker, unless the port may be held
+			// by a container of the process that is about to be replaced.
+			if runningProcess || port.GetProtocol() != PortProtocolTCP {
+				continue
+			}
+			inUse, err := hostPortInUse(port.GetHostIP(), port.HostPort)
+			if err != nil {
+				return fmt.Errorf(
+					"process (%s) port %s: checking %s:%d/%s on the host: %w",
+					processName,
+					port.Name,
+					port.GetHostIP(),
+					port.HostPort,
+					port.GetProtocol(),
+					err,
+				)
+			}
+			if inUse {
+				return fmt.Errorf(
+					"%w: process (%s) port %s: %s:%d/%s is already in use on the host",
+					ErrPortConflict,
+					processName,
+					port.Name,
+					port.GetHostIP(),
+					port.HostPort,
+					port.GetProtocol(),
+				)
+			}
+		}
+	}
+
+	return nil
+}
+
+// hostPortInUse reports whether another listener already holds a TCP port on
+// the host. Failures to bind for any other reason, such as the address not
+// belonging to the host, are returned as errors.
+func hostPortInUse(hostIP string, port int) (bool, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(hostIP, strconv.Itoa(port)))
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	l.Close()
+
+	return false, nil
+}
+
+// hostPortAvailable reports whether a port is free on every address of the
+// host, so that it can be allocated to a container. Ports that cannot be
+// bound for any reason are treated as unavailable.
+func hostPortAvailable(port int) bool {
+	inUse, err := hostPortInUse("", port)
+	return err == nil && !inUse
+}
+
+// allocatePort reserves a host port for a container from the configured range.
+// The allocation is recorded in the state store, so the port will not be
+// handed to another container until it has been released.
+func (e *Engine) allocatePort(serviceName, containerName string) (string, error) {
+	min, max := e.config.Ports.GetRange()
+	port, err := e.state.AllocatePort(min, max, state.PortAllocation{
+		Service:     serviceName,
+		Container:   containerName,
+		AllocatedAt: time.Now(),
+	}, hostPortAvailable)
+	if err != nil {
+		return "", fmt.Errorf("allocating port: %w", err)
+	}
+
+	return strconv.Itoa(port), nil
+}
+
+// releasePorts releases the ports allocated to containers of a service. Errors
+// are logged rather than returned, as any leftover allocations are released
+// during the next cleanup.
+func (e *Engine) releasePorts(serviceName string, containerNames ...string) {
+	if err := e.state.ReleasePorts(serviceName, containerNames); err != nil {
+		e.log.Warn("failed to release ports",
+			zap.String("service", serviceName),
+			zap.Strings("containers", containerNames),
+			zap.Error(err),
+		)
+	}
+}
+
+// releaseStalePorts releases the ports allocated to containers of a service
+// that no longer exist.
+func (e *Engine) releaseStalePorts(ctx context.Context, serviceName string) error {
+	allocs, err := e.state.ListPortAllocations()
+	if err != nil {
+		return err
+	}
+
+	containers, err := e.docker.ContainerList(ctx, types.ContainerListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", fmt.Sprintf("%s=%s", serviceLabel, serviceName)),
+		),
+	})
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for _, container := range containers {
+		for _, name := range container.Names {
+			existing[strings.TrimPrefix(name, "/")] = true
+		}
+	}
+
+	stale := []string{}
+	for _, alloc := range allocs {
+		if alloc.Service == serviceName && !existing[alloc.Container] {
+			stale = append(stale, alloc.Container)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	e.log.Debug("releasing ports of removed containers",
+		zap.String("service", serviceName),
+		zap.Strings("containers", stale),
+	)
+	return e.state.ReleasePorts(serviceName, stale)
+}
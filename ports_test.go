@@ -0,0 +1,465 @@
+package guvnor
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/go-playground/validator/v10"
+	"github.com/krystal/guvnor/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func Test_resolvePorts(t *testing.T) {
+	tests := []struct {
+		name        string
+		ports       []ServicePortConfig
+		hostNetwork bool
+		want        []resolvedPort
+	}{
+		{
+			name: "free port",
+			ports: []ServicePortConfig{
+				{Name: "metrics"},
+			},
+			want: []resolvedPort{
+				{
+					config:        ServicePortConfig{Name: "metrics"},
+					containerPort: "40000",
+					hostPort:      "40000",
+				},
+			},
+		},
+		{
+			name: "container port",
+			ports: []ServicePortConfig{
+				{Name: "admin", ContainerPort: 9000},
+			},
+			want: []resolvedPort{
+				{
+					config:        ServicePortConfig{Name: "admin", ContainerPort: 9000},
+					containerPort: "9000",
+					hostPort:      "40000",
+				},
+			},
+		},
+		{
+			name: "container port with host network",
+			ports: []ServicePortConfig{
+				{Name: "admin", ContainerPort: 9000},
+			},
+			hostNetwork: true,
+			want: []resolvedPort{
+				{
+					config:        ServicePortConfig{Name: "admin", ContainerPort: 9000},
+					containerPort: "9000",
+					hostPort:      "9000",
+				},
+			},
+		},
+		{
+			name: "host port",
+			ports: []ServicePortConfig{
+				{Name: "smtp", HostPort: 25},
+			},
+			want: []resolvedPort{
+				{
+					config:        ServicePortConfig{Name: "smtp", HostPort: 25},
+					containerPort: "25",
+					hostPort:      "25",
+				},
+			},
+		},
+		{
+			name: "container and host port",
+			ports: []ServicePortConfig{
+				{Name: "syslog", Protocol: PortProtocolUDP, ContainerPort: 5514, HostPort: 514},
+			},
+			want: []resolvedPort{
+				{
+					config: ServicePortConfig{
+						Name: "syslog", Protocol: PortProtocolUDP, ContainerPort: 5514, HostPort: 514,
+					},
+					containerPort: "5514",
+					hostPort:      "514",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			freePort := func() (string, error) { return "40000", nil }
+
+			got, err := resolvePorts(tt.ports, tt.hostNetwork, freePort)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_ServicePortConfig_description(t *testing.T) {
+	assert.Equal(t,
+		"127.0.0.1:auto->auto/tcp",
+		ServicePortConfig{Name: "metrics"}.description(),
+	)
+	assert.Equal(t,
+		"0.0.0.0:514->5514/udp",
+		ServicePortConfig{
+			Name:          "syslog",
+			Protocol:      PortProtocolUDP,
+			HostIP:        "0.0.0.0",
+			HostPort:      514,
+			ContainerPort: 5514,
+		}.description(),
+	)
+}
+
+func Test_hostPortInUse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+
+	inUse, err := hostPortInUse("127.0.0.1", port)
+	require.NoError(t, err)
+	assert.True(t, inUse)
+
+	require.NoError(t, l.Close())
+	inUse, err = hostPortInUse("127.0.0.1", port)
+	require.NoError(t, err)
+	assert.False(t, inUse)
+
+	// Addresses that do not belong to the host cannot be checked, so they
+	// must not be reported as free.
+	inUse, err = hostPortInUse("192.0.2.1", port)
+	assert.Error(t, err)
+	assert.False(t, inUse)
+}
+
+func Test_Engine_checkPortConflicts(t *testing.T) {
+	// The listener stands in for a process using the host network, which
+	// holds the port without Docker publishing it.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	svc := func(protocol PortProtocol) *ServiceConfig {
+		return &ServiceConfig{
+			Name: "fizz",
+			Processes: map[string]ServiceProcessConfig{
+				"web": {
+					Ports: []ServicePortConfig{
+						{Name: "app", Protocol: protocol, HostPort: port},
+					},
+				},
+			},
+		}
+	}
+	webContainer := types.Container{
+		Names: []string{"/fizz-1-web-0"},
+		Labels: map[string]string{
+			serviceLabel: "fizz",
+			processLabel: "web",
+		},
+	}
+	publishing := func(protocol PortProtocol) types.Container {
+		return types.Container{
+			Names: []string{"/buzz-1-web-0"},
+			Labels: map[string]string{
+				serviceLabel: "buzz",
+				processLabel: "web",
+			},
+			Ports: []types.Port{
+				{
+					IP:         "0.0.0.0",
+					PublicPort: uint16(port),
+					Type:       string(protocol),
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		svc        *ServiceConfig
+		containers []types.Container
+		wantErr    string
+	}{
+		{
+			name:       "same process on host network",
+			svc:        svc(PortProtocolTCP),
+			containers: []types.Container{webContainer},
+		},
+		{
+			name: "in use on host",
+			svc:  svc(PortProtocolTCP),
+			wantErr: "port conflict: process (web) port app: 127.0.0.1:" +
+				strconv.Itoa(port) + "/tcp is already in use on the host",
+		},
+		{
+			name: "published by another container",
+			svc:  svc(PortProtocolTCP),
+			containers: []types.Container{
+				webContainer, publishing(PortProtocolTCP),
+			},
+			wantErr: "port conflict: process (web) port app: 127.0.0.1:" +
+				strconv.Itoa(port) + "/tcp is already published by container " +
+				"buzz-1-web-0",
+		},
+		{
+			name:       "udp port",
+			svc:        svc(PortProtocolUDP),
+			containers: []types.Container{publishing(PortProtocolTCP)},
+		},
+		{
+			name:       "udp port published by another container",
+			svc:        svc(PortProtocolUDP),
+			containers: []types.Container{publishing(PortProtocolUDP)},
+			wantErr: "port conflict: process (web) port app: 127.0.0.1:" +
+				strconv.Itoa(port) + "/udp is already published by container " +
+				"buzz-1-web-0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Engine{docker: &fakeDockerClient{containers: tt.containers}}
+
+			err := e.checkPortConflicts(context.Background(), tt.svc)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.ErrorIs(t, err, ErrPortConflict)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_Engine_allocatePort(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+
+	log := zaptest.NewLogger(t)
+	e := &Engine{
+		log:    log,
+		config: EngineConfig{Ports: PortsConfig{Min: port, Max: port}},
+		state: &state.FileBasedStore{
+			RootPath: t.TempDir(),
+			Log:      log,
+		},
+	}
+
+	// The only port in the range is held by another listener
+	_, err = e.allocatePort("fizz", "fizz-1-web-0")
+	assert.ErrorIs(t, err, state.ErrNoFreePorts)
+
+	require.NoError(t, l.Close())
+	got, err := e.allocatePort("fizz", "fizz-1-web-0")
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(port), got)
+
+	// The port remains allocated until the container releases it
+	_, err = e.allocatePort("fizz", "fizz-1-web-1")
+	assert.ErrorIs(t, err, state.ErrNoFreePorts)
+
+	e.releasePorts("fizz", "fizz-1-web-0")
+	got, err = e.allocatePort("fizz", "fizz-1-web-1")
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(port), got)
+}
+
+func Test_PortsConfig_GetRange(t *testing.T) {
+	min, max := PortsConfig{}.GetRange()
+	assert.Equal(t, 20000, min)
+	assert.Equal(t, 29999, max)
+
+	min, max = PortsConfig{Min: 40000, Max: 40100}.GetRange()
+	assert.Equal(t, 40000, min)
+	assert.Equal(t, 40100, max)
+
+	assert.NoError(t, PortsConfig{Min: 25000}.Validate())
+	assert.EqualError(
+		t,
+		PortsConfig{Min: 35000}.Validate(),
+		"ports min (35000) must not exceed max (29999)",
+	)
+}
+
+func Test_Engine_parseServiceConfig_ports(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			config: `
+defaults:
+  image: foo
+processes:
+  web:
+    quantity: 2
+    ports:
+      - name: metrics
+      - name: admin
+        containerPort: 9000
+  mail:
+    deploymentStrategy: replace
+    ports:
+      - name: smtp
+        hostIP: 0.0.0.0
+        hostPort: 25
+      - name: syslog
+        protocol: udp
+        hostPort: 25
+`,
+		},
+		{
+			name: "invalid name",
+			config: `
+defaults:
+  image: foo
+processes:
+  web:
+    ports:
+      - name: my-metrics
+`,
+			wantErr: `process (web) ports: port name "my-metrics" must start ` +
+				`with a letter and only contain letters, numbers and underscores`,
+		},
+		{
+			name: "duplicate name",
+			config: `
+defaults:
+  image: foo
+processes:
+  web:
+    ports:
+      - name: metrics
+      - name: METRICS
+`,
+			wantErr: "process (web) ports: port METRICS is defined more than once",
+		},
+		{
+			name: "fixed host port with multiple replicas",
+			config: `
+defaults:
+  image: foo
+processes:
+  mail:
+    quantity: 2
+    deploymentStrategy: replace
+    ports:
+      - name: smtp
+        hostPort: 25
+`,
+			wantErr: "process (mail) ports: port smtp has a fixed hostPort, " +
+				"so quantity cannot be greater than 1",
+		},
+		{
+			name: "fixed host port with default strategy",
+			config: `
+defaults:
+  image: foo
+processes:
+  mail:
+    ports:
+      - name: smtp
+        hostPort: 25
+`,
+			wantErr: "process (mail) ports: port smtp has a fixed hostPort, " +
+				"so the replace deployment strategy must be used",
+		},
+		{
+			name: "different host port with host network",
+			config: `
+defaults:
+  image: foo
+  network:
+    mode: host
+processes:
+  web:
+    ports:
+      - name: admin
+        containerPort: 9000
+        hostPort: 9001
+`,
+			wantErr: "process (web) ports: port admin cannot map " +
+				"containerPort to a different hostPort with host networking",
+		},
+		{
+			name: "conflict between processes",
+			config: `
+defaults:
+  image: foo
+processes:
+  a:
+    deploymentStrategy: replace
+    ports:
+      - name: smtp
+        hostIP: 0.0.0.0
+        hostPort: 25
+  b:
+    deploymentStrategy: replace
+    ports:
+      - name: mail
+        hostPort: 25
+`,
+			wantErr: "process (b) port mail uses the same hostPort as " +
+				"process (a) port smtp",
+		},
+		{
+			name: "invalid protocol",
+			config: `
+defaults:
+  image: foo
+processes:
+  web:
+    ports:
+      - name: metrics
+        protocol: sctp
+`,
+			wantErr: "Key: 'ServiceConfig.Processes[web].Ports[0].Protocol' " +
+				"Error:Field validation for 'Protocol' failed on the 'oneof' tag",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Engine{validate: validator.New()}
+			_, err := e.parseServiceConfig("fizz", []byte(tt.config))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_hostIPsOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "127.0.0.1", b: "127.0.0.1", want: true},
+		{a: "127.0.0.1", b: "10.0.0.1", want: false},
+		{a: "0.0.0.0", b: "10.0.0.1", want: true},
+		{a: "10.0.0.1", b: "::", want: true},
+		{a: "", b: "10.0.0.1", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.want, hostIPsOverlap(tt.a, tt.b))
+		})
+	}
+}
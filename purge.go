@@ -9,7 +9,21 @@ import (
 )
 
 func (e *Engine) Purge(ctx context.Context) error {
-	e.log.Debug("purging all containers owned by guvnor")
+	// Hold the lock of every service so we do not pull containers out from
+	// under a deployment in progress.
+	services, err := e.state.ListServices()
+	if err != nil {
+		return err
+	}
+	for _, serviceName := range services {
+		lock, err := e.lockService(ctx, serviceName, LockOptions{})
+		if err != nil {
+			return err
+		}
+		defer e.unlockService(serviceName, lock)
+	}
+
+	e.log.Debug("purging all containers, networks and volumes owned by guvnor")
 	listToShutdown, err := e.docker.ContainerList(ctx, types.ContainerListOptions{
 		All: true,
 		Filters: filters.NewArgs(
@@ -37,5 +51,21 @@ func (e *Engine) Purge(ctx context.Context) error {
 		}
 	}
 
+	if err := e.purgeNetworks(ctx); err != nil {
+		return err
+	}
+
+	volumes, err := e.listManagedVolumes(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, volume := range volumes {
+		e.log.Debug("purging volume", zap.String("volume", volume.Name))
+
+		if err := e.docker.VolumeRemove(ctx, volume.Name, true); err != nil {
+			return err
+		}
+	}
+
 	return e.state.Purge()
 }
@@ -0,0 +1,48 @@
+package ready
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// randFloat64 is used to apply jitter to backoff intervals. It is a variable
+// so it can be replaced in tests.
+var randFloat64 = rand.Float64
+
+// Backoff configures an exponentially increasing interval between the
+// attempts of a check.
+type Backoff struct {
+	// Initial is the interval after the first attempt.
+	Initial time.Duration `yaml:"initial" validate:"required"`
+	// Multiplier is the factor the interval increases by after each attempt.
+	// It defaults to 2.
+	Multiplier float64 `yaml:"multiplier" validate:"omitempty,gte=1"`
+	// MaxInterval caps the interval between attempts. When zero, the interval
+	// is not capped.
+	MaxInterval time.Duration `yaml:"maxInterval"`
+	// Jitter is the fraction, between 0 and 1, that each interval is randomly
+	// adjusted by. This avoids many replicas being checked in lockstep.
+	Jitter float64 `yaml:"jitter" validate:"gte=0,lte=1"`
+}
+
+// interval returns the time to wait after the attempt with the given number,
+// starting at 1.
+func (b *Backoff) interval(attempt int) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+
+	interval := float64(b.Initial) * math.Pow(multiplier, float64(attempt-1))
+	if b.MaxInterval > 0 && interval > float64(b.MaxInterval) {
+		interval = float64(b.MaxInterval)
+	}
+
+	if b.Jitter > 0 {
+		// Adjust by a random amount within +/- Jitter
+		interval *= 1 + b.Jitter*(randFloat64()*2-1)
+	}
+
+	return time.Duration(interval)
+}
@@ -1,11 +1,18 @@
 package ready
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -18,13 +25,20 @@ type HTTPHeader struct {
 	Value string `yaml:"value"`
 }
 
+// maxBodySize is the maximum amount of a response body that will be read
+// when matching against it.
+const maxBodySize = 1024 * 1024
+
 type HTTPCheck struct {
 	// Host is the IP/Hostname + Port combination to connect to when making the
 	// request.
 	Host string `yaml:"-"`
 	// ExpectedStatus is the status code we expect the HTTP response to have.
-	// It defaults to 200.
+	// It defaults to 200 unless ExpectedStatuses is configured.
 	ExpectedStatus int `yaml:"expectedStatus"`
+	// ExpectedStatuses is a list of status codes or inclusive ranges of status
+	// codes (e.g "200-299") that are acceptable in addition to ExpectedStatus.
+	ExpectedStatuses []string `yaml:"expectedStatuses"`
 	// Path is the path that the HTTP request should be made to.
 	Path string `yaml:"path"`
 	// Headers is a slice of headers to attach to the HTTP request.
@@ -32,11 +46,110 @@ type HTTPCheck struct {
 	// Timeout is the amount of time to allow for the request, failing if the
 	// request takes longer. This defaults to 5 seconds.
 	Timeout time.Duration `yaml:"timeout"`
+	// BodyContains is a string that the response body must contain.
+	BodyContains string `yaml:"bodyContains"`
+	// BodyRegex is a regular expression that the response body must match.
+	BodyRegex string `yaml:"bodyRegex"`
+	// HTTPS controls whether the request should be made over TLS.
+	HTTPS bool `yaml:"https"`
+	// InsecureSkipVerify disables verification of the certificate presented
+	// when HTTPS is enabled.
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify"`
+}
+
+type statusRange struct {
+	min int
+	max int
+}
+
+func (sr statusRange) String() string {
+	if sr.min == sr.max {
+		return strconv.Itoa(sr.min)
+	}
+
+	return fmt.Sprintf("%d-%d", sr.min, sr.max)
+}
+
+func parseStatusRange(s string) (statusRange, error) {
+	minStr, maxStr, isRange := strings.Cut(s, "-")
+	if !isRange {
+		maxStr = minStr
+	}
+
+	min, err := strconv.Atoi(strings.TrimSpace(minStr))
+	if err != nil {
+		return statusRange{}, fmt.Errorf("invalid status %q", s)
+	}
+	max, err := strconv.Atoi(strings.TrimSpace(maxStr))
+	if err != nil {
+		return statusRange{}, fmt.Errorf("invalid status %q", s)
+	}
+	if min < 100 || max > 599 || min > max {
+		return statusRange{}, fmt.Errorf("invalid status %q", s)
+	}
+
+	return statusRange{min: min, max: max}, nil
+}
+
+// expectedStatuses returns the acceptable ranges of status codes.
+func (hc *HTTPCheck) expectedStatuses() ([]statusRange, error) {
+	ranges := []statusRange{}
+	if hc.ExpectedStatus != 0 {
+		ranges = append(ranges, statusRange{
+			min: hc.ExpectedStatus,
+			max: hc.ExpectedStatus,
+		})
+	}
+	for _, s := range hc.ExpectedStatuses {
+		sr, err := parseStatusRange(s)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, sr)
+	}
+
+	if len(ranges) == 0 {
+		ranges = append(ranges, statusRange{min: 200, max: 200})
+	}
+
+	return ranges, nil
+}
+
+// Validate ensures the expected statuses and body regex can be parsed.
+func (hc *HTTPCheck) Validate() error {
+	if _, err := hc.expectedStatuses(); err != nil {
+		return err
+	}
+
+	if hc.BodyRegex != "" {
+		if _, err := regexp.Compile(hc.BodyRegex); err != nil {
+			return fmt.Errorf("invalid body regex: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (hc *HTTPCheck) client() *http.Client {
+	if !hc.InsecureSkipVerify {
+		return http.DefaultClient
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: true,
+	}
+
+	return &http.Client{Transport: transport}
 }
 
 func (hc *HTTPCheck) Test(ctx context.Context) error {
+	scheme := "http"
+	if hc.HTTPS {
+		scheme = "https"
+	}
 	url := url.URL{
-		Scheme: "http",
+		Scheme: scheme,
 		Host:   hc.Host,
 		Path:   hc.Path,
 	}
@@ -46,9 +159,17 @@ func (hc *HTTPCheck) Test(ctx context.Context) error {
 		timeout = hc.Timeout
 	}
 
-	expectedStatus := 200
-	if hc.ExpectedStatus != 0 {
-		expectedStatus = hc.ExpectedStatus
+	expectedStatuses, err := hc.expectedStatuses()
+	if err != nil {
+		return err
+	}
+
+	var bodyRegex *regexp.Regexp
+	if hc.BodyRegex != "" {
+		bodyRegex, err = regexp.Compile(hc.BodyRegex)
+		if err != nil {
+			return fmt.Errorf("invalid body regex: %w", err)
+		}
 	}
 
 	var cancel func()
@@ -69,55 +190,344 @@ func (hc *HTTPCheck) Test(ctx context.Context) error {
 		req.Host = userSpecifiedHost
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	client := hc.client()
+	defer client.CloseIdleConnections()
+	res, err := client.Do(req)
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
 
-	if res.StatusCode != expectedStatus {
+	statusOK := false
+	wanted := make([]string, 0, len(expectedStatuses))
+	for _, sr := range expectedStatuses {
+		statusOK = statusOK || (res.StatusCode >= sr.min && res.StatusCode <= sr.max)
+		wanted = append(wanted, sr.String())
+	}
+	if !statusOK {
 		return fmt.Errorf(
-			"unexpected status code (wanted %d, got %d)",
-			expectedStatus,
+			"unexpected status code (wanted %s, got %d)",
+			strings.Join(wanted, ", "),
 			res.StatusCode,
 		)
 	}
 
+	if hc.BodyContains == "" && bodyRegex == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxBodySize))
+	if err != nil {
+		return err
+	}
+
+	if hc.BodyContains != "" && !bytes.Contains(body, []byte(hc.BodyContains)) {
+		return fmt.Errorf("response body does not contain %q", hc.BodyContains)
+	}
+	if bodyRegex != nil && !bodyRegex.Match(body) {
+		return fmt.Errorf("response body does not match %q", hc.BodyRegex)
+	}
+
+	return nil
+}
+
+type TCPCheck struct {
+	// Host is the IP/Hostname + Port combination to connect to.
+	Host string `yaml:"-"`
+	// Timeout is the amount of time to allow for the connection to be
+	// established. This defaults to 5 seconds.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (tc *TCPCheck) Test(ctx context.Context) error {
+	timeout := time.Second * 5
+	if tc.Timeout != 0 {
+		timeout = tc.Timeout
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", tc.Host)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// Execer runs a command inside a container, returning its exit code once it
+// has finished.
+type Execer interface {
+	Exec(ctx context.Context, containerID string, cmd []string) (int, error)
+}
+
+type ExecCheck struct {
+	// ContainerID is the container the command should be run inside.
+	ContainerID string `yaml:"-"`
+	// Execer is used to run the command inside the container.
+	Execer Execer `yaml:"-"`
+	// Command is the command to run. The check passes if it exits with a
+	// status code of zero.
+	Command []string `yaml:"command" validate:"required,min=1"`
+	// Timeout is the amount of time to allow for the command to finish. This
+	// defaults to 5 seconds.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (ec *ExecCheck) Test(ctx context.Context) error {
+	if ec.Execer == nil {
+		return errors.New("exec check has no execer configured")
+	}
+
+	timeout := time.Second * 5
+	if ec.Timeout != 0 {
+		timeout = ec.Timeout
+	}
+
+	var cancel func()
+	ctx, cancel = context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	exitCode, err := ec.Execer.Exec(ctx, ec.ContainerID, ec.Command)
+	if err != nil {
+		return err
+	}
+
+	if exitCode != 0 {
+		return fmt.Errorf("command exited with non-zero status (%d)", exitCode)
+	}
+
 	return nil
 }
 
+// Check is a ready check that is used to determine when a newly started
+// container is able to do work. Exactly one of HTTP, TCP or Exec should be
+// configured.
 type Check struct {
 	// Frequency is how often the check should be retried when we are trying to
-	// detect if the service comes online.
-	Frequency time.Duration `yaml:"frequency" validate:"required"`
+	// detect if the service comes online. Backoff can be configured instead
+	// to increase the interval between attempts.
+	Frequency time.Duration `yaml:"frequency" validate:"required_without=Backoff"`
+	Backoff   *Backoff      `yaml:"backoff"`
 	// Maximum is the maximum number of attempts to make before giving up on
 	// the service coming online.
-	Maximum int        `yaml:"maximum" validate:"required"`
-	HTTP    *HTTPCheck `yaml:"http" validate:"required"`
+	Maximum int `yaml:"maximum" validate:"required_without=Timeout,gte=0"`
+	// Timeout is the total amount of time to wait for the service to come
+	// online, as an alternative or in addition to Maximum.
+	Timeout time.Duration `yaml:"timeout" validate:"required_without=Maximum"`
+	// InitialDelay is how long to wait before making the first attempt, to
+	// allow the service time to boot.
+	InitialDelay time.Duration `yaml:"initialDelay"`
+	// SuccessThreshold is the number of consecutive attempts that must pass
+	// before the service is considered ready. It defaults to 1.
+	SuccessThreshold int `yaml:"successThreshold" validate:"gte=0"`
+
+	HTTP *HTTPCheck `yaml:"http"`
+	TCP  *TCPCheck  `yaml:"tcp"`
+	Exec *ExecCheck `yaml:"exec"`
+}
+
+var errCheckKind = errors.New(
+	"exactly one of http, tcp or exec check must be configured",
+)
+
+func (c *Check) successThreshold() int {
+	if c.SuccessThreshold == 0 {
+		return 1
+	}
+
+	return c.SuccessThreshold
+}
+
+// validateKind ensures exactly one kind of check has been configured.
+func (c *Check) validateKind() error {
+	configured := 0
+	if c.HTTP != nil {
+		configured++
+	}
+	if c.TCP != nil {
+		configured++
+	}
+	if c.Exec != nil {
+		configured++
+	}
+
+	if configured != 1 {
+		return errCheckKind
+	}
+
+	return nil
+}
+
+// Validate ensures exactly one kind of check has been configured and that its
+// options are valid.
+func (c *Check) Validate() error {
+	if err := c.validateKind(); err != nil {
+		return err
+	}
+
+	if c.Maximum > 0 && c.successThreshold() > c.Maximum {
+		return fmt.Errorf(
+			"success threshold (%d) cannot exceed maximum attempts (%d)",
+			c.successThreshold(),
+			c.Maximum,
+		)
+	}
+
+	if c.HTTP != nil {
+		return c.HTTP.Validate()
+	}
+
+	return nil
 }
 
 // Test runs a check
 func (c *Check) Test(ctx context.Context) error {
-	if c.HTTP == nil {
-		return errors.New("http check must be configured")
+	if err := c.validateKind(); err != nil {
+		return err
+	}
+
+	switch {
+	case c.TCP != nil:
+		return c.TCP.Test(ctx)
+	case c.Exec != nil:
+		return c.Exec.Test(ctx)
+	default:
+		return c.HTTP.Test(ctx)
+	}
+}
+
+// interval returns the time to wait after the attempt with the given number.
+func (c *Check) interval(attempt int) time.Duration {
+	if c.Backoff != nil {
+		return c.Backoff.interval(attempt)
 	}
 
-	return c.HTTP.Test(ctx)
+	return c.Frequency
+}
+
+// Attempt records the outcome of a single attempt of a check.
+type Attempt struct {
+	Number int
+	// Elapsed is how long after waiting began that the attempt finished.
+	Elapsed time.Duration
+	// Err is the reason the attempt failed, or nil if it passed.
+	Err error
+}
+
+// WaitError is returned by Wait when a check does not pass in time. It retains
+// the outcome of every attempt that was made.
+type WaitError struct {
+	// Reason describes why waiting stopped.
+	Reason   string
+	Attempts []Attempt
+}
+
+// Error summarises the attempts, grouping identical failures together in the
+// order they first occurred.
+func (we *WaitError) Error() string {
+	outcomes := []string{}
+	counts := map[string]int{}
+	for _, attempt := range we.Attempts {
+		outcome := "passed"
+		if attempt.Err != nil {
+			outcome = attempt.Err.Error()
+		}
+
+		if counts[outcome] == 0 {
+			outcomes = append(outcomes, outcome)
+		}
+		counts[outcome]++
+	}
+
+	summary := make([]string, 0, len(outcomes))
+	for _, outcome := range outcomes {
+		summary = append(summary, fmt.Sprintf("%s (x%d)", outcome, counts[outcome]))
+	}
+
+	return fmt.Sprintf(
+		"%s after %d attempts: %s",
+		we.Reason,
+		len(we.Attempts),
+		strings.Join(summary, "; "),
+	)
+}
+
+// Unwrap returns the error of the last failed attempt.
+func (we *WaitError) Unwrap() error {
+	for i := len(we.Attempts) - 1; i >= 0; i-- {
+		if we.Attempts[i].Err != nil {
+			return we.Attempts[i].Err
+		}
+	}
+
+	return nil
 }
 
-// Wait will provide a way to run a check continously until it passes or the
-// maximum try threshold is passed.
+// Wait will provide a way to run a check continously until it passes
+// SuccessThreshold times in a row, or the maximum try threshold or timeout is
+// passed.
 func (c *Check) Wait(ctx context.Context, log *zap.Logger) error {
-	t := time.NewTicker(c.Frequency)
-	defer t.Stop()
+	start := time.Now()
+	waitCtx := ctx
+	// deadline is only closed when the overall timeout is reached, and will
+	// block forever when there is no timeout.
+	var deadline <-chan struct{}
+	if c.Timeout > 0 {
+		var cancel func()
+		waitCtx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+		deadline = waitCtx.Done()
+	}
+	timedOut := func(attempts []Attempt) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return &WaitError{
+			Reason:   fmt.Sprintf("timed out after %s", c.Timeout),
+			Attempts: attempts,
+		}
+	}
+
+	if c.InitialDelay > 0 {
+		log.Debug("waiting initial delay before first attempt",
+			zap.Duration("initialDelay", c.InitialDelay),
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return timedOut(nil)
+		case <-time.After(c.InitialDelay):
+		}
+	}
 
 	log.Debug("waiting for ready check to pass")
-	var err error
-	for attempt := 1; attempt <= c.Maximum; attempt++ {
-		err = c.Test(ctx)
+	attempts := []Attempt{}
+	successes := 0
+	for attempt := 1; c.Maximum == 0 || attempt <= c.Maximum; attempt++ {
+		err := c.Test(waitCtx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		attempts = append(attempts, Attempt{
+			Number:  attempt,
+			Elapsed: time.Since(start),
+			Err:     err,
+		})
+
 		if err == nil {
-			log.Debug("attempt passed", zap.Int("attempt", attempt))
-			return nil
+			successes++
+			log.Debug("attempt passed",
+				zap.Int("attempt", attempt),
+				zap.Int("successes", successes),
+				zap.Int("successThreshold", c.successThreshold()),
+			)
+			if successes >= c.successThreshold() {
+				return nil
+			}
 		} else {
+			successes = 0
 			log.Debug("attempt failed",
 				zap.Int("attempt", attempt),
 				zap.Int("maxAttempts", c.Maximum),
@@ -125,12 +535,21 @@ func (c *Check) Wait(ctx context.Context, log *zap.Logger) error {
 			)
 		}
 
+		if attempt == c.Maximum {
+			break
+		}
+
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-t.C:
+		case <-deadline:
+			return timedOut(attempts)
+		case <-time.After(c.interval(attempt)):
 		}
 	}
 
-	return fmt.Errorf("exhausted retry count: %w", err)
+	return &WaitError{
+		Reason:   "exhausted retry count",
+		Attempts: attempts,
+	}
 }
@@ -2,13 +2,17 @@ package ready
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
 )
 
 func TestHTTPCheck_Test(t *testing.T) {
@@ -18,6 +22,8 @@ func TestHTTPCheck_Test(t *testing.T) {
 
 		hc         *HTTPCheck
 		sendStatus int
+		sendBody   string
+		tls        bool
 	}{
 		{
 			name: "success",
@@ -51,12 +57,78 @@ func TestHTTPCheck_Test(t *testing.T) {
 			wantError:  "unexpected status code (wanted 200, got 500)",
 			sendStatus: 500,
 		},
+		{
+			name: "status range",
+			hc: &HTTPCheck{
+				ExpectedStatuses: []string{"200-299", "301"},
+				Path:             "/",
+			},
+			sendStatus: 204,
+		},
+		{
+			name: "status range failure",
+			hc: &HTTPCheck{
+				ExpectedStatus:   200,
+				ExpectedStatuses: []string{"300-399"},
+				Path:             "/",
+			},
+			wantError:  "unexpected status code (wanted 200, 300-399, got 404)",
+			sendStatus: 404,
+		},
+		{
+			name: "body contains",
+			hc: &HTTPCheck{
+				Path:         "/",
+				BodyContains: `"status":"ok"`,
+			},
+			sendStatus: 200,
+			sendBody:   `{"status":"ok"}`,
+		},
+		{
+			name: "body contains failure",
+			hc: &HTTPCheck{
+				Path:         "/",
+				BodyContains: `"status":"ok"`,
+			},
+			wantError:  `response body does not contain "\"status\":\"ok\""`,
+			sendStatus: 200,
+			sendBody:   `{"status":"booting"}`,
+		},
+		{
+			name: "body regex",
+			hc: &HTTPCheck{
+				Path:      "/",
+				BodyRegex: `^ready \d+$`,
+			},
+			sendStatus: 200,
+			sendBody:   "ready 3",
+		},
+		{
+			name: "body regex failure",
+			hc: &HTTPCheck{
+				Path:      "/",
+				BodyRegex: `^ready \d+$`,
+			},
+			wantError:  `response body does not match "^ready \\d+$"`,
+			sendStatus: 200,
+			sendBody:   "not ready",
+		},
+		{
+			name: "https",
+			hc: &HTTPCheck{
+				Path:               "/",
+				HTTPS:              true,
+				InsecureSkipVerify: true,
+			},
+			sendStatus: 200,
+			tls:        true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.Background()
-			srv := httptest.NewServer(http.HandlerFunc(
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(
 				func(rw http.ResponseWriter, r *http.Request) {
 					assert.Equal(t, tt.hc.Path, r.URL.Path)
 
@@ -69,8 +141,15 @@ func TestHTTPCheck_Test(t *testing.T) {
 					}
 
 					rw.WriteHeader(tt.sendStatus)
+					_, err := rw.Write([]byte(tt.sendBody))
+					assert.NoError(t, err)
 				},
 			))
+			if tt.tls {
+				srv.StartTLS()
+			} else {
+				srv.Start()
+			}
 			defer srv.Close()
 
 			srvUrl, err := url.Parse(srv.URL)
@@ -86,3 +165,330 @@ func TestHTTPCheck_Test(t *testing.T) {
 		})
 	}
 }
+
+func TestTCPCheck_Test(t *testing.T) {
+	ctx := context.Background()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tc := &TCPCheck{Host: l.Addr().String()}
+	assert.NoError(t, tc.Test(ctx))
+
+	require.NoError(t, l.Close())
+	assert.Error(t, tc.Test(ctx))
+}
+
+type fakeExecer struct {
+	containerID string
+	cmd         []string
+	exitCode    int
+	err         error
+}
+
+func (fe *fakeExecer) Exec(
+	ctx context.Context, containerID string, cmd []string,
+) (int, error) {
+	fe.containerID = containerID
+	fe.cmd = cmd
+
+	return fe.exitCode, fe.err
+}
+
+func TestExecCheck_Test(t *testing.T) {
+	tests := []struct {
+		name      string
+		execer    *fakeExecer
+		wantError string
+	}{
+		{
+			name:   "success",
+			execer: &fakeExecer{},
+		},
+		{
+			name:      "non-zero exit",
+			execer:    &fakeExecer{exitCode: 3},
+			wantError: "command exited with non-zero status (3)",
+		},
+		{
+			name:      "exec error",
+			execer:    &fakeExecer{err: errors.New("no such container")},
+			wantError: "no such container",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &ExecCheck{
+				ContainerID: "abc123",
+				Execer:      tt.execer,
+				Command:     []string{"pg_isready"},
+			}
+
+			err := ec.Test(context.Background())
+			if tt.wantError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantError)
+			}
+			assert.Equal(t, "abc123", tt.execer.containerID)
+			assert.Equal(t, []string{"pg_isready"}, tt.execer.cmd)
+		})
+	}
+}
+
+func TestCheck_Test(t *testing.T) {
+	tests := []struct {
+		name      string
+		check     *Check
+		wantError string
+	}{
+		{
+			name: "exec",
+			check: &Check{
+				Exec: &ExecCheck{Execer: &fakeExecer{exitCode: 1}},
+			},
+			wantError: "command exited with non-zero status (1)",
+		},
+		{
+			name:      "none",
+			check:     &Check{},
+			wantError: "exactly one of http, tcp or exec check must be configured",
+		},
+		{
+			name: "multiple",
+			check: &Check{
+				HTTP: &HTTPCheck{},
+				TCP:  &TCPCheck{},
+			},
+			wantError: "exactly one of http, tcp or exec check must be configured",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.check.Test(context.Background())
+			assert.EqualError(t, err, tt.wantError)
+		})
+	}
+}
+
+func TestHTTPCheck_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		hc        *HTTPCheck
+		wantError string
+	}{
+		{
+			name: "valid",
+			hc: &HTTPCheck{
+				ExpectedStatuses: []string{"200", "300-399"},
+				BodyRegex:        "ok",
+			},
+		},
+		{
+			name:      "inverted range",
+			hc:        &HTTPCheck{ExpectedStatuses: []string{"299-200"}},
+			wantError: `invalid status "299-200"`,
+		},
+		{
+			name:      "not a number",
+			hc:        &HTTPCheck{ExpectedStatuses: []string{"2xx"}},
+			wantError: `invalid status "2xx"`,
+		},
+		{
+			name:      "invalid regex",
+			hc:        &HTTPCheck{BodyRegex: "("},
+			wantError: "invalid body regex: error parsing regexp: missing closing ): `(`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.hc.Validate()
+			if tt.wantError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantError)
+			}
+		})
+	}
+}
+
+// sequenceExecer returns the next exit code from a sequence on each call.
+type sequenceExecer struct {
+	exitCodes []int
+	calls     int
+}
+
+func (se *sequenceExecer) Exec(
+	ctx context.Context, containerID string, cmd []string,
+) (int, error) {
+	code := se.exitCodes[se.calls]
+	se.calls++
+
+	return code, nil
+}
+
+func TestCheck_Wait(t *testing.T) {
+	tests := []struct {
+		name             string
+		exitCodes        []int
+		successThreshold int
+		wantCalls        int
+		wantError        string
+	}{
+		{
+			name:      "passes first attempt",
+			exitCodes: []int{0},
+			wantCalls: 1,
+		},
+		{
+			name:      "passes eventually",
+			exitCodes: []int{1, 1, 0},
+			wantCalls: 3,
+		},
+		{
+			name:             "consecutive successes",
+			exitCodes:        []int{0, 1, 0, 0, 0},
+			successThreshold: 3,
+			wantCalls:        5,
+		},
+		{
+			name:      "never passes",
+			exitCodes: []int{1, 1, 1, 1, 1},
+			wantCalls: 5,
+			wantError: "exhausted retry count after 5 attempts: command exited with non-zero status (1) (x5)",
+		},
+		{
+			name:             "too few consecutive successes",
+			exitCodes:        []int{1, 1, 1, 0, 0},
+			successThreshold: 3,
+			wantCalls:        5,
+			wantError:        "exhausted retry count after 5 attempts: command exited with non-zero status (1) (x3); passed (x2)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			execer := &sequenceExecer{exitCodes: tt.exitCodes}
+			check := &Check{
+				Frequency:        time.Millisecond,
+				Maximum:          5,
+				InitialDelay:     time.Millisecond,
+				SuccessThreshold: tt.successThreshold,
+				Exec:             &ExecCheck{Execer: execer},
+			}
+
+			err := check.Wait(context.Background(), zaptest.NewLogger(t))
+			if tt.wantError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantError)
+			}
+			assert.Equal(t, tt.wantCalls, execer.calls)
+		})
+	}
+}
+
+// slowExecer fails every attempt, taking the given duration to do so.
+type slowExecer struct {
+	duration time.Duration
+}
+
+func (se *slowExecer) Exec(
+	ctx context.Context, containerID string, cmd []string,
+) (int, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-time.After(se.duration):
+		return 1, nil
+	}
+}
+
+func TestCheck_Wait_timeout(t *testing.T) {
+	check := &Check{
+		Timeout: 50 * time.Millisecond,
+		Backoff: &Backoff{Initial: 5 * time.Millisecond},
+		Exec:    &ExecCheck{Execer: &slowExecer{duration: 10 * time.Millisecond}},
+	}
+
+	err := check.Wait(context.Background(), zaptest.NewLogger(t))
+	waitErr := &WaitError{}
+	require.ErrorAs(t, err, &waitErr)
+	assert.Equal(t, "timed out after 50ms", waitErr.Reason)
+	assert.NotEmpty(t, waitErr.Attempts)
+	for i, attempt := range waitErr.Attempts {
+		assert.Equal(t, i+1, attempt.Number)
+		assert.Error(t, attempt.Err)
+	}
+
+	// The last attempt error is available for inspection
+	lastErr := waitErr.Attempts[len(waitErr.Attempts)-1].Err
+	assert.ErrorIs(t, err, lastErr)
+}
+
+func TestCheck_Wait_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	check := &Check{
+		Frequency: time.Millisecond,
+		Timeout:   time.Minute,
+		Exec:      &ExecCheck{Execer: &fakeExecer{exitCode: 1}},
+	}
+
+	err := check.Wait(ctx, zaptest.NewLogger(t))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestBackoff_interval(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff *Backoff
+		want    []time.Duration
+	}{
+		{
+			name:    "defaults",
+			backoff: &Backoff{Initial: time.Second},
+			want: []time.Duration{
+				time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+			},
+		},
+		{
+			name: "multiplier and cap",
+			backoff: &Backoff{
+				Initial:     time.Second,
+				Multiplier:  3,
+				MaxInterval: 5 * time.Second,
+			},
+			want: []time.Duration{
+				time.Second, 3 * time.Second, 5 * time.Second, 5 * time.Second,
+			},
+		},
+		{
+			name: "jitter",
+			backoff: &Backoff{
+				Initial: time.Second,
+				Jitter:  0.5,
+			},
+			// randFloat64 is fixed at 0.75, adjusting intervals by +25%
+			want: []time.Duration{
+				1250 * time.Millisecond, 2500 * time.Millisecond,
+			},
+		},
+	}
+
+	defer func(original func() float64) { randFloat64 = original }(randFloat64)
+	randFloat64 = func() float64 { return 0.75 }
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []time.Duration{}
+			for attempt := 1; attempt <= len(tt.want); attempt++ {
+				got = append(got, tt.backoff.interval(attempt))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package guvnor
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const redactedValue = "[redacted]"
+
+// redactor tracks the values of secrets that have been read, so they can be
+// removed from anything that is logged.
+type redactor struct {
+	mu     sync.RWMutex
+	values map[string]struct{}
+}
+
+func newRedactor() *redactor {
+	return &redactor{values: map[string]struct{}{}}
+}
+
+// add registers a value to be redacted. Values that are too short to be
+// meaningful are ignored, as they would otherwise mangle unrelated output.
+func (r *redactor) add(value string) {
+	if r == nil || len(value) < 4 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[value] = struct{}{}
+}
+
+func (r *redactor) redact(s string) string {
+	if r == nil {
+		return s
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for value := range r.values {
+		s = strings.ReplaceAll(s, value, redactedValue)
+	}
+
+	return s
+}
+
+// redactFields replaces the registered values within string and error fields.
+func (r *redactor) redactFields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, 0, len(fields))
+	for _, field := range fields {
+		switch field.Type {
+		case zapcore.StringType:
+			field.String = r.redact(field.String)
+		case zapcore.ErrorType:
+			if err, ok := field.Interface.(error); ok {
+				field = zap.NamedError(field.Key, errors.New(r.redact(err.Error())))
+			}
+		}
+		out = append(out, field)
+	}
+
+	return out
+}
+
+// redactingCore wraps a zapcore.Core, redacting the values of secrets from the
+// message and fields of every entry.
+type redactingCore struct {
+	zapcore.Core
+	redactor *redactor
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{
+		Core:     c.Core.With(c.redactor.redactFields(fields)),
+		redactor: c.redactor,
+	}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+
+	return ce
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.redactor.redact(entry.Message)
+	return c.Core.Write(entry, c.redactor.redactFields(fields))
+}
+
+// withRedaction returns a logger that redacts any values registered with the
+// redactor.
+func withRedaction(log *zap.Logger, r *redactor) *zap.Logger {
+	return log.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &redactingCore{Core: core, redactor: r}
+	}))
+}
@@ -0,0 +1,40 @@
+package guvnor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_withRedaction(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	r := newRedactor()
+	log := withRedaction(zap.New(core), r)
+
+	r.add("hunter2")
+	// Short values are not redacted, as they would mangle unrelated output
+	r.add("abc")
+
+	log.With(zap.String("password", "hunter2")).Info(
+		"connecting with hunter2",
+		zap.String("dsn", "postgres://app:hunter2@db/app"),
+		zap.NamedError("cause", errors.New("auth failed for hunter2")),
+		zap.Int("attempt", 1),
+		zap.String("name", "abc"),
+	)
+
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "connecting with [redacted]", entries[0].Message)
+	assert.Equal(t, map[string]interface{}{
+		"password": "[redacted]",
+		"dsn":      "postgres://app:[redacted]@db/app",
+		"cause":    "auth failed for [redacted]",
+		"attempt":  int64(1),
+		"name":     "abc",
+	}, entries[0].ContextMap())
+}
@@ -0,0 +1,123 @@
+package guvnor
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+)
+
+type UlimitConfig struct {
+	Soft int64 `yaml:"soft"`
+	Hard int64 `yaml:"hard"`
+}
+
+// ResourcesConfig constrains the host resources a container may use. Unset
+// values are unconstrained.
+type ResourcesConfig struct {
+	// Memory is the hard memory limit of the container, e.g "512m" or "2g".
+	Memory string `yaml:"memory,omitempty"`
+	// MemoryReservation is a soft memory limit that the container is pushed
+	// back towards when the host is low on memory.
+	MemoryReservation string `yaml:"memoryReservation,omitempty"`
+	// CPUs is the number of CPUs the container may use, e.g 0.5.
+	CPUs float64 `yaml:"cpus,omitempty" validate:"gte=0"`
+	// CPUShares is the relative weight of the container when CPU is
+	// contended. Docker defaults this to 1024.
+	CPUShares int64 `yaml:"cpuShares,omitempty" validate:"gte=0"`
+	// PidsLimit is the maximum number of processes in the container.
+	PidsLimit int64 `yaml:"pidsLimit,omitempty" validate:"gte=0"`
+	// Ulimits is a map of ulimit name (e.g nofile) to limits.
+	Ulimits map[string]UlimitConfig `yaml:"ulimits,omitempty"`
+}
+
+// mergeResources merges the provided resources, with values set in later
+// configs taking precedence. Ulimits are merged by name.
+func mergeResources(toMerge ...ResourcesConfig) ResourcesConfig {
+	out := ResourcesConfig{}
+	for _, rc := range toMerge {
+		if rc.Memory != "" {
+			out.Memory = rc.Memory
+		}
+		if rc.MemoryReservation != "" {
+			out.MemoryReservation = rc.MemoryReservation
+		}
+		if rc.CPUs != 0 {
+			out.CPUs = rc.CPUs
+		}
+		if rc.CPUShares != 0 {
+			out.CPUShares = rc.CPUShares
+		}
+		if rc.PidsLimit != 0 {
+			out.PidsLimit = rc.PidsLimit
+		}
+		for name, ulimit := range rc.Ulimits {
+			if out.Ulimits == nil {
+				out.Ulimits = map[string]UlimitConfig{}
+			}
+			out.Ulimits[name] = ulimit
+		}
+	}
+
+	return out
+}
+
+// Validate ensures memory sizes and ulimits can be parsed and are consistent.
+func (rc ResourcesConfig) Validate() error {
+	_, err := rc.dockerResources()
+	return err
+}
+
+func (rc ResourcesConfig) dockerResources() (container.Resources, error) {
+	res := container.Resources{
+		NanoCPUs:  int64(rc.CPUs * 1e9),
+		CPUShares: rc.CPUShares,
+	}
+
+	if rc.Memory != "" {
+		memory, err := units.RAMInBytes(rc.Memory)
+		if err != nil {
+			return res, fmt.Errorf("invalid memory: %w", err)
+		}
+		res.Memory = memory
+	}
+	if rc.MemoryReservation != "" {
+		reservation, err := units.RAMInBytes(rc.MemoryReservation)
+		if err != nil {
+			return res, fmt.Errorf("invalid memoryReservation: %w", err)
+		}
+		res.MemoryReservation = reservation
+	}
+	if res.Memory > 0 && res.MemoryReservation > res.Memory {
+		return res, fmt.Errorf(
+			"memoryReservation (%s) must not exceed memory (%s)",
+			rc.MemoryReservation,
+			rc.Memory,
+		)
+	}
+
+	if rc.PidsLimit != 0 {
+		pidsLimit := rc.PidsLimit
+		res.PidsLimit = &pidsLimit
+	}
+
+	names := make([]string, 0, len(rc.Ulimits))
+	for name := range rc.Ulimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		limit := rc.Ulimits[name]
+		// ParseUlimit validates the name and that soft does not exceed hard
+		ulimit, err := units.ParseUlimit(
+			fmt.Sprintf("%s=%d:%d", name, limit.Soft, limit.Hard),
+		)
+		if err != nil {
+			return res, fmt.Errorf("invalid ulimit: %w", err)
+		}
+		res.Ulimits = append(res.Ulimits, ulimit)
+	}
+
+	return res, nil
+}
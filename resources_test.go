@@ -0,0 +1,180 @@
+package guvnor
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ResourcesConfig_dockerResources(t *testing.T) {
+	pidsLimit := int64(200)
+
+	tests := []struct {
+		name    string
+		rc      ResourcesConfig
+		want    container.Resources
+		wantErr string
+	}{
+		{
+			name: "empty",
+			rc:   ResourcesConfig{},
+			want: container.Resources{},
+		},
+		{
+			name: "all",
+			rc: ResourcesConfig{
+				Memory:            "1g",
+				MemoryReservation: "512m",
+				CPUs:              1.5,
+				CPUShares:         512,
+				PidsLimit:         200,
+				Ulimits: map[string]UlimitConfig{
+					"nproc":  {Soft: 64, Hard: 128},
+					"nofile": {Soft: 1024, Hard: 2048},
+				},
+			},
+			want: container.Resources{
+				Memory:            1024 * 1024 * 1024,
+				MemoryReservation: 512 * 1024 * 1024,
+				NanoCPUs:          1500000000,
+				CPUShares:         512,
+				PidsLimit:         &pidsLimit,
+				Ulimits: []*units.Ulimit{
+					{Name: "nofile", Soft: 1024, Hard: 2048},
+					{Name: "nproc", Soft: 64, Hard: 128},
+				},
+			},
+		},
+		{
+			name:    "invalid memory",
+			rc:      ResourcesConfig{Memory: "lots"},
+			wantErr: "invalid memory: invalid size: 'lots'",
+		},
+		{
+			name: "reservation exceeds memory",
+			rc: ResourcesConfig{
+				Memory:            "256m",
+				MemoryReservation: "1g",
+			},
+			wantErr: "memoryReservation (1g) must not exceed memory (256m)",
+		},
+		{
+			name: "unknown ulimit",
+			rc: ResourcesConfig{
+				Ulimits: map[string]UlimitConfig{
+					"fizz": {Soft: 1, Hard: 1},
+				},
+			},
+			wantErr: "invalid ulimit: invalid ulimit type: fizz",
+		},
+		{
+			name: "ulimit soft exceeds hard",
+			rc: ResourcesConfig{
+				Ulimits: map[string]UlimitConfig{
+					"nofile": {Soft: 2048, Hard: 1024},
+				},
+			},
+			wantErr: "invalid ulimit: ulimit soft limit must be less than or " +
+				"equal to hard limit: 2048 > 1024",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rc.dockerResources()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_Engine_parseServiceConfig_resources(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			config: `
+defaults:
+  image: foo
+  resources:
+    memory: 512m
+    cpus: 0.5
+processes:
+  web:
+    resources:
+      memoryReservation: 256m
+      ulimits:
+        nofile:
+          soft: 1024
+          hard: 2048
+tasks:
+  migrate:
+    resources:
+      pidsLimit: 50
+`,
+		},
+		{
+			name: "process reservation exceeds default memory",
+			config: `
+defaults:
+  image: foo
+  resources:
+    memory: 512m
+processes:
+  web:
+    resources:
+      memoryReservation: 1g
+`,
+			wantErr: "process (web) resources: memoryReservation (1g) must " +
+				"not exceed memory (512m)",
+		},
+		{
+			name: "invalid task memory",
+			config: `
+defaults:
+  image: foo
+tasks:
+  migrate:
+    resources:
+      memory: lots
+`,
+			wantErr: "task (migrate) resources: invalid memory: invalid " +
+				"size: 'lots'",
+		},
+		{
+			name: "negative cpus",
+			config: `
+defaults:
+  image: foo
+  resources:
+    cpus: -1
+`,
+			wantErr: "Key: 'ServiceConfig.Defaults.Resources.CPUs' Error:" +
+				"Field validation for 'CPUs' failed on the 'gte' tag",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Engine{validate: validator.New()}
+			_, err := e.parseServiceConfig("fizz", []byte(tt.config))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
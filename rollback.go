@@ -0,0 +1,262 @@
+package guvnor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/krystal/guvnor/state"
+	"go.uber.org/zap"
+)
+
+var ErrNoRollbackTarget = errors.New(
+	"no previous successful deployment found to roll back to",
+)
+
+type RollbackArgs struct {
+	ServiceName string
+	// DeploymentID is the deployment to restore. When zero, the most recent
+	// successful deployment before the current one is used.
+	DeploymentID int
+	Lock         LockOptions
+}
+
+type RollbackResult struct {
+	ServiceName  string
+	DeploymentID int
+	// RolledBackTo is the ID of the deployment that has been restored.
+	RolledBackTo int
+}
+
+// findRollbackTarget selects the deployment from the history that should be
+// restored.
+func findRollbackTarget(
+	deployments []state.Deployment, currentID int, wantID int,
+) (*state.Deployment, error) {
+	if wantID != 0 {
+		for _, deployment := range deployments {
+			if deployment.ID != wantID {
+				continue
+			}
+
+			if deployment.Status != state.StatusSuccess {
+				return nil, fmt.Errorf(
+					"deployment %d did not succeed, refusing to roll back to it",
+					wantID,
+				)
+			}
+
+			return &deployment, nil
+		}
+
+		return nil, fmt.Errorf(
+			"deployment %d: %w", wantID, state.ErrDeploymentNotFound,
+		)
+	}
+
+	var target *state.Deployment
+	for i, deployment := range deployments {
+		if deployment.ID >= currentID {
+			continue
+		}
+		if deployment.Status != state.StatusSuccess {
+			continue
+		}
+		if target == nil || deployment.ID > target.ID {
+			target = &deployments[i]
+		}
+	}
+
+	if target == nil {
+		return nil, ErrNoRollbackTarget
+	}
+
+	return target, nil
+}
+
+// Rollback redeploys the configuration snapshot of a previous deployment. The
+// rollback is performed as a new deployment using the usual strategies.
+func (e *Engine) Rollback(
+	ctx context.Context, args RollbackArgs,
+) (*RollbackResult, error) {
+	lock, err := e.lockService(ctx, args.ServiceName, args.Lock)
+	if err != nil {
+		return nil, err
+	}
+	defer e.unlockService(args.ServiceName, lock)
+
+	svcState, err := e.state.LoadServiceState(args.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	deployments, err := e.state.ListDeployments(args.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := findRollbackTarget(
+		deployments, svcState.DeploymentID, args.DeploymentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	e.log.Info("rolling back to previous deployment",
+		zap.String("service", args.ServiceName),
+		zap.Int("deployment", target.ID),
+	)
+	svc, err := e.loadDeploymentConfig(args.ServiceName, target.ID)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"loading config snapshot of deployment %d: %w", target.ID, err,
+		)
+	}
+
+	res, err := e.deploy(ctx, svc, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RollbackResult{
+		ServiceName:  res.ServiceName,
+		DeploymentID: res.DeploymentID,
+		RolledBackTo: target.ID,
+	}, nil
+}
+
+// rollbackFailedDeployment reverts a deployment that failed part way through
+// its roll out. Containers belonging to the failed deployment are removed, any
+// containers of the previously active deployment are restarted, and the load
+// balancer is pointed back at them.
+func (e *Engine) rollbackFailedDeployment(
+	ctx context.Context, svc *ServiceConfig, svcState *state.ServiceState,
+) error {
+	e.log.Debug("removing containers of failed deployment",
+		zap.String("service", svc.Name),
+		zap.Int("deployment", svcState.DeploymentID),
+	)
+	failedContainers, err := e.docker.ContainerList(ctx, types.ContainerListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", fmt.Sprintf("%s=%s", serviceLabel, svc.Name)),
+			filters.Arg("label", fmt.Sprintf("%s=%d", deploymentLabel, svcState.DeploymentID)),
+			filters.Arg("label", processLabel),
+		),
+	})
+	if err != nil {
+		return err
+	}
+	for _, container := range failedContainers {
+		err := e.docker.ContainerRemove(ctx, container.ID, types.ContainerRemoveOptions{
+			Force: true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := e.releaseStalePorts(ctx, svc.Name); err != nil {
+		return err
+	}
+
+	// Restart the containers of the previous deployment, some of which may
+	// have been sent a SIGTERM during the roll out.
+	previousContainers := map[string]deployedContainerList{}
+	if svcState.ActiveDeploymentID > 0 {
+		containers, err := e.docker.ContainerList(ctx, types.ContainerListOptions{
+			All: true,
+			Filters: filters.NewArgs(
+				filters.Arg("label", fmt.Sprintf("%s=%s", serviceLabel, svc.Name)),
+				filters.Arg("label", fmt.Sprintf("%s=%d", deploymentLabel, svcState.ActiveDeploymentID)),
+				filters.Arg("label", processLabel),
+			),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, container := range containers {
+			if container.State != "running" {
+				e.log.Debug("restarting container of previous deployment",
+					zap.String("service", svc.Name),
+					zap.String("container", container.Names[0]),
+				)
+				err := e.docker.ContainerStart(
+					ctx, container.ID, types.ContainerStartOptions{},
+				)
+				if err != nil {
+					return err
+				}
+			}
+
+			processName := container.Labels[processLabel]
+			previousContainers[processName] = append(
+				previousContainers[processName],
+				deployedProcessContainer{
+					ID:   container.ID,
+					Name: container.Names[0],
+					Port: container.Labels[portLabel],
+				},
+			)
+		}
+	}
+
+	// Restore the load balancer using the config of the previous deployment
+	// where available, so hostname and path changes are also reverted.
+	previousProcesses := map[string]ServiceProcessConfig{}
+	if svcState.ActiveDeploymentID > 0 {
+		previousSvc, err := e.loadDeploymentConfig(svc.Name, svcState.ActiveDeploymentID)
+		if err != nil {
+			e.log.Warn("could not load config of previous deployment, using current config",
+				zap.String("service", svc.Name),
+				zap.Error(err),
+			)
+			previousSvc = svc
+		}
+		previousProcesses = previousSvc.Processes
+	}
+	for processName, process := range previousProcesses {
+		if len(process.Caddy.Hostnames) == 0 {
+			continue
+		}
+
+		err := e.updateLoadbalancerForDeployment(
+			ctx, svc.Name, &process, previousContainers[processName],
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for processName, process := range svc.Processes {
+		if _, ok := previousProcesses[processName]; ok {
+			continue
+		}
+		if len(process.Caddy.Hostnames) == 0 {
+			continue
+		}
+
+		// This process did not exist in the previous deployment, so it should
+		// no longer receive any traffic.
+		err := e.updateLoadbalancerForDeployment(
+			ctx, svc.Name, &process, deployedContainerList{},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadDeploymentConfig parses the config snapshot of a deployment from the
+// history of the service.
+func (e *Engine) loadDeploymentConfig(serviceName string, deploymentID int) (*ServiceConfig, error) {
+	deployment, err := e.state.LoadDeployment(serviceName, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.parseServiceConfig(serviceName, []byte(deployment.Config))
+}
@@ -0,0 +1,79 @@
+package guvnor
+
+import (
+	"testing"
+
+	"github.com/krystal/guvnor/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_findRollbackTarget(t *testing.T) {
+	deployments := []state.Deployment{
+		{ID: 1, Status: state.StatusSuccess},
+		{ID: 2, Status: state.StatusSuccess},
+		{ID: 3, Status: state.StatusFailure},
+		{ID: 4, Status: state.StatusSuccess},
+	}
+
+	tests := []struct {
+		name        string
+		deployments []state.Deployment
+		currentID   int
+		wantID      int
+		want        int
+		wantErr     string
+	}{
+		{
+			name:        "previous success",
+			deployments: deployments,
+			currentID:   4,
+			want:        2,
+		},
+		{
+			name:        "current failed",
+			deployments: deployments[:3],
+			currentID:   3,
+			want:        2,
+		},
+		{
+			name:        "specific deployment",
+			deployments: deployments,
+			currentID:   4,
+			wantID:      1,
+			want:        1,
+		},
+		{
+			name:        "specific failed deployment",
+			deployments: deployments,
+			currentID:   4,
+			wantID:      3,
+			wantErr:     "deployment 3 did not succeed, refusing to roll back to it",
+		},
+		{
+			name:        "specific missing deployment",
+			deployments: deployments,
+			currentID:   4,
+			wantID:      12,
+			wantErr:     "deployment 12: deployment not found in history",
+		},
+		{
+			name:        "no previous deployment",
+			deployments: deployments[:1],
+			currentID:   1,
+			wantErr:     ErrNoRollbackTarget.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findRollbackTarget(tt.deployments, tt.currentID, tt.wantID)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.ID)
+		})
+	}
+}
@@ -49,7 +49,9 @@ func (e *Engine) interactiveAttach(ctx context.Context, id string) (chan struct{
 	return doneChan, nil
 }
 
-func (e *Engine) runTask(ctx context.Context, task *ServiceTaskConfig, svc *ServiceConfig, injectEnv map[string]string) error {
+// runTask runs a task to completion. deploymentID is the deployment the task
+// is run for, which is made available to templates in its env and command.
+func (e *Engine) runTask(ctx context.Context, task *ServiceTaskConfig, svc *ServiceConfig, deploymentID int, injectEnv map[string]string) error {
 	image, pull, err := task.GetImage()
 	if err != nil {
 		return err
@@ -60,9 +62,21 @@ func (e *Engine) runTask(ctx context.Context, task *ServiceTaskConfig, svc *Serv
 		}
 	}
 
+	late := map[string]string{
+		templateDeployment: fmt.Sprintf("%d", deploymentID),
+	}
+	configuredEnv, err := e.resolveEnv(
+		svc.Name, late, svc.Defaults.envLayer(), task.envLayer(),
+	)
+	if err != nil {
+		return err
+	}
+	command, err := expandLateList(task.Command, late)
+	if err != nil {
+		return fmt.Errorf("command: %w", err)
+	}
 	env := mergeEnv(
-		svc.Defaults.Env,
-		task.Env,
+		configuredEnv,
 		injectEnv,
 		map[string]string{
 			"GUVNOR_TASK":    task.name,
@@ -78,7 +92,7 @@ func (e *Engine) runTask(ctx context.Context, task *ServiceTaskConfig, svc *Serv
 	)
 
 	containerConfig := &container.Config{
-		Cmd:   task.Command,
+		Cmd:   command,
 		Image: image,
 		Env:   env,
 
@@ -93,10 +107,18 @@ func (e *Engine) runTask(ctx context.Context, task *ServiceTaskConfig, svc *Serv
 
 		User: task.GetUser(),
 	}
+	resources, err := task.GetResources().dockerResources()
+	if err != nil {
+		return err
+	}
 	hostConfig := &container.HostConfig{
-		Mounts: task.GetMounts(),
+		Mounts:    task.GetMounts(),
+		Resources: resources,
 	}
-	if task.GetNetworkMode() == NetworkModeHost {
+	task.GetSecurity().applyTo(hostConfig)
+	networkingConfig := &network.NetworkingConfig{}
+	networkMode := task.GetNetworkMode()
+	if networkMode == NetworkModeHost {
 		hostConfig.NetworkMode = "host"
 	} else {
 		hostConfig.ExtraHosts = append(hostConfig.ExtraHosts,
@@ -104,6 +126,13 @@ func (e *Engine) runTask(ctx context.Context, task *ServiceTaskConfig, svc *Serv
 			// the IP of the host's gateway on the container network.
 			"host.docker.internal:host-gateway",
 		)
+
+		if networkMode == NetworkModeService {
+			hostConfig.NetworkMode = container.NetworkMode(
+				managedNetworkName(svc.Name),
+			)
+			networkingConfig = serviceNetworkingConfig(svc.Name, task.name)
+		}
 	}
 
 	e.log.Info("creating container",
@@ -113,7 +142,7 @@ func (e *Engine) runTask(ctx context.Context, task *ServiceTaskConfig, svc *Serv
 		ctx,
 		containerConfig,
 		hostConfig,
-		&network.NetworkingConfig{},
+		networkingConfig,
 		nil,
 		fullName,
 	)
@@ -202,5 +231,19 @@ func (e *Engine) RunTask(ctx context.Context, args RunTaskArgs) error {
 		return errors.New("specified task cannot be found in config")
 	}
 
-	return e.runTask(ctx, &task, svc, nil)
+	if err := e.ensureVolumes(ctx, svc); err != nil {
+		return err
+	}
+
+	if err := e.ensureNetwork(ctx, svc); err != nil {
+		return err
+	}
+
+	// Tasks run outside of a deployment belong to the active deployment
+	svcState, err := e.state.LoadServiceState(svc.Name)
+	if err != nil {
+		return err
+	}
+
+	return e.runTask(ctx, &task, svc, svcState.ActiveDeploymentID, nil)
 }
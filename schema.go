@@ -0,0 +1,201 @@
+package guvnor
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	strategyType = reflect.TypeOf(DefaultStrategy)
+)
+
+// ServiceConfigSchema returns a JSON Schema for service config files,
+// generated from ServiceConfig, so that editors can provide completion and
+// highlight mistakes.
+func ServiceConfigSchema() map[string]interface{} {
+	schema := jsonSchema(reflect.TypeOf(ServiceConfig{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "Guvnor service configuration"
+
+	return schema
+}
+
+// jsonSchema returns the JSON Schema of values of a type, as they are written
+// in YAML.
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case durationType:
+		return map[string]interface{}{
+			"type":    "string",
+			"pattern": `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`,
+		}
+	case strategyType:
+		strategies := []string{}
+		for name := range stringToStrategy {
+			strategies = append(strategies, name)
+		}
+		sort.Strings(strategies)
+
+		return map[string]interface{}{"type": "string", "enum": strategies}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": jsonSchema(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": jsonSchema(t.Elem()),
+		}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		addStructProperties(t, properties, &required)
+
+		schema := map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			sort.Strings(required)
+			schema["required"] = required
+		}
+		return schema
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// addStructProperties adds the fields of a struct to the properties of its
+// schema, including those of inlined structs.
+func addStructProperties(
+	t reflect.Type, properties map[string]interface{}, required *[]string,
+) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" && len(tag) > 1 && tag[1] == "inline" {
+			addStructProperties(field.Type, properties, required)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		schema := jsonSchema(field.Type)
+		if applyValidateTag(schema, field.Type, field.Tag.Get("validate")) {
+			*required = append(*required, name)
+		}
+		properties[name] = schema
+	}
+}
+
+// applyValidateTag constrains the schema of a field with the rules of its
+// validate tag, returning whether the field is required. Rules that cannot be
+// expressed in the schema are ignored.
+func applyValidateTag(
+	schema map[string]interface{}, t reflect.Type, tag string,
+) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+
+		switch name {
+		case "dive":
+			// Later rules apply to the elements of the field.
+			return required
+		case "required":
+			required = true
+		case "oneof":
+			enum := []interface{}{}
+			for _, value := range strings.Fields(param) {
+				if n, err := strconv.Atoi(value); err == nil && schema["type"] == "integer" {
+					enum = append(enum, n)
+					continue
+				}
+				enum = append(enum, value)
+			}
+			schema["enum"] = enum
+		case "min", "max", "gte", "lte", "gt", "lt":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			if keyword := boundKeyword(t.Kind(), name); keyword != "" {
+				schema[keyword] = n
+			}
+		}
+	}
+
+	return required
+}
+
+// boundKeyword returns the JSON Schema keyword for a min, max, gte, lte, gt
+// or lt rule on a field of the given kind.
+func boundKeyword(kind reflect.Kind, rule string) string {
+	suffix := ""
+	switch kind {
+	case reflect.Slice, reflect.Array:
+		suffix = "Items"
+	case reflect.Map:
+		suffix = "Properties"
+	case reflect.String:
+		suffix = "Length"
+	default:
+		switch rule {
+		case "min", "gte":
+			return "minimum"
+		case "max", "lte":
+			return "maximum"
+		case "gt":
+			return "exclusiveMinimum"
+		case "lt":
+			return "exclusiveMaximum"
+		}
+		return ""
+	}
+
+	switch rule {
+	case "min", "gte":
+		return "min" + suffix
+	case "max", "lte":
+		return "max" + suffix
+	}
+	return ""
+}
@@ -0,0 +1,27 @@
+package guvnor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ServiceConfigSchema(t *testing.T) {
+	schema := ServiceConfigSchema()
+	assert.Equal(t, "http://json-schema.org/draft-07/schema#", schema["$schema"])
+	assert.Equal(t, false, schema["additionalProperties"])
+
+	properties := schema["properties"].(map[string]interface{})
+	assert.Contains(t, properties, "include")
+	assert.NotContains(t, properties, "Include")
+
+	processes := properties["processes"].(map[string]interface{})
+	process := processes["additionalProperties"].(map[string]interface{})
+	processProperties := process["properties"].(map[string]interface{})
+
+	assert.Equal(t, map[string]interface{}{
+		"type": "string",
+		"enum": []string{"default", "replace"},
+	}, processProperties["deploymentStrategy"])
+	assert.Equal(t, "integer", processProperties["quantity"].(map[string]interface{})["type"])
+}
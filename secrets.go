@@ -0,0 +1,95 @@
+package guvnor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/krystal/guvnor/state"
+)
+
+func validateSecretName(name string) error {
+	if !envNameRegex.MatchString(name) {
+		return fmt.Errorf(
+			"secret name %q must start with a letter or underscore and only contain letters, numbers and underscores",
+			name,
+		)
+	}
+
+	return nil
+}
+
+type SetSecretArgs struct {
+	// ServiceName is the service the secret belongs to. When empty, the
+	// secret is available to every service.
+	ServiceName string
+	Name        string
+	Value       string
+}
+
+// SetSecret encrypts and stores a secret, replacing any existing value.
+func (e *Engine) SetSecret(ctx context.Context, args SetSecretArgs) error {
+	if err := validateSecretName(args.Name); err != nil {
+		return err
+	}
+
+	return e.secrets.Set(args.ServiceName, args.Name, args.Value)
+}
+
+type GetSecretArgs struct {
+	// ServiceName is the service the secret belongs to. When empty, a secret
+	// available to every service is returned.
+	ServiceName string
+	Name        string
+}
+
+type GetSecretResult struct {
+	Value string
+}
+
+// GetSecret decrypts a stored secret.
+func (e *Engine) GetSecret(
+	ctx context.Context, args GetSecretArgs,
+) (*GetSecretResult, error) {
+	value, err := e.secrets.Get(args.ServiceName, args.Name)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s: %w", args.Name, err)
+	}
+
+	return &GetSecretResult{Value: value}, nil
+}
+
+type ListSecretsArgs struct {
+	// ServiceName limits the secrets to those of a single service. When
+	// empty, the secrets available to every service are listed.
+	ServiceName string
+}
+
+type ListSecretsResult struct {
+	Secrets []state.SecretInfo
+}
+
+// ListSecrets returns the names of stored secrets, without their values.
+func (e *Engine) ListSecrets(
+	ctx context.Context, args ListSecretsArgs,
+) (*ListSecretsResult, error) {
+	secrets, err := e.secrets.List(args.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListSecretsResult{Secrets: secrets}, nil
+}
+
+type RemoveSecretArgs struct {
+	ServiceName string
+	Name        string
+}
+
+// RemoveSecret deletes a stored secret.
+func (e *Engine) RemoveSecret(ctx context.Context, args RemoveSecretArgs) error {
+	if err := e.secrets.Remove(args.ServiceName, args.Name); err != nil {
+		return fmt.Errorf("secret %s: %w", args.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package guvnor
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// SecurityConfig hardens the containers of a process or task. It is inlined
+// into the service defaults, process and task configs.
+type SecurityConfig struct {
+	// CapAdd is a list of Linux capabilities to add to the container, e.g
+	// NET_ADMIN.
+	CapAdd []string `yaml:"capAdd,omitempty"`
+	// CapDrop is a list of Linux capabilities to drop from the container.
+	// ALL can be used to drop every capability, with any required
+	// capabilities then listed in CapAdd.
+	CapDrop []string `yaml:"capDrop,omitempty"`
+	// ReadOnlyRootFilesystem mounts the root filesystem of the container as
+	// read only.
+	ReadOnlyRootFilesystem *bool `yaml:"readOnlyRootFilesystem,omitempty"`
+	// NoNewPrivileges prevents processes in the container from gaining
+	// additional privileges, e.g through setuid binaries.
+	NoNewPrivileges *bool `yaml:"noNewPrivileges,omitempty"`
+	// SecurityOpt is a list of Docker security options, e.g
+	// seccomp=/etc/guvnor/seccomp.json or apparmor=my-profile.
+	SecurityOpt []string `yaml:"securityOpt,omitempty"`
+	// Tmpfs is a map of container path to mount options of tmpfs mounts,
+	// e.g /tmp: size=64m.
+	Tmpfs map[string]string `yaml:"tmpfs,omitempty"`
+	// Init runs an init process in the container that forwards signals and
+	// reaps zombie processes.
+	Init *bool `yaml:"init,omitempty"`
+}
+
+// mergeSecurity merges the provided security configs, with values set in
+// later configs taking precedence. Lists replace those of earlier configs and
+// tmpfs mounts are merged by path.
+func mergeSecurity(toMerge ...SecurityConfig) SecurityConfig {
+	out := SecurityConfig{}
+	for _, sc := range toMerge {
+		if sc.CapAdd != nil {
+			out.CapAdd = sc.CapAdd
+		}
+		if sc.CapDrop != nil {
+			out.CapDrop = sc.CapDrop
+		}
+		if sc.ReadOnlyRootFilesystem != nil {
+			out.ReadOnlyRootFilesystem = sc.ReadOnlyRootFilesystem
+		}
+		if sc.NoNewPrivileges != nil {
+			out.NoNewPrivileges = sc.NoNewPrivileges
+		}
+		if sc.SecurityOpt != nil {
+			out.SecurityOpt = sc.SecurityOpt
+		}
+		for containerPath, opts := range sc.Tmpfs {
+			if out.Tmpfs == nil {
+				out.Tmpfs = map[string]string{}
+			}
+			out.Tmpfs[containerPath] = opts
+		}
+		if sc.Init != nil {
+			out.Init = sc.Init
+		}
+	}
+
+	return out
+}
+
+// normaliseCapability allows capabilities to be specified with or without the
+// CAP_ prefix and in any case.
+func normaliseCapability(capability string) string {
+	return strings.TrimPrefix(strings.ToUpper(capability), "CAP_")
+}
+
+var securityOptKeys = []string{
+	"apparmor", "label", "no-new-privileges", "seccomp", "systempaths",
+}
+
+// Validate rejects security options that are malformed or contradict each
+// other. privileged is whether the container will also be privileged.
+func (sc SecurityConfig) Validate(privileged bool) error {
+	added := map[string]bool{}
+	for _, capability := range sc.CapAdd {
+		added[normaliseCapability(capability)] = true
+	}
+	for _, capability := range sc.CapDrop {
+		capability = normaliseCapability(capability)
+		if added[capability] {
+			return fmt.Errorf(
+				"capability %s cannot be both added and dropped", capability,
+			)
+		}
+		if privileged && capability == "ALL" {
+			return errors.New(
+				"capDrop cannot contain ALL when privileged, as privileged grants all capabilities",
+			)
+		}
+	}
+
+	for _, opt := range sc.SecurityOpt {
+		name := securityOptName(opt)
+
+		supported := false
+		for _, key := range securityOptKeys {
+			if name == key {
+				supported = true
+			}
+		}
+		if !supported {
+			return fmt.Errorf(
+				"unsupported securityOpt %q, must be one of: %s",
+				opt,
+				strings.Join(securityOptKeys, ", "),
+			)
+		}
+
+		if name == "no-new-privileges" && sc.NoNewPrivileges != nil {
+			// The option enables no-new-privileges when it has no value.
+			enabled := true
+			if value := strings.TrimPrefix(opt, name); value != "" {
+				parsed, err := strconv.ParseBool(value[1:])
+				if err != nil {
+					return fmt.Errorf("securityOpt %q has an invalid value", opt)
+				}
+				enabled = parsed
+			}
+			if enabled != *sc.NoNewPrivileges {
+				return fmt.Errorf(
+					"securityOpt %q contradicts noNewPrivileges being %t",
+					opt, *sc.NoNewPrivileges,
+				)
+			}
+		}
+	}
+
+	for containerPath := range sc.Tmpfs {
+		if !path.IsAbs(containerPath) {
+			return fmt.Errorf("tmpfs path %q must be absolute", containerPath)
+		}
+	}
+
+	return nil
+}
+
+// securityOptName returns the name of a security option, without its value.
+func securityOptName(opt string) string {
+	if i := strings.IndexAny(opt, "=:"); i >= 0 {
+		return opt[:i]
+	}
+
+	return opt
+}
+
+// applyTo configures the host config of a container with the security
+// options.
+func (sc SecurityConfig) applyTo(hostConfig *container.HostConfig) {
+	hostConfig.CapAdd = sc.CapAdd
+	hostConfig.CapDrop = sc.CapDrop
+	if sc.ReadOnlyRootFilesystem != nil {
+		hostConfig.ReadonlyRootfs = *sc.ReadOnlyRootFilesystem
+	}
+	hostConfig.SecurityOpt = sc.SecurityOpt
+	if sc.NoNewPrivileges != nil && *sc.NoNewPrivileges && !sc.hasSecurityOpt("no-new-privileges") {
+		hostConfig.SecurityOpt = append(
+			append([]string{}, sc.SecurityOpt...), "no-new-privileges:true",
+		)
+	}
+	hostConfig.Tmpfs = sc.Tmpfs
+	hostConfig.Init = sc.Init
+}
+
+// hasSecurityOpt returns whether an option with the given name is set in
+// securityOpt.
+func (sc SecurityConfig) hasSecurityOpt(name string) bool {
+	for _, opt := range sc.SecurityOpt {
+		if securityOptName(opt) == name {
+			return true
+		}
+	}
+
+	return false
+}
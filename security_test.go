@@ -0,0 +1,289 @@
+package guvnor
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_mergeSecurity(t *testing.T) {
+	tests := []struct {
+		name    string
+		toMerge []SecurityConfig
+		want    SecurityConfig
+	}{
+		{
+			name:    "empty",
+			toMerge: []SecurityConfig{{}, {}},
+			want:    SecurityConfig{},
+		},
+		{
+			name: "overrides",
+			toMerge: []SecurityConfig{
+				{
+					CapDrop:                []string{"ALL"},
+					ReadOnlyRootFilesystem: boolPtr(true),
+					NoNewPrivileges:        boolPtr(true),
+					Tmpfs: map[string]string{
+						"/tmp": "size=64m",
+						"/run": "",
+					},
+				},
+				{
+					CapDrop:                []string{"NET_RAW"},
+					ReadOnlyRootFilesystem: boolPtr(false),
+					Tmpfs: map[string]string{
+						"/tmp": "size=128m",
+					},
+					Init: boolPtr(true),
+				},
+			},
+			want: SecurityConfig{
+				CapDrop:                []string{"NET_RAW"},
+				ReadOnlyRootFilesystem: boolPtr(false),
+				NoNewPrivileges:        boolPtr(true),
+				Tmpfs: map[string]string{
+					"/tmp": "size=128m",
+					"/run": "",
+				},
+				Init: boolPtr(true),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mergeSecurity(tt.toMerge...))
+		})
+	}
+}
+
+func Test_SecurityConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		sc         SecurityConfig
+		privileged bool
+		wantErr    string
+	}{
+		{
+			name: "valid",
+			sc: SecurityConfig{
+				CapAdd:          []string{"NET_BIND_SERVICE"},
+				CapDrop:         []string{"ALL"},
+				NoNewPrivileges: boolPtr(true),
+				SecurityOpt: []string{
+					"seccomp=/etc/guvnor/seccomp.json",
+					"apparmor:docker-default",
+				},
+				Tmpfs: map[string]string{"/tmp": "size=64m"},
+			},
+		},
+		{
+			name:       "privileged drops all",
+			sc:         SecurityConfig{CapDrop: []string{"all"}},
+			privileged: true,
+			wantErr: "capDrop cannot contain ALL when privileged, as " +
+				"privileged grants all capabilities",
+		},
+		{
+			name: "added and dropped",
+			sc: SecurityConfig{
+				CapAdd:  []string{"CAP_NET_ADMIN"},
+				CapDrop: []string{"net_admin"},
+			},
+			wantErr: "capability NET_ADMIN cannot be both added and dropped",
+		},
+		{
+			name:    "unsupported securityOpt",
+			sc:      SecurityConfig{SecurityOpt: []string{"fizz=buzz"}},
+			wantErr: `unsupported securityOpt "fizz=buzz", must be one of: apparmor, label, no-new-privileges, seccomp, systempaths`,
+		},
+		{
+			name: "no-new-privileges contradiction",
+			sc: SecurityConfig{
+				NoNewPrivileges: boolPtr(false),
+				SecurityOpt:     []string{"no-new-privileges"},
+			},
+			wantErr: `securityOpt "no-new-privileges" contradicts noNewPrivileges being false`,
+		},
+		{
+			name: "no-new-privileges disabled by securityOpt",
+			sc: SecurityConfig{
+				NoNewPrivileges: boolPtr(true),
+				SecurityOpt:     []string{"no-new-privileges:false"},
+			},
+			wantErr: `securityOpt "no-new-privileges:false" contradicts noNewPrivileges being true`,
+		},
+		{
+			name: "no-new-privileges enabled by securityOpt",
+			sc: SecurityConfig{
+				NoNewPrivileges: boolPtr(true),
+				SecurityOpt:     []string{"no-new-privileges=true"},
+			},
+		},
+		{
+			name: "invalid no-new-privileges value",
+			sc: SecurityConfig{
+				NoNewPrivileges: boolPtr(true),
+				SecurityOpt:     []string{"no-new-privileges:maybe"},
+			},
+			wantErr: `securityOpt "no-new-privileges:maybe" has an invalid value`,
+		},
+		{
+			name:    "relative tmpfs",
+			sc:      SecurityConfig{Tmpfs: map[string]string{"tmp": ""}},
+			wantErr: `tmpfs path "tmp" must be absolute`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sc.Validate(tt.privileged)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_SecurityConfig_applyTo(t *testing.T) {
+	tests := []struct {
+		name string
+		sc   SecurityConfig
+		want container.HostConfig
+	}{
+		{
+			name: "empty",
+			sc:   SecurityConfig{},
+			want: container.HostConfig{},
+		},
+		{
+			name: "all",
+			sc: SecurityConfig{
+				CapAdd:                 []string{"NET_BIND_SERVICE"},
+				CapDrop:                []string{"ALL"},
+				ReadOnlyRootFilesystem: boolPtr(true),
+				NoNewPrivileges:        boolPtr(true),
+				SecurityOpt:            []string{"apparmor=guvnor"},
+				Tmpfs:                  map[string]string{"/tmp": "size=64m"},
+				Init:                   boolPtr(true),
+			},
+			want: container.HostConfig{
+				CapAdd:         strslice.StrSlice{"NET_BIND_SERVICE"},
+				CapDrop:        strslice.StrSlice{"ALL"},
+				ReadonlyRootfs: true,
+				SecurityOpt: []string{
+					"apparmor=guvnor", "no-new-privileges:true",
+				},
+				Tmpfs: map[string]string{"/tmp": "size=64m"},
+				Init:  boolPtr(true),
+			},
+		},
+		{
+			name: "no-new-privileges already set",
+			sc: SecurityConfig{
+				NoNewPrivileges: boolPtr(true),
+				SecurityOpt:     []string{"no-new-privileges"},
+			},
+			want: container.HostConfig{
+				SecurityOpt: []string{"no-new-privileges"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := container.HostConfig{}
+			tt.sc.applyTo(&got)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_Engine_parseServiceConfig_security(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			config: `
+defaults:
+  image: foo
+  capDrop: [ALL]
+  noNewPrivileges: true
+processes:
+  web:
+    capAdd: [NET_BIND_SERVICE]
+    readOnlyRootFilesystem: true
+    tmpfs:
+      /tmp: size=64m
+    init: true
+tasks:
+  migrate:
+    securityOpt: [seccomp=unconfined]
+`,
+		},
+		{
+			name: "privileged process inherits capDrop ALL",
+			config: `
+defaults:
+  image: foo
+  capDrop: [ALL]
+processes:
+  web:
+    privileged: true
+`,
+			wantErr: "process (web) security: capDrop cannot contain ALL " +
+				"when privileged, as privileged grants all capabilities",
+		},
+		{
+			name: "process securityOpt contradicts default noNewPrivileges",
+			config: `
+defaults:
+  image: foo
+  noNewPrivileges: true
+processes:
+  web:
+    securityOpt: [no-new-privileges:false]
+`,
+			wantErr: `process (web) security: securityOpt "no-new-privileges:false" ` +
+				`contradicts noNewPrivileges being true`,
+		},
+		{
+			name: "tmpfs over mount",
+			config: `
+defaults:
+  image: foo
+  mounts:
+    - host: /srv/data
+      container: /data
+tasks:
+  migrate:
+    tmpfs:
+      /data: ""
+`,
+			wantErr: `task (migrate) security: tmpfs path "/data" is already used by a mount`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Engine{validate: validator.New()}
+			_, err := e.parseServiceConfig("fizz", []byte(tt.config))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
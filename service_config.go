@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"os"
 	"path"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-units"
 	"github.com/go-playground/validator/v10"
 	"github.com/krystal/guvnor/ready"
 	"gopkg.in/yaml.v3"
@@ -17,7 +21,10 @@ import (
 type ServiceConfig struct {
 	// Name is the unique identifier of the service, usually the name of the
 	// file it has been retrieved from.
-	Name string `yaml:"_"`
+	Name string `yaml:"-"`
+	// Include lists fragments of service config, relative to the config
+	// directory, that are merged beneath this config in the order listed.
+	Include []string `yaml:"include,omitempty"`
 	// Defaults is a series of configuration values to use by default in
 	// configuring process and task containers.
 	Defaults ServiceDefaultsConfig `yaml:"defaults"`
@@ -32,37 +39,404 @@ type ServiceConfig struct {
 	// Callbacks are definitions of Tasks to run when specific events occur,
 	// e.g before a deployment.
 	Callbacks ServiceCallbacksConfig `yaml:"callbacks"`
+
+	// RollbackOnFailure controls whether a deployment that fails part way
+	// through rolling out its processes should be reverted, restoring the
+	// containers and load balancer configuration of the previous deployment.
+	RollbackOnFailure bool `yaml:"rollbackOnFailure"`
+
+	// source is the YAML the config was parsed from, before templates were
+	// applied.
+	source []byte
+	// imageTagOverride is the image tag provided in place of the configured
+	// default, if any.
+	imageTagOverride string
 }
 
 func (sc *ServiceConfig) Validate(v *validator.Validate) error {
+	if errs := sc.validationErrors(v); len(errs) > 0 {
+		return errs[0]
+	}
+
+	return nil
+}
+
+// validationErrors returns every error found validating the config. The
+// custom validations are only run once the struct itself is valid, so any
+// errors from validating the struct are returned together as the first
+// error.
+func (sc *ServiceConfig) validationErrors(v *validator.Validate) []error {
 	if err := v.Struct(sc); err != nil {
+		return []error{err}
+	}
+
+	errs := []error{}
+	for _, validate := range sc.validations() {
+		if err := validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// configError is an error with a service config, along with the path of the
+// field it refers to within the YAML config, e.g processes web mounts [0], so
+// that it can be reported at that position.
+type configError struct {
+	path []string
+	err  error
+}
+
+func (ce *configError) Error() string {
+	return ce.err.Error()
+}
+
+func (ce *configError) Unwrap() error {
+	return ce.err
+}
+
+// withPath records the path of the field that err refers to. If err wraps an
+// error with a path, that path is relative to this one, so is appended.
+func withPath(err error, path ...string) error {
+	inner := &configError{}
+	if errors.As(err, &inner) {
+		path = append(append([]string{}, path...), inner.path...)
+	}
+
+	return &configError{path: path, err: err}
+}
+
+// errorPath returns the path of the field that an error refers to, or nil if
+// it is not known.
+func errorPath(err error) []string {
+	ce := &configError{}
+	if errors.As(err, &ce) {
+		return ce.path
+	}
+
+	return nil
+}
+
+// validations returns the custom validations of the service config, in the
+// order they should be run once the struct itself has been validated.
+func (sc *ServiceConfig) validations() []func() error {
+	return []func() error{
+		sc.validateImages,
+		sc.validateReadyChecks,
+		sc.validateResources,
+		sc.validateRestartPolicies,
+		sc.validateSecurity,
+		sc.validateMounts,
+		sc.validatePorts,
+		sc.validateEnv,
+		sc.validateCallbacks,
+	}
+}
+
+// orderedProcessNames returns the names of the processes of the service in a
+// stable order.
+func (sc *ServiceConfig) orderedProcessNames() []string {
+	names := make([]string, 0, len(sc.Processes))
+	for name := range sc.Processes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// orderedTaskNames returns the names of the tasks of the service in a stable
+// order.
+func (sc *ServiceConfig) orderedTaskNames() []string {
+	names := make([]string, 0, len(sc.Tasks))
+	for name := range sc.Tasks {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// validateImages ensures that every process and task has an image to run,
+// and that a tag is specified alongside any image that overrides the default.
+func (sc *ServiceConfig) validateImages() error {
+	for _, processName := range sc.orderedProcessNames() {
+		process := sc.Processes[processName]
+		if err := sc.validateImage(process.Image, process.ImageTag); err != nil {
+			return withPath(
+				fmt.Errorf("process (%s) %w", processName, err),
+				"processes", processName, "image",
+			)
+		}
+	}
+
+	for _, taskName := range sc.orderedTaskNames() {
+		task := sc.Tasks[taskName]
+		if err := sc.validateImage(task.Image, task.ImageTag); err != nil {
+			return withPath(
+				fmt.Errorf("task (%s) %w", taskName, err),
+				"tasks", taskName, "image",
+			)
+		}
+	}
+
+	return nil
+}
+
+func (sc *ServiceConfig) validateImage(image, imageTag string) error {
+	if image != "" && imageTag == "" {
+		return errors.New("imageTag must be specified when image specified")
+	}
+
+	if image == "" && sc.Defaults.Image == "" {
+		return errors.New(
+			"image must be specified when there is no default image",
+		)
+	}
+
+	return nil
+}
+
+// validateReadyChecks ensures the ready checks of all processes are valid
+func (sc *ServiceConfig) validateReadyChecks() error {
+	for processName, process := range sc.Processes {
+		if process.ReadyCheck == nil {
+			continue
+		}
+
+		if err := process.ReadyCheck.Validate(); err != nil {
+			return withPath(
+				fmt.Errorf("process (%s) ready check: %w", processName, err),
+				"processes", processName, "readyCheck",
+			)
+		}
+	}
+
+	return nil
+}
+
+// validateResources ensures the resources of all processes and tasks are
+// valid once merged with the service defaults
+func (sc *ServiceConfig) validateResources() error {
+	if err := sc.Defaults.Resources.Validate(); err != nil {
+		return withPath(
+			fmt.Errorf("default resources: %w", err), "defaults", "resources",
+		)
+	}
+
+	for processName, process := range sc.Processes {
+		if err := mergeResources(
+			sc.Defaults.Resources, process.Resources,
+		).Validate(); err != nil {
+			return withPath(
+				fmt.Errorf("process (%s) resources: %w", processName, err),
+				"processes", processName, "resources",
+			)
+		}
+	}
+
+	for taskName, task := range sc.Tasks {
+		if err := mergeResources(
+			sc.Defaults.Resources, task.Resources,
+		).Validate(); err != nil {
+			return withPath(
+				fmt.Errorf("task (%s) resources: %w", taskName, err),
+				"tasks", taskName, "resources",
+			)
+		}
+	}
+
+	return nil
+}
+
+// validateRestartPolicies ensures the restart policies of all processes are
+// valid
+func (sc *ServiceConfig) validateRestartPolicies() error {
+	for processName, process := range sc.Processes {
+		if err := process.RestartPolicy.Validate(); err != nil {
+			return withPath(
+				fmt.Errorf("process (%s) restart policy: %w", processName, err),
+				"processes", processName, "restartPolicy",
+			)
+		}
+	}
+
+	return nil
+}
+
+// validateSecurity ensures the security options of all processes and tasks
+// are valid and consistent once merged with the service defaults
+func (sc *ServiceConfig) validateSecurity() error {
+	if err := sc.Defaults.SecurityConfig.Validate(false); err != nil {
+		return withPath(fmt.Errorf("default security: %w", err), "defaults")
+	}
+
+	for processName, process := range sc.Processes {
+		security := mergeSecurity(
+			sc.Defaults.SecurityConfig, process.SecurityConfig,
+		)
+		err := validateSecurityMounts(
+			security, process.Privileged, mergeMounts(sc.Defaults.Mounts, process.Mounts),
+		)
+		if err != nil {
+			return withPath(
+				fmt.Errorf("process (%s) security: %w", processName, err),
+				"processes", processName,
+			)
+		}
+	}
+
+	for taskName, task := range sc.Tasks {
+		security := mergeSecurity(
+			sc.Defaults.SecurityConfig, task.SecurityConfig,
+		)
+		err := validateSecurityMounts(
+			security, false, mergeMounts(sc.Defaults.Mounts, task.Mounts),
+		)
+		if err != nil {
+			return withPath(
+				fmt.Errorf("task (%s) security: %w", taskName, err),
+				"tasks", taskName,
+			)
+		}
+	}
+
+	return nil
+}
+
+// validateSecurityMounts validates the security options of a container, and
+// that its tmpfs mounts do not replace any of its other mounts.
+func validateSecurityMounts(
+	security SecurityConfig, privileged bool, mounts []ServiceMountConfig,
+) error {
+	if err := security.Validate(privileged); err != nil {
 		return err
 	}
 
-	// call custom validations
-	return sc.validateCallbacks()
+	for _, mnt := range mounts {
+		if _, ok := security.Tmpfs[mnt.Container]; ok {
+			return fmt.Errorf(
+				"tmpfs path %q is already used by a mount", mnt.Container,
+			)
+		}
+	}
+
+	return nil
+}
+
+// validateMounts ensures all mounts are valid, and that a volume is not
+// configured differently in separate places
+func (sc *ServiceConfig) validateMounts() error {
+	volumeOptions := map[string]*MountVolumeOptions{}
+	validate := func(mounts []ServiceMountConfig) error {
+		paths := map[string]bool{}
+		for i, mnt := range mounts {
+			index := fmt.Sprintf("[%d]", i)
+			if err := mnt.Validate(); err != nil {
+				return withPath(err, index)
+			}
+
+			if paths[mnt.Container] {
+				return withPath(fmt.Errorf(
+					"container path %q is mounted more than once", mnt.Container,
+				), index, "container")
+			}
+			paths[mnt.Container] = true
+
+			if mnt.GetType() != MountTypeVolume || mnt.VolumeOptions == nil {
+				continue
+			}
+			if existing, ok := volumeOptions[mnt.Volume]; ok && !reflect.DeepEqual(existing, mnt.VolumeOptions) {
+				return withPath(fmt.Errorf(
+					"volume %q has conflicting volumeOptions", mnt.Volume,
+				), index, "volumeOptions")
+			}
+			volumeOptions[mnt.Volume] = mnt.VolumeOptions
+		}
+
+		return nil
+	}
+
+	if err := validate(sc.Defaults.Mounts); err != nil {
+		return withPath(
+			fmt.Errorf("default mounts: %w", err), "defaults", "mounts",
+		)
+	}
+
+	for processName, process := range sc.Processes {
+		if err := validate(process.Mounts); err != nil {
+			return withPath(
+				fmt.Errorf("process (%s) mounts: %w", processName, err),
+				"processes", processName, "mounts",
+			)
+		}
+	}
+
+	for taskName, task := range sc.Tasks {
+		if err := validate(task.Mounts); err != nil {
+			return withPath(
+				fmt.Errorf("task (%s) mounts: %w", taskName, err),
+				"tasks", taskName, "mounts",
+			)
+		}
+	}
+
+	return nil
+}
+
+// volumeOptions returns the options each volume used by the service should
+// be created with.
+func (sc *ServiceConfig) volumeOptions() map[string]MountVolumeOptions {
+	out := map[string]MountVolumeOptions{}
+	add := func(mounts []ServiceMountConfig) {
+		for _, mnt := range mounts {
+			if mnt.GetType() != MountTypeVolume {
+				continue
+			}
+			if mnt.VolumeOptions != nil {
+				out[mnt.Volume] = *mnt.VolumeOptions
+			} else if _, ok := out[mnt.Volume]; !ok {
+				out[mnt.Volume] = MountVolumeOptions{}
+			}
+		}
+	}
+
+	add(sc.Defaults.Mounts)
+	for _, process := range sc.Processes {
+		add(process.Mounts)
+	}
+	for _, task := range sc.Tasks {
+		add(task.Mounts)
+	}
+
+	return out
 }
 
 // validateCallbacks ensures all callbacks are valid tasks
 func (sc *ServiceConfig) validateCallbacks() error {
-	for _, set := range [][]string{
-		sc.Callbacks.PostDeployment,
-		sc.Callbacks.PreDeployment,
+	for _, set := range []struct {
+		field     string
+		taskNames []string
+	}{
+		{field: "postDeployment", taskNames: sc.Callbacks.PostDeployment},
+		{field: "preDeployment", taskNames: sc.Callbacks.PreDeployment},
 	} {
-		for _, taskName := range set {
+		for i, taskName := range set.taskNames {
+			path := []string{"callbacks", set.field, fmt.Sprintf("[%d]", i)}
 			task, ok := sc.Tasks[taskName]
 			if !ok {
-				return fmt.Errorf(
+				return withPath(fmt.Errorf(
 					"task (%s) specified in callback not found",
 					taskName,
-				)
+				), path...)
 			}
 
 			if task.Interactive {
-				return fmt.Errorf(
+				return withPath(fmt.Errorf(
 					"interactive tasks may not be callbacks (%s)",
 					taskName,
-				)
+				), path...)
 			}
 		}
 	}
@@ -70,18 +444,62 @@ func (sc *ServiceConfig) validateCallbacks() error {
 	return nil
 }
 
+// overrideImageTag replaces the default image tag of the service, so that any
+// process or task using the default image will use the provided tag instead.
+func (sc *ServiceConfig) overrideImageTag(tag string) error {
+	if sc.Defaults.Image == "" {
+		return errors.New(
+			"image tag override specified but service has no default image",
+		)
+	}
+
+	sc.Defaults.ImageTag = tag
+	sc.imageTagOverride = tag
+	return nil
+}
+
+// snapshot returns the config as YAML to be recorded with a deployment. The
+// config is recorded as written, before templates were applied, so that
+// values from the environment are not stored and the templates can be
+// applied again when the snapshot is loaded.
+func (sc *ServiceConfig) snapshot() ([]byte, error) {
+	if sc.source == nil {
+		return yaml.Marshal(sc)
+	}
+
+	raw := &ServiceConfig{}
+	if err := yaml.Unmarshal(sc.source, raw); err != nil {
+		return nil, err
+	}
+	if sc.imageTagOverride != "" {
+		raw.Defaults.ImageTag = sc.imageTagOverride
+	}
+
+	return yaml.Marshal(raw)
+}
+
 type ServiceCallbacksConfig struct {
 	PreDeployment  []string `yaml:"preDeployment"`
 	PostDeployment []string `yaml:"postDeployment"`
 }
 
 type ServiceDefaultsConfig struct {
-	Image     string               `yaml:"image"`
-	ImageTag  string               `yaml:"imageTag"`
-	ImagePull *bool                `yaml:"imagePull,omitempty"`
-	Env       map[string]string    `yaml:"env"`
-	Mounts    []ServiceMountConfig `yaml:"mounts"`
-	Network   NetworkConfig        `yaml:"network"`
+	Image     string            `yaml:"image"`
+	ImageTag  string            `yaml:"imageTag"`
+	ImagePull *bool             `yaml:"imagePull,omitempty"`
+	Env       map[string]string `yaml:"env"`
+	// EnvFiles are dotenv files providing default environment for task and
+	// process containers.
+	EnvFiles []string `yaml:"envFiles,omitempty"`
+	// Secrets are default environment variables for task and process
+	// containers whose values are read from the secrets directory.
+	Secrets   map[string]SecretConfig `yaml:"secrets,omitempty" validate:"dive"`
+	Mounts    []ServiceMountConfig    `yaml:"mounts" validate:"dive"`
+	Network   NetworkConfig           `yaml:"network"`
+	Resources ResourcesConfig         `yaml:"resources"`
+	// SecurityConfig allows default security options to be specified for
+	// task and process containers.
+	SecurityConfig `yaml:",inline"`
 
 	// User allows the default User/Group to be specified for task and
 	// process containers.
@@ -91,9 +509,118 @@ type ServiceDefaultsConfig struct {
 	User string `yaml:"user"`
 }
 
+type MountType string
+
+var (
+	MountTypeBind   MountType = "bind"
+	MountTypeVolume MountType = "volume"
+	MountTypeTmpfs  MountType = "tmpfs"
+)
+
 type ServiceMountConfig struct {
-	Host      string `yaml:"host"`
+	// Type is the kind of mount, which defaults to bind.
+	Type MountType `yaml:"type,omitempty" validate:"omitempty,oneof=bind volume tmpfs"`
+	// Host is the path on the host to mount for bind mounts.
+	Host string `yaml:"host"`
+	// Volume is the name of the volume to mount for volume mounts. Guvnor
+	// creates and manages the volume, prefixing its name with the service.
+	// Underscores are not allowed, so that volume names remain unique.
+	Volume    string `yaml:"volume,omitempty"`
 	Container string `yaml:"container"`
+	// ReadOnly mounts the source as read only in the container.
+	ReadOnly bool `yaml:"readOnly,omitempty"`
+	// VolumeOptions configures how a volume is created.
+	VolumeOptions *MountVolumeOptions `yaml:"volumeOptions,omitempty"`
+	// TmpfsSize limits the size of tmpfs mounts, e.g "64m".
+	TmpfsSize string `yaml:"tmpfsSize,omitempty"`
+}
+
+type MountVolumeOptions struct {
+	// Driver is the volume driver to use, which defaults to local.
+	Driver string `yaml:"driver,omitempty"`
+	// DriverOptions are passed to the volume driver when the volume is
+	// created.
+	DriverOptions map[string]string `yaml:"driverOptions,omitempty"`
+	// NoCopy prevents the volume being populated with the contents of the
+	// container path when it is first created.
+	NoCopy bool `yaml:"noCopy,omitempty"`
+}
+
+func (smc ServiceMountConfig) GetType() MountType {
+	if smc.Type == "" {
+		return MountTypeBind
+	}
+
+	return smc.Type
+}
+
+// Validate ensures that only the values appropriate for the type of mount
+// have been set.
+func (smc ServiceMountConfig) Validate() error {
+	if !path.IsAbs(smc.Container) {
+		return fmt.Errorf("container path %q must be absolute", smc.Container)
+	}
+
+	mountType := smc.GetType()
+	switch {
+	case mountType == MountTypeBind && smc.Host == "":
+		return errors.New("host must be specified for bind mounts")
+	case mountType == MountTypeVolume && smc.Volume == "":
+		return errors.New("volume must be specified for volume mounts")
+	case mountType == MountTypeVolume && !volumeNameRegex.MatchString(smc.Volume):
+		return fmt.Errorf(
+			"volume %q must start with a letter or number and only contain letters, numbers, '.' and '-'",
+			smc.Volume,
+		)
+	case mountType != MountTypeBind && smc.Host != "":
+		return fmt.Errorf("host cannot be specified for %s mounts", mountType)
+	case mountType != MountTypeVolume && smc.Volume != "":
+		return fmt.Errorf("volume cannot be specified for %s mounts", mountType)
+	case mountType != MountTypeVolume && smc.VolumeOptions != nil:
+		return fmt.Errorf("volumeOptions cannot be specified for %s mounts", mountType)
+	case mountType != MountTypeTmpfs && smc.TmpfsSize != "":
+		return fmt.Errorf("tmpfsSize cannot be specified for %s mounts", mountType)
+	}
+
+	if smc.TmpfsSize != "" {
+		if _, err := units.RAMInBytes(smc.TmpfsSize); err != nil {
+			return fmt.Errorf("invalid tmpfsSize: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// dockerMount converts the mount config to a Docker mount for a container of
+// the given service.
+func (smc ServiceMountConfig) dockerMount(serviceName string) mount.Mount {
+	mnt := mount.Mount{
+		Type:     mount.TypeBind,
+		Source:   smc.Host,
+		Target:   smc.Container,
+		ReadOnly: smc.ReadOnly,
+	}
+
+	switch smc.GetType() {
+	case MountTypeVolume:
+		mnt.Type = mount.TypeVolume
+		mnt.Source = managedVolumeName(serviceName, smc.Volume)
+		if smc.VolumeOptions != nil {
+			mnt.VolumeOptions = &mount.VolumeOptions{
+				NoCopy: smc.VolumeOptions.NoCopy,
+			}
+		}
+	case MountTypeTmpfs:
+		mnt.Type = mount.TypeTmpfs
+		mnt.Source = ""
+		if smc.TmpfsSize != "" {
+			// Validated when the config is loaded
+			size, _ := units.RAMInBytes(smc.TmpfsSize)
+			mnt.TmpfsOptions = &mount.TmpfsOptions{SizeBytes: size}
+		}
+	}
+
+	return mnt
 }
 
 type ProcessCaddyConfig struct {
@@ -106,27 +633,72 @@ type NetworkMode string
 var (
 	NetworkModeDefault NetworkMode = ""
 	NetworkModeHost    NetworkMode = "host"
+	// NetworkModeService attaches containers to a network shared by the
+	// service, where they can reach each other using the process or task
+	// name as a hostname.
+	NetworkModeService NetworkMode = "service"
 )
 
 type NetworkConfig struct {
-	Mode *NetworkMode `yaml:"mode"`
+	Mode *NetworkMode `yaml:"mode" validate:"omitempty,oneof=host service"`
+}
+
+type RestartPolicyName string
+
+var (
+	RestartPolicyAlways        RestartPolicyName = "always"
+	RestartPolicyUnlessStopped RestartPolicyName = "unless-stopped"
+	RestartPolicyOnFailure     RestartPolicyName = "on-failure"
+)
+
+type RestartPolicyConfig struct {
+	// Name is the policy Docker uses to restart containers that exit. It
+	// defaults to always.
+	Name RestartPolicyName `yaml:"name" validate:"omitempty,oneof=always unless-stopped on-failure"`
+	// MaxRetries limits the number of times the on-failure policy restarts a
+	// container. Zero allows unlimited restarts.
+	MaxRetries int `yaml:"maxRetries" validate:"gte=0"`
+}
+
+func (rpc RestartPolicyConfig) Validate() error {
+	if rpc.MaxRetries != 0 && rpc.Name != RestartPolicyOnFailure {
+		return fmt.Errorf(
+			"maxRetries may only be set with the %s policy",
+			RestartPolicyOnFailure,
+		)
+	}
+
+	return nil
 }
 
 type ServiceProcessConfig struct {
 	parent *ServiceConfig `yaml:"_"`
 	name   string         `yaml:"_"`
 
-	Image     string               `yaml:"image"`
-	ImageTag  string               `yaml:"imageTag"`
-	ImagePull *bool                `yaml:"imagePull,omitempty"`
-	Command   []string             `yaml:"command"`
-	Quantity  int                  `yaml:"quantity"`
-	Env       map[string]string    `yaml:"env"`
-	Mounts    []ServiceMountConfig `yaml:"mounts"`
-	Caddy     ProcessCaddyConfig   `yaml:"caddy"`
+	Image     string            `yaml:"image"`
+	ImageTag  string            `yaml:"imageTag"`
+	ImagePull *bool             `yaml:"imagePull,omitempty"`
+	Command   []string          `yaml:"command"`
+	Quantity  int               `yaml:"quantity"`
+	Env       map[string]string `yaml:"env"`
+	// EnvFiles are dotenv files providing environment for the process
+	// containers, taking precedence over the service defaults.
+	EnvFiles []string `yaml:"envFiles,omitempty"`
+	// Secrets are environment variables for the process containers whose
+	// values are read from the secrets directory.
+	Secrets map[string]SecretConfig `yaml:"secrets,omitempty" validate:"dive"`
+	Mounts  []ServiceMountConfig    `yaml:"mounts" validate:"dive"`
+	Caddy   ProcessCaddyConfig      `yaml:"caddy"`
 
 	// Privileged grants all capabilities to the container.
 	Privileged bool `yaml:"privileged"`
+	// SecurityConfig hardens the process containers. Values not set fall
+	// back to the service defaults.
+	SecurityConfig `yaml:",inline"`
+
+	// RestartPolicy controls how Docker restarts containers of the process
+	// that exit.
+	RestartPolicy RestartPolicyConfig `yaml:"restartPolicy"`
 
 	// User allows the User/Group to be configured for the process container.
 	//
@@ -134,14 +706,60 @@ type ServiceProcessConfig struct {
 	// [ user | user:group | uid | uid:gid | user:gid | uid:group ]
 	User string `yaml:"user"`
 
-	Network    NetworkConfig `yaml:"network"`
-	ReadyCheck *ready.Check  `yaml:"readyCheck"`
+	Network NetworkConfig `yaml:"network"`
+	// Ports are additional ports exposed by the process containers, beyond
+	// the one provided in PORT.
+	Ports      []ServicePortConfig `yaml:"ports" validate:"dive"`
+	ReadyCheck *ready.Check        `yaml:"readyCheck"`
+	// Resources constrains the host resources available to each container
+	// of the process. Values not set fall back to the service defaults.
+	Resources ResourcesConfig `yaml:"resources"`
+	// HealthCheck configures a Docker healthcheck for the process containers.
+	// When no ReadyCheck is configured, new containers must become healthy
+	// during a deployment before it continues.
+	HealthCheck *HealthCheckConfig `yaml:"healthCheck"`
 
-	// TODO: add validation to constrain this value
+	// DeploymentStrategy controls how containers of the process are
+	// replaced during a deployment, either default or replace.
 	DeploymentStrategy  DeploymentStrategy `yaml:"deploymentStrategy"`
 	ShutdownGracePeriod time.Duration      `yaml:"shutdownGracePeriod"`
 }
 
+type HealthCheckConfig struct {
+	// Command is run inside the container to determine if it is healthy. The
+	// container is healthy if the command exits with a status of zero.
+	Command []string `yaml:"command" validate:"required,min=1"`
+	// Shell causes Command to be joined and run using the default shell of
+	// the container, rather than executed directly.
+	Shell bool `yaml:"shell"`
+	// Interval is the time between checks. Docker defaults this to 30s.
+	Interval time.Duration `yaml:"interval"`
+	// Timeout is the time to allow for a check to complete. Docker defaults
+	// this to 30s.
+	Timeout time.Duration `yaml:"timeout"`
+	// StartPeriod is the time to allow for the container to boot, during
+	// which failed checks do not count towards Retries.
+	StartPeriod time.Duration `yaml:"startPeriod"`
+	// Retries is the number of consecutive failures before the container is
+	// considered unhealthy. Docker defaults this to 3.
+	Retries int `yaml:"retries" validate:"gte=0"`
+}
+
+func (hcc *HealthCheckConfig) dockerConfig() *container.HealthConfig {
+	test := append([]string{"CMD"}, hcc.Command...)
+	if hcc.Shell {
+		test = []string{"CMD-SHELL", strings.Join(hcc.Command, " ")}
+	}
+
+	return &container.HealthConfig{
+		Test:        test,
+		Interval:    hcc.Interval,
+		Timeout:     hcc.Timeout,
+		StartPeriod: hcc.StartPeriod,
+		Retries:     hcc.Retries,
+	}
+}
+
 func (spc ServiceProcessConfig) GetShutdownGracePeriod() time.Duration {
 	if spc.ShutdownGracePeriod == time.Duration(0) {
 		return time.Minute
@@ -199,16 +817,31 @@ func (spc ServiceProcessConfig) GetMounts() []mount.Mount {
 	for _, mnt := range mergeMounts(
 		spc.parent.Defaults.Mounts, spc.Mounts,
 	) {
-		mounts = append(mounts, mount.Mount{
-			Type:   mount.TypeBind,
-			Source: mnt.Host,
-			Target: mnt.Container,
-		})
+		mounts = append(mounts, mnt.dockerMount(spc.parent.Name))
 	}
 
 	return mounts
 }
 
+func (spc ServiceProcessConfig) GetRestartPolicy() container.RestartPolicy {
+	if spc.RestartPolicy.Name == "" {
+		return container.RestartPolicy{Name: string(RestartPolicyAlways)}
+	}
+
+	return container.RestartPolicy{
+		Name:              string(spc.RestartPolicy.Name),
+		MaximumRetryCount: spc.RestartPolicy.MaxRetries,
+	}
+}
+
+func (spc ServiceProcessConfig) GetSecurity() SecurityConfig {
+	return mergeSecurity(spc.parent.Defaults.SecurityConfig, spc.SecurityConfig)
+}
+
+func (spc ServiceProcessConfig) GetResources() ResourcesConfig {
+	return mergeResources(spc.parent.Defaults.Resources, spc.Resources)
+}
+
 func (spc ServiceProcessConfig) GetNetworkMode() NetworkMode {
 	if spc.Network.Mode != nil {
 		return *spc.Network.Mode
@@ -225,14 +858,26 @@ type ServiceTaskConfig struct {
 	parent *ServiceConfig `yaml:"_"`
 	name   string         `yaml:"_"`
 
-	Image       string               `yaml:"image"`
-	ImageTag    string               `yaml:"imageTag"`
-	ImagePull   *bool                `yaml:"imagePull,omitempty"`
-	Command     []string             `yaml:"command"`
-	Interactive bool                 `yaml:"interactive"`
-	Env         map[string]string    `yaml:"env"`
-	Mounts      []ServiceMountConfig `yaml:"mounts"`
-	Network     NetworkConfig        `yaml:"network"`
+	Image       string            `yaml:"image"`
+	ImageTag    string            `yaml:"imageTag"`
+	ImagePull   *bool             `yaml:"imagePull,omitempty"`
+	Command     []string          `yaml:"command"`
+	Interactive bool              `yaml:"interactive"`
+	Env         map[string]string `yaml:"env"`
+	// EnvFiles are dotenv files providing environment for the task
+	// container, taking precedence over the service defaults.
+	EnvFiles []string `yaml:"envFiles,omitempty"`
+	// Secrets are environment variables for the task container whose values
+	// are read from the secrets directory.
+	Secrets map[string]SecretConfig `yaml:"secrets,omitempty" validate:"dive"`
+	Mounts  []ServiceMountConfig    `yaml:"mounts" validate:"dive"`
+	Network NetworkConfig           `yaml:"network"`
+	// Resources constrains the host resources available to the task
+	// container. Values not set fall back to the service defaults.
+	Resources ResourcesConfig `yaml:"resources"`
+	// SecurityConfig hardens the task container. Values not set fall back to
+	// the service defaults.
+	SecurityConfig `yaml:",inline"`
 
 	// User allows the User/Group to be configured for the task container.
 	//
@@ -282,16 +927,20 @@ func (stc ServiceTaskConfig) GetMounts() []mount.Mount {
 	for _, mnt := range mergeMounts(
 		stc.parent.Defaults.Mounts, stc.Mounts,
 	) {
-		mounts = append(mounts, mount.Mount{
-			Type:   mount.TypeBind,
-			Source: mnt.Host,
-			Target: mnt.Container,
-		})
+		mounts = append(mounts, mnt.dockerMount(stc.parent.Name))
 	}
 
 	return mounts
 }
 
+func (stc ServiceTaskConfig) GetSecurity() SecurityConfig {
+	return mergeSecurity(stc.parent.Defaults.SecurityConfig, stc.SecurityConfig)
+}
+
+func (stc ServiceTaskConfig) GetResources() ResourcesConfig {
+	return mergeResources(stc.parent.Defaults.Resources, stc.Resources)
+}
+
 func (stc ServiceTaskConfig) GetNetworkMode() NetworkMode {
 	if stc.Network.Mode != nil {
 		return *stc.Network.Mode
@@ -305,27 +954,60 @@ func (stc ServiceTaskConfig) GetNetworkMode() NetworkMode {
 }
 
 func (e *Engine) loadServiceConfig(serviceName string) (*ServiceConfig, error) {
-	svcPath := path.Join(
-		e.config.Paths.Config,
-		fmt.Sprintf("%s.yaml", serviceName),
+	return e.loadServiceConfigFile(
+		serviceName, path.Join(e.config.Paths.Config, serviceName+".yaml"),
 	)
-	configData, err := os.ReadFile(svcPath)
+}
+
+// loadServiceConfigFile loads the config of a service from filePath, merging
+// in the engine defaults and any fragments it includes from the config
+// directory.
+func (e *Engine) loadServiceConfigFile(
+	serviceName string, filePath string,
+) (*ServiceConfig, error) {
+	merged, err := e.mergeServiceConfig(serviceName, filePath)
 	if err != nil {
 		return nil, err
 	}
+	configData, err := merged.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	return e.parseServiceConfig(serviceName, configData)
+}
+
+// parseServiceConfig decodes and validates a service configuration from YAML.
+func (e *Engine) parseServiceConfig(serviceName string, configData []byte) (*ServiceConfig, error) {
+	cfg, errs := e.decodeServiceConfig(serviceName, configData)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
 
+	return cfg, nil
+}
+
+// decodeServiceConfig decodes a service configuration from YAML, applies its
+// templates and validates it, returning every error found. The config is only
+// returned if it is valid.
+func (e *Engine) decodeServiceConfig(serviceName string, configData []byte) (*ServiceConfig, []error) {
 	decoder := yaml.NewDecoder(bytes.NewBuffer(configData))
 	decoder.KnownFields(true)
 
 	cfg := &ServiceConfig{}
 	if err := decoder.Decode(cfg); err != nil {
-		return nil, err
+		return nil, []error{err}
 	}
 
 	cfg.Name = serviceName
+	cfg.source = configData
 
-	if err := cfg.Validate(e.validate); err != nil {
-		return nil, err
+	if err := cfg.applyTemplates(e.templateValues(serviceName)); err != nil {
+		return nil, []error{err}
+	}
+
+	if errs := cfg.validationErrors(e.validate); len(errs) > 0 {
+		return nil, errs
 	}
 
 	for processName, process := range cfg.Processes {
@@ -4,8 +4,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/go-playground/validator/v10"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func Test_ServiceProcessConfig_GetUser(t *testing.T) {
@@ -580,3 +584,679 @@ func Test_ServiceProcessConfig_GetNetworkMode(t *testing.T) {
 		})
 	}
 }
+
+func Test_ServiceConfig_overrideImageTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		sc      *ServiceConfig
+		tag     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "success",
+			sc: &ServiceConfig{
+				Defaults: ServiceDefaultsConfig{
+					Image:    "foo",
+					ImageTag: "bar",
+				},
+			},
+			tag:  "buzz",
+			want: "buzz",
+		},
+		{
+			name:    "no default image",
+			sc:      &ServiceConfig{},
+			tag:     "buzz",
+			wantErr: "image tag override specified but service has no default image",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sc.overrideImageTag(tt.tag)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, tt.sc.Defaults.ImageTag)
+
+			// Ensure processes and tasks using the default image pick up the
+			// overriden tag.
+			spc := ServiceProcessConfig{parent: tt.sc}
+			image, _, err := spc.GetImage()
+			assert.NoError(t, err)
+			assert.Equal(t, "foo:"+tt.want, image)
+
+			stc := ServiceTaskConfig{parent: tt.sc}
+			image, _, err = stc.GetImage()
+			assert.NoError(t, err)
+			assert.Equal(t, "foo:"+tt.want, image)
+		})
+	}
+}
+
+func Test_Engine_parseServiceConfig_snapshot(t *testing.T) {
+	e := &Engine{validate: validator.New()}
+	original, err := e.parseServiceConfig("fizz", []byte(`
+defaults:
+  image: foo
+  imageTag: bar
+  imagePull: false
+  env:
+    FIZZ: buzz
+processes:
+  web:
+    command: ["serve"]
+    quantity: 2
+    caddy:
+      hostnames: [fizz.example.com]
+    deploymentStrategy: replace
+    shutdownGracePeriod: 30s
+    readyCheck:
+      frequency: 1s
+      maximum: 10
+      http:
+        path: /health
+tasks:
+  migrate:
+    command: ["migrate"]
+callbacks:
+  preDeployment: [migrate]
+`))
+	require.NoError(t, err)
+
+	snapshot, err := yaml.Marshal(original)
+	require.NoError(t, err)
+
+	got, err := e.parseServiceConfig("fizz", snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, "fizz", got.Name)
+	assert.Equal(t, ReplaceStrategy, got.Processes["web"].DeploymentStrategy)
+	assert.Equal(t, 30*time.Second, got.Processes["web"].ShutdownGracePeriod)
+
+	// Snapshotting the parsed snapshot should produce an identical snapshot
+	resnapshot, err := yaml.Marshal(got)
+	require.NoError(t, err)
+	assert.Equal(t, string(snapshot), string(resnapshot))
+}
+
+func Test_Engine_parseServiceConfig_readyCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		// limits replaces the default frequency and maximum when set
+		limits     string
+		readyCheck string
+		wantErr    bool
+	}{
+		{
+			name: "http",
+			readyCheck: `
+      http:
+        path: /health`,
+		},
+		{
+			name: "tcp",
+			readyCheck: `
+      tcp:
+        timeout: 2s`,
+		},
+		{
+			name: "exec",
+			readyCheck: `
+      exec:
+        command: ["pg_isready"]`,
+		},
+		{
+			name: "exec without command",
+			readyCheck: `
+      exec:
+        timeout: 2s`,
+			wantErr: true,
+		},
+		{
+			name:       "no check",
+			readyCheck: "",
+			wantErr:    true,
+		},
+		{
+			name: "timeout and backoff",
+			limits: `
+      timeout: 2m
+      backoff:
+        initial: 1s
+        multiplier: 1.5
+        maxInterval: 10s
+        jitter: 0.1`,
+			readyCheck: `
+      tcp: {}`,
+		},
+		{
+			name: "no maximum or timeout",
+			limits: `
+      frequency: 1s`,
+			readyCheck: `
+      tcp: {}`,
+			wantErr: true,
+		},
+		{
+			name: "no frequency or backoff",
+			limits: `
+      maximum: 10`,
+			readyCheck: `
+      tcp: {}`,
+			wantErr: true,
+		},
+		{
+			name: "invalid jitter",
+			limits: `
+      maximum: 10
+      backoff:
+        initial: 1s
+        jitter: 2`,
+			readyCheck: `
+      tcp: {}`,
+			wantErr: true,
+		},
+		{
+			name: "multiple checks",
+			readyCheck: `
+      http:
+        path: /health
+      tcp: {}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := tt.limits
+			if limits == "" {
+				limits = `
+      frequency: 1s
+      maximum: 10`
+			}
+
+			e := &Engine{validate: validator.New()}
+			_, err := e.parseServiceConfig("fizz", []byte(`
+defaults:
+  image: foo
+processes:
+  web:
+    readyCheck:`+limits+tt.readyCheck+"\n"))
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_HealthCheckConfig_dockerConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		hcc  *HealthCheckConfig
+		want *container.HealthConfig
+	}{
+		{
+			name: "exec",
+			hcc: &HealthCheckConfig{
+				Command:     []string{"curl", "-f", "http://localhost/health"},
+				Interval:    10 * time.Second,
+				Timeout:     2 * time.Second,
+				StartPeriod: 30 * time.Second,
+				Retries:     5,
+			},
+			want: &container.HealthConfig{
+				Test:        []string{"CMD", "curl", "-f", "http://localhost/health"},
+				Interval:    10 * time.Second,
+				Timeout:     2 * time.Second,
+				StartPeriod: 30 * time.Second,
+				Retries:     5,
+			},
+		},
+		{
+			name: "shell",
+			hcc: &HealthCheckConfig{
+				Command: []string{"pg_isready", "||", "exit 1"},
+				Shell:   true,
+			},
+			want: &container.HealthConfig{
+				Test: []string{"CMD-SHELL", "pg_isready || exit 1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.hcc.dockerConfig())
+		})
+	}
+}
+
+func Test_ServiceProcessConfig_GetResources(t *testing.T) {
+	tests := []struct {
+		name string
+		spc  ServiceProcessConfig
+		want ResourcesConfig
+	}{
+		{
+			name: "no resources",
+			spc: ServiceProcessConfig{
+				parent: &ServiceConfig{},
+			},
+			want: ResourcesConfig{},
+		},
+		{
+			name: "defaults only",
+			spc: ServiceProcessConfig{
+				parent: &ServiceConfig{
+					Defaults: ServiceDefaultsConfig{
+						Resources: ResourcesConfig{
+							Memory:    "512m",
+							PidsLimit: 100,
+						},
+					},
+				},
+			},
+			want: ResourcesConfig{
+				Memory:    "512m",
+				PidsLimit: 100,
+			},
+		},
+		{
+			name: "process overrides defaults",
+			spc: ServiceProcessConfig{
+				parent: &ServiceConfig{
+					Defaults: ServiceDefaultsConfig{
+						Resources: ResourcesConfig{
+							Memory:    "512m",
+							CPUs:      1,
+							PidsLimit: 100,
+							Ulimits: map[string]UlimitConfig{
+								"nofile": {Soft: 1024, Hard: 2048},
+								"nproc":  {Soft: 64, Hard: 64},
+							},
+						},
+					},
+				},
+				Resources: ResourcesConfig{
+					Memory: "1g",
+					CPUs:   0.5,
+					Ulimits: map[string]UlimitConfig{
+						"nofile": {Soft: 4096, Hard: 8192},
+					},
+				},
+			},
+			want: ResourcesConfig{
+				Memory:    "1g",
+				CPUs:      0.5,
+				PidsLimit: 100,
+				Ulimits: map[string]UlimitConfig{
+					"nofile": {Soft: 4096, Hard: 8192},
+					"nproc":  {Soft: 64, Hard: 64},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.spc.GetResources())
+		})
+	}
+}
+
+func Test_ServiceProcessConfig_GetRestartPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		spc  ServiceProcessConfig
+		want container.RestartPolicy
+	}{
+		{
+			name: "default",
+			spc:  ServiceProcessConfig{},
+			want: container.RestartPolicy{Name: "always"},
+		},
+		{
+			name: "unless-stopped",
+			spc: ServiceProcessConfig{
+				RestartPolicy: RestartPolicyConfig{
+					Name: RestartPolicyUnlessStopped,
+				},
+			},
+			want: container.RestartPolicy{Name: "unless-stopped"},
+		},
+		{
+			name: "on-failure",
+			spc: ServiceProcessConfig{
+				RestartPolicy: RestartPolicyConfig{
+					Name:       RestartPolicyOnFailure,
+					MaxRetries: 5,
+				},
+			},
+			want: container.RestartPolicy{
+				Name:              "on-failure",
+				MaximumRetryCount: 5,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.spc.GetRestartPolicy())
+		})
+	}
+}
+
+func Test_Engine_parseServiceConfig_restartPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		restartPolicy string
+		wantErr       bool
+	}{
+		{
+			name: "on-failure with retries",
+			restartPolicy: `
+      name: on-failure
+      maxRetries: 5`,
+		},
+		{
+			name: "unless-stopped",
+			restartPolicy: `
+      name: unless-stopped`,
+		},
+		{
+			name: "unknown policy",
+			restartPolicy: `
+      name: sometimes`,
+			wantErr: true,
+		},
+		{
+			name: "retries without on-failure",
+			restartPolicy: `
+      name: always
+      maxRetries: 5`,
+			wantErr: true,
+		},
+		{
+			name: "negative retries",
+			restartPolicy: `
+      name: on-failure
+      maxRetries: -1`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Engine{validate: validator.New()}
+			_, err := e.parseServiceConfig("fizz", []byte(`
+defaults:
+  image: foo
+processes:
+  web:
+    restartPolicy:`+tt.restartPolicy+"\n"))
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_ServiceMountConfig_dockerMount(t *testing.T) {
+	tests := []struct {
+		name string
+		smc  ServiceMountConfig
+		want mount.Mount
+	}{
+		{
+			name: "bind",
+			smc: ServiceMountConfig{
+				Host:      "/opt/fizz/config.yml",
+				Container: "/config.yml",
+				ReadOnly:  true,
+			},
+			want: mount.Mount{
+				Type:     mount.TypeBind,
+				Source:   "/opt/fizz/config.yml",
+				Target:   "/config.yml",
+				ReadOnly: true,
+			},
+		},
+		{
+			name: "volume",
+			smc: ServiceMountConfig{
+				Type:      MountTypeVolume,
+				Volume:    "data",
+				Container: "/var/lib/data",
+				VolumeOptions: &MountVolumeOptions{
+					Driver: "local",
+					NoCopy: true,
+				},
+			},
+			want: mount.Mount{
+				Type:   mount.TypeVolume,
+				Source: "guvnor-fizz_data",
+				Target: "/var/lib/data",
+				VolumeOptions: &mount.VolumeOptions{
+					NoCopy: true,
+				},
+			},
+		},
+		{
+			name: "tmpfs",
+			smc: ServiceMountConfig{
+				Type:      MountTypeTmpfs,
+				Container: "/tmp",
+				TmpfsSize: "64m",
+			},
+			want: mount.Mount{
+				Type:   mount.TypeTmpfs,
+				Target: "/tmp",
+				TmpfsOptions: &mount.TmpfsOptions{
+					SizeBytes: 64 * 1024 * 1024,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.smc.dockerMount("fizz"))
+		})
+	}
+}
+
+func Test_Engine_parseServiceConfig_mounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			config: `
+defaults:
+  image: foo
+  mounts:
+    - host: /opt/fizz/config.yml
+      container: /config.yml
+      readOnly: true
+    - type: volume
+      volume: data
+      container: /data
+      volumeOptions:
+        driver: local
+        driverOptions:
+          type: nfs
+processes:
+  web:
+    mounts:
+      - type: tmpfs
+        container: /tmp
+        tmpfsSize: 64m
+tasks:
+  backup:
+    mounts:
+      - type: volume
+        volume: data
+        container: /data
+        readOnly: true
+`,
+		},
+		{
+			name: "bind without host",
+			config: `
+defaults:
+  image: foo
+  mounts:
+    - container: /data
+`,
+			wantErr: "default mounts: host must be specified for bind mounts",
+		},
+		{
+			name: "volume with host",
+			config: `
+defaults:
+  image: foo
+processes:
+  web:
+    mounts:
+      - type: volume
+        volume: data
+        host: /srv/data
+        container: /data
+`,
+			wantErr: "process (web) mounts: host cannot be specified for volume mounts",
+		},
+		{
+			name: "volume name with underscore",
+			config: `
+defaults:
+  image: foo
+processes:
+  web:
+    mounts:
+      - type: volume
+        volume: data_x
+        container: /data
+`,
+			wantErr: `process (web) mounts: volume "data_x" must start with a letter or number and only contain letters, numbers, '.' and '-'`,
+		},
+		{
+			name: "relative container path",
+			config: `
+defaults:
+  image: foo
+tasks:
+  backup:
+    mounts:
+      - type: tmpfs
+        container: tmp
+`,
+			wantErr: `task (backup) mounts: container path "tmp" must be absolute`,
+		},
+		{
+			name: "duplicate container path",
+			config: `
+defaults:
+  image: foo
+  mounts:
+    - host: /srv/a
+      container: /data
+    - host: /srv/b
+      container: /data
+`,
+			wantErr: `default mounts: container path "/data" is mounted more than once`,
+		},
+		{
+			name: "conflicting volume options",
+			config: `
+defaults:
+  image: foo
+  mounts:
+    - type: volume
+      volume: data
+      container: /data
+      volumeOptions:
+        driver: local
+processes:
+  web:
+    mounts:
+      - type: volume
+        volume: data
+        container: /data
+        volumeOptions:
+          driver: nfs
+`,
+			wantErr: `process (web) mounts: volume "data" has conflicting volumeOptions`,
+		},
+		{
+			name: "unknown type",
+			config: `
+defaults:
+  image: foo
+  mounts:
+    - type: npipe
+      container: /data
+`,
+			wantErr: "Key: 'ServiceConfig.Defaults.Mounts[0].Type' Error:" +
+				"Field validation for 'Type' failed on the 'oneof' tag",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Engine{validate: validator.New()}
+			_, err := e.parseServiceConfig("fizz", []byte(tt.config))
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_ServiceConfig_volumeOptions(t *testing.T) {
+	sc := &ServiceConfig{
+		Defaults: ServiceDefaultsConfig{
+			Mounts: []ServiceMountConfig{
+				{Type: MountTypeVolume, Volume: "data", Container: "/data"},
+				{Host: "/srv/config", Container: "/config"},
+			},
+		},
+		Processes: map[string]ServiceProcessConfig{
+			"web": {
+				Mounts: []ServiceMountConfig{
+					{
+						Type:      MountTypeVolume,
+						Volume:    "data",
+						Container: "/data",
+						VolumeOptions: &MountVolumeOptions{
+							Driver: "local",
+						},
+					},
+				},
+			},
+		},
+		Tasks: map[string]ServiceTaskConfig{
+			"backup": {
+				Mounts: []ServiceMountConfig{
+					{Type: MountTypeVolume, Volume: "backups", Container: "/backups"},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, map[string]MountVolumeOptions{
+		"data":    {Driver: "local"},
+		"backups": {},
+	}, sc.volumeOptions())
+}
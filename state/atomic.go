@@ -0,0 +1,58 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to a file such that readers will only ever see
+// the previous or the new contents of the file, even if the process crashes
+// part way through. The data is written to a temporary file in the same
+// directory, which is synced and then renamed over the destination.
+func WriteFileAtomic(name string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+
+	f, err := os.CreateTemp(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+	tempName := f.Name()
+	defer os.Remove(tempName)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempName, name); err != nil {
+		return err
+	}
+
+	// Sync the directory so the rename itself is persisted
+	return syncDir(dir)
+}
+
+// syncDir syncs a directory, so that changes to its entries are persisted.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
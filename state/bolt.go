@@ -0,0 +1,403 @@
+package state
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	servicesBucket = []byte("services")
+	historyBucket  = []byte("history")
+	locksBucket    = []byte("locks")
+	portsBucket    = []byte("ports")
+)
+
+// boltOpenTimeout is how long to wait for another process to finish with the
+// database before giving up.
+const boltOpenTimeout = 10 * time.Second
+
+// BoltStore is a Store that persists state in a single bbolt database file.
+// History and locks are updated transactionally.
+//
+// The database is only held open for the duration of each operation, as bbolt
+// prevents more than one process opening it at a time. Service locks are
+// stored as records, and a lock whose holder is no longer running is treated
+// as released.
+type BoltStore struct {
+	Path string
+	Log  *zap.Logger
+}
+
+func (bs *BoltStore) open() (*bolt.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(bs.Path), 0o755); err != nil {
+		return nil, err
+	}
+
+	return bolt.Open(bs.Path, 0o644, &bolt.Options{
+		Timeout: boltOpenTimeout,
+	})
+}
+
+func (bs *BoltStore) update(fn func(tx *bolt.Tx) error) error {
+	db, err := bs.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(fn)
+}
+
+func (bs *BoltStore) view(fn func(tx *bolt.Tx) error) error {
+	db, err := bs.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(fn)
+}
+
+func deploymentKey(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+
+	return key
+}
+
+func (bs *BoltStore) LoadServiceState(service string) (*ServiceState, error) {
+	out := &ServiceState{
+		Version:      currentVersion,
+		DeploymentID: 0,
+	}
+	err := bs.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(servicesBucket)
+		if b == nil {
+			return nil
+		}
+
+		data := b.Get([]byte(service))
+		if data == nil {
+			return nil
+		}
+
+		var err error
+		out, _, err = decodeServiceState(data)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("loading state of service %s: %w", service, err)
+	}
+
+	return out, nil
+}
+
+func (bs *BoltStore) SaveServiceState(service string, state *ServiceState) error {
+	data, err := encodeServiceState(state)
+	if err != nil {
+		return err
+	}
+
+	return bs.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(servicesBucket)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(service), data)
+	})
+}
+
+func (bs *BoltStore) ListServices() ([]string, error) {
+	services := []string{}
+	err := bs.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(servicesBucket)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, _ []byte) error {
+			services = append(services, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return services, nil
+}
+
+func (bs *BoltStore) ListDeployments(service string) ([]Deployment, error) {
+	out := []Deployment{}
+	err := bs.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(historyBucket)
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket([]byte(service))
+		if b == nil {
+			return nil
+		}
+
+		// Keys are big endian IDs, so iteration is oldest to newest
+		return b.ForEach(func(_, v []byte) error {
+			deployment := Deployment{}
+			if err := json.Unmarshal(v, &deployment); err != nil {
+				return err
+			}
+			out = append(out, deployment)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (bs *BoltStore) LoadDeployment(service string, id int) (*Deployment, error) {
+	var out *Deployment
+	err := bs.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(historyBucket)
+		if b == nil {
+			return ErrDeploymentNotFound
+		}
+		b = b.Bucket([]byte(service))
+		if b == nil {
+			return ErrDeploymentNotFound
+		}
+
+		data := b.Get(deploymentKey(id))
+		if data == nil {
+			return ErrDeploymentNotFound
+		}
+
+		out = &Deployment{}
+		return json.Unmarshal(data, out)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (bs *BoltStore) SaveDeployment(service string, deployment *Deployment) error {
+	data, err := json.Marshal(deployment)
+	if err != nil {
+		return err
+	}
+
+	return bs.update(func(tx *bolt.Tx) error {
+		history, err := tx.CreateBucketIfNotExists(historyBucket)
+		if err != nil {
+			return err
+		}
+		b, err := history.CreateBucketIfNotExists([]byte(service))
+		if err != nil {
+			return err
+		}
+
+		if err := b.Put(deploymentKey(deployment.ID), data); err != nil {
+			return err
+		}
+
+		// Discard the oldest deployments beyond the retention limit
+		keys := [][]byte{}
+		err = b.ForEach(func(k, _ []byte) error {
+			keys = append(keys, append([]byte{}, k...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(keys)-maxHistory; i++ {
+			if err := b.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// processRunning reports whether a process with the given PID exists on this
+// host.
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	err := unix.Kill(pid, 0)
+	return err == nil || errors.Is(err, unix.EPERM)
+}
+
+type boltLock struct {
+	store   *BoltStore
+	service string
+	info    LockInfo
+}
+
+// Unlock releases the lock, unless it has since been forcibly taken over by
+// another process.
+func (l *boltLock) Unlock() error {
+	return l.store.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(locksBucket)
+		if b == nil {
+			return nil
+		}
+
+		current := LockInfo{}
+		data := b.Get([]byte(l.service))
+		if data == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &current); err != nil {
+			return err
+		}
+		if current.PID != l.info.PID || !current.AcquiredAt.Equal(l.info.AcquiredAt) {
+			return nil
+		}
+
+		return b.Delete([]byte(l.service))
+	})
+}
+
+func (bs *BoltStore) Lock(service string, info LockInfo) (Lock, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bs.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(locksBucket)
+		if err != nil {
+			return err
+		}
+
+		if existing := b.Get([]byte(service)); existing != nil {
+			holder := &LockInfo{}
+			if err := json.Unmarshal(existing, holder); err != nil {
+				holder = nil
+			}
+
+			if holder == nil || processRunning(holder.PID) {
+				return &LockHeldError{Service: service, Holder: holder}
+			}
+
+			bs.Log.Info("replacing lock of process that is no longer running",
+				zap.String("service", service),
+				zap.Int("pid", holder.PID),
+			)
+		}
+
+		return b.Put([]byte(service), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bs.Log.Debug("acquired service lock", zap.String("service", service))
+	return &boltLock{store: bs, service: service, info: info}, nil
+}
+
+func (bs *BoltStore) ForceUnlock(service string) error {
+	bs.Log.Warn("forcibly removing service lock", zap.String("service", service))
+	return bs.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(locksBucket)
+		if b == nil {
+			return nil
+		}
+
+		return b.Delete([]byte(service))
+	})
+}
+
+func (bs *BoltStore) Verify() ([]FileReport, error) {
+	reports := []FileReport{}
+	err := bs.view(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(servicesBucket); b != nil {
+			err := b.ForEach(func(k, v []byte) error {
+				report := FileReport{
+					Service: string(k),
+					Path:    fmt.Sprintf("%s:%s/%s", bs.Path, servicesBucket, k),
+				}
+				_, report.Version, report.Err = decodeServiceState(v)
+				reports = append(reports, report)
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		history := tx.Bucket(historyBucket)
+		if history == nil {
+			return nil
+		}
+		return history.ForEach(func(service, _ []byte) error {
+			report := FileReport{
+				Service: string(service),
+				Path:    fmt.Sprintf("%s:%s/%s", bs.Path, historyBucket, service),
+			}
+			b := history.Bucket(service)
+			if b == nil {
+				report.Err = errors.New("history is not a bucket")
+				reports = append(reports, report)
+				return nil
+			}
+
+			report.Err = b.ForEach(func(k, v []byte) error {
+				if err := json.Unmarshal(v, &Deployment{}); err != nil {
+					return fmt.Errorf(
+						"deployment %d: %w", binary.BigEndian.Uint64(k), err,
+					)
+				}
+
+				return nil
+			})
+			reports = append(reports, report)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].Service < reports[j].Service
+	})
+
+	return reports, nil
+}
+
+// Purge removes the state, history and port allocations of all services. Locks are retained,
+// as they will be held by the caller.
+func (bs *BoltStore) Purge() error {
+	bs.Log.Debug("purging state", zap.String("path", bs.Path))
+	return bs.update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{servicesBucket, historyBucket, portsBucket} {
+			err := tx.DeleteBucket(name)
+			if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
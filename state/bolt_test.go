@@ -0,0 +1,188 @@
+package state
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap/zaptest"
+)
+
+func newTestBoltStore(t *testing.T) *BoltStore {
+	return &BoltStore{
+		Path: path.Join(t.TempDir(), "state.db"),
+		Log:  zaptest.NewLogger(t),
+	}
+}
+
+func TestBoltStore_ServiceState(t *testing.T) {
+	bs := newTestBoltStore(t)
+
+	got, err := bs.LoadServiceState("fizz")
+	require.NoError(t, err)
+	assert.Equal(t, &ServiceState{Version: currentVersion}, got)
+
+	want := &ServiceState{
+		Version:            currentVersion,
+		DeploymentID:       3,
+		LastDeployedAt:     time.Date(2000, 11, 2, 12, 0, 0, 0, time.UTC),
+		DeploymentStatus:   StatusRolledBack,
+		Tag:                "v1",
+		ActiveDeploymentID: 2,
+	}
+	require.NoError(t, bs.SaveServiceState("fizz", want))
+	require.NoError(t, bs.SaveServiceState("buzz", &ServiceState{}))
+
+	got, err = bs.LoadServiceState("fizz")
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	services, err := bs.ListServices()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"buzz", "fizz"}, services)
+}
+
+func TestBoltStore_Deployments(t *testing.T) {
+	bs := newTestBoltStore(t)
+
+	got, err := bs.ListDeployments("fizz")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	for i := 1; i <= maxHistory+5; i++ {
+		require.NoError(t, bs.SaveDeployment("fizz", &Deployment{
+			ID:     i,
+			Status: StatusFailure,
+		}))
+	}
+	// Replace an existing record
+	require.NoError(t, bs.SaveDeployment("fizz", &Deployment{
+		ID:     maxHistory + 5,
+		Status: StatusSuccess,
+		Images: map[string]string{"web": "fizz:buzz"},
+	}))
+
+	got, err = bs.ListDeployments("fizz")
+	require.NoError(t, err)
+	require.Len(t, got, maxHistory)
+	assert.Equal(t, 6, got[0].ID)
+	assert.Equal(t, maxHistory+5, got[len(got)-1].ID)
+
+	deployment, err := bs.LoadDeployment("fizz", maxHistory+5)
+	require.NoError(t, err)
+	assert.Equal(t, &Deployment{
+		ID:     maxHistory + 5,
+		Status: StatusSuccess,
+		Images: map[string]string{"web": "fizz:buzz"},
+	}, deployment)
+
+	_, err = bs.LoadDeployment("fizz", 1)
+	assert.ErrorIs(t, err, ErrDeploymentNotFound)
+	_, err = bs.LoadDeployment("buzz", 1)
+	assert.ErrorIs(t, err, ErrDeploymentNotFound)
+}
+
+func TestBoltStore_Lock(t *testing.T) {
+	bs := newTestBoltStore(t)
+	holder := LockInfo{
+		PID:        os.Getpid(),
+		User:       "alice",
+		AcquiredAt: time.Date(2000, 11, 2, 12, 0, 0, 0, time.UTC),
+	}
+
+	lock, err := bs.Lock("fizz", holder)
+	require.NoError(t, err)
+
+	_, err = bs.Lock("fizz", LockInfo{PID: os.Getpid(), User: "bob"})
+	heldErr := &LockHeldError{}
+	require.ErrorAs(t, err, &heldErr)
+	assert.Equal(t, &holder, heldErr.Holder)
+
+	require.NoError(t, lock.Unlock())
+
+	lock, err = bs.Lock("fizz", LockInfo{
+		PID:        os.Getpid(),
+		User:       "bob",
+		AcquiredAt: holder.AcquiredAt.Add(time.Minute),
+	})
+	require.NoError(t, err)
+
+	// A lock taken over after a forced unlock is not released by the
+	// original holder.
+	require.NoError(t, bs.ForceUnlock("fizz"))
+	newLock, err := bs.Lock("fizz", LockInfo{
+		PID:        os.Getpid(),
+		User:       "carol",
+		AcquiredAt: holder.AcquiredAt.Add(2 * time.Minute),
+	})
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+	_, err = bs.Lock("fizz", LockInfo{PID: os.Getpid()})
+	require.ErrorAs(t, err, &heldErr)
+	assert.Equal(t, "carol", heldErr.Holder.User)
+	require.NoError(t, newLock.Unlock())
+}
+
+func TestBoltStore_Lock_deadHolder(t *testing.T) {
+	bs := newTestBoltStore(t)
+
+	// PIDs are capped well below this, so it can never be running
+	_, err := bs.Lock("fizz", LockInfo{PID: 1 << 30, User: "alice"})
+	require.NoError(t, err)
+
+	lock, err := bs.Lock("fizz", LockInfo{PID: os.Getpid(), User: "bob"})
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+}
+
+func TestBoltStore_Verify(t *testing.T) {
+	bs := newTestBoltStore(t)
+
+	require.NoError(t, bs.SaveServiceState("good", &ServiceState{DeploymentID: 1}))
+	require.NoError(t, bs.SaveDeployment("good", &Deployment{ID: 1}))
+	require.NoError(t, bs.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(servicesBucket).Put([]byte("truncated"), []byte(`{"deploymentID":`))
+	}))
+
+	reports, err := bs.Verify()
+	require.NoError(t, err)
+	require.Len(t, reports, 3)
+
+	assert.Equal(t, "good", reports[0].Service)
+	assert.Equal(t, currentVersion, reports[0].Version)
+	assert.NoError(t, reports[0].Err)
+
+	assert.Equal(t, "good", reports[1].Service)
+	assert.Equal(t, bs.Path+":history/good", reports[1].Path)
+	assert.NoError(t, reports[1].Err)
+
+	assert.Equal(t, "truncated", reports[2].Service)
+	assert.Error(t, reports[2].Err)
+}
+
+func TestBoltStore_Purge(t *testing.T) {
+	bs := newTestBoltStore(t)
+
+	require.NoError(t, bs.SaveServiceState("fizz", &ServiceState{DeploymentID: 1}))
+	require.NoError(t, bs.SaveDeployment("fizz", &Deployment{ID: 1}))
+	lock, err := bs.Lock("fizz", LockInfo{PID: os.Getpid()})
+	require.NoError(t, err)
+
+	require.NoError(t, bs.Purge())
+
+	services, err := bs.ListServices()
+	require.NoError(t, err)
+	assert.Empty(t, services)
+	deployments, err := bs.ListDeployments("fizz")
+	require.NoError(t, err)
+	assert.Empty(t, deployments)
+
+	// Locks held during the purge are retained
+	_, err = bs.Lock("fizz", LockInfo{PID: os.Getpid()})
+	assert.ErrorAs(t, err, new(*LockHeldError))
+	require.NoError(t, lock.Unlock())
+}
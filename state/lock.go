@@ -0,0 +1,166 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// LockInfo describes the holder of a service lock.
+type LockInfo struct {
+	PID        int       `json:"pid"`
+	User       string    `json:"user"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+}
+
+// LockHeldError is returned when a service lock cannot be acquired because
+// another process holds it.
+type LockHeldError struct {
+	Service string
+	// Holder is the information recorded by the holder of the lock. It may be
+	// nil if this could not be read.
+	Holder *LockInfo
+}
+
+func (e *LockHeldError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("service '%s' is locked by another process", e.Service)
+	}
+
+	return fmt.Sprintf(
+		"service '%s' is locked by %s (pid %d) since %s",
+		e.Service,
+		e.Holder.User,
+		e.Holder.PID,
+		e.Holder.AcquiredAt.Format(time.RFC1123),
+	)
+}
+
+// Lock is an exclusive lock on a service, held until Unlock is called or the
+// process exits.
+type Lock interface {
+	Unlock() error
+}
+
+type fileLock struct {
+	file *os.File
+}
+
+// Unlock releases the lock. The lock file itself is left in place, as it may
+// already have been replaced by another process after a forced unlock.
+func (l *fileLock) Unlock() error {
+	if err := unix.Flock(int(l.file.Fd()), unix.LOCK_UN); err != nil {
+		l.file.Close()
+		return err
+	}
+
+	return l.file.Close()
+}
+
+func (fbs *FileBasedStore) locksDir() string {
+	return path.Join(fbs.RootPath, "locks")
+}
+
+func (fbs *FileBasedStore) lockPath(service string) string {
+	return path.Join(fbs.locksDir(), fmt.Sprintf("%s.lock", service))
+}
+
+// Lock attempts to acquire an exclusive lock on a service without blocking.
+// If another process holds the lock, a *LockHeldError is returned.
+//
+// The lock is implemented with flock(2), so it is released by the kernel if
+// the holding process crashes.
+func (fbs *FileBasedStore) Lock(service string, info LockInfo) (Lock, error) {
+	if err := os.MkdirAll(fbs.locksDir(), 0o755); err != nil {
+		return nil, err
+	}
+
+	lockPath := fbs.lockPath(service)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, err
+		}
+
+		err = unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			f.Close()
+			return nil, &LockHeldError{
+				Service: service,
+				Holder:  fbs.readLockInfo(lockPath),
+			}
+		} else if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		// If the lock file was removed by a forced unlock between us opening
+		// and locking it, we hold a lock nobody else can see. Try again.
+		fileStat, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		pathStat, err := os.Stat(lockPath)
+		if errors.Is(err, os.ErrNotExist) || (err == nil && !os.SameFile(fileStat, pathStat)) {
+			f.Close()
+			continue
+		} else if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		data, err := json.Marshal(info)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if _, err := f.WriteAt(data, 0); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		fbs.Log.Debug("acquired service lock", zap.String("service", service))
+		return &fileLock{file: f}, nil
+	}
+}
+
+func (fbs *FileBasedStore) readLockInfo(lockPath string) *LockInfo {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return nil
+	}
+
+	info := &LockInfo{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil
+	}
+
+	return info
+}
+
+// ForceUnlock removes the lock of a service regardless of who holds it. This
+// should only be used when the holder is known to no longer be running.
+func (fbs *FileBasedStore) ForceUnlock(service string) error {
+	fbs.Log.Warn("forcibly removing service lock", zap.String("service", service))
+	err := os.Remove(fbs.lockPath(service))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
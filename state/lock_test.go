@@ -0,0 +1,70 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestFileBasedStore_Lock(t *testing.T) {
+	fbs := &FileBasedStore{
+		RootPath: t.TempDir(),
+		Log:      zaptest.NewLogger(t),
+	}
+	holder := LockInfo{
+		PID:        1234,
+		User:       "alice",
+		AcquiredAt: time.Date(2000, 11, 2, 12, 0, 0, 0, time.UTC),
+	}
+
+	lock, err := fbs.Lock("fizz", holder)
+	require.NoError(t, err)
+
+	// Locks are independent between services
+	otherLock, err := fbs.Lock("buzz", LockInfo{})
+	require.NoError(t, err)
+	require.NoError(t, otherLock.Unlock())
+
+	_, err = fbs.Lock("fizz", LockInfo{PID: 5678, User: "bob"})
+	heldErr := &LockHeldError{}
+	require.ErrorAs(t, err, &heldErr)
+	assert.Equal(t, "fizz", heldErr.Service)
+	assert.Equal(t, &holder, heldErr.Holder)
+	assert.EqualError(
+		t,
+		err,
+		"service 'fizz' is locked by alice (pid 1234) since Thu, 02 Nov 2000 12:00:00 UTC",
+	)
+
+	require.NoError(t, lock.Unlock())
+
+	lock, err = fbs.Lock("fizz", LockInfo{PID: 5678, User: "bob"})
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+}
+
+func TestFileBasedStore_ForceUnlock(t *testing.T) {
+	fbs := &FileBasedStore{
+		RootPath: t.TempDir(),
+		Log:      zaptest.NewLogger(t),
+	}
+
+	// Removing a lock that does not exist is not an error
+	require.NoError(t, fbs.ForceUnlock("fizz"))
+
+	stuckLock, err := fbs.Lock("fizz", LockInfo{PID: 1234})
+	require.NoError(t, err)
+	defer stuckLock.Unlock()
+
+	_, err = fbs.Lock("fizz", LockInfo{PID: 5678})
+	require.ErrorAs(t, err, new(*LockHeldError))
+
+	require.NoError(t, fbs.ForceUnlock("fizz"))
+
+	lock, err := fbs.Lock("fizz", LockInfo{PID: 5678})
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+}
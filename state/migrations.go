@@ -0,0 +1,78 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedVersion is returned when a state file has been written by a
+// newer version of guvnor than the one reading it.
+var ErrUnsupportedVersion = errors.New("state version is newer than supported")
+
+// migration upgrades a raw service state document by a single version.
+type migration func(doc map[string]interface{}) error
+
+// migrations is the registry of upgrades applied to service state documents
+// when they are loaded. The migration at index N upgrades a document from
+// version N to version N+1, so new migrations must only ever be appended.
+var migrations = []migration{
+	migrateActiveDeploymentID,
+}
+
+// currentVersion is the version of the service state document written by this
+// version of guvnor.
+var currentVersion = len(migrations)
+
+// migrateActiveDeploymentID backfills activeDeploymentID, which did not exist
+// in unversioned state. Before it was introduced, the last deployment was
+// always the active one.
+func migrateActiveDeploymentID(doc map[string]interface{}) error {
+	if active, _ := doc["activeDeploymentID"].(float64); active == 0 {
+		doc["activeDeploymentID"] = doc["deploymentID"]
+	}
+
+	return nil
+}
+
+// documentVersion returns the version a service state document was stored
+// with. Documents without a version predate versioning and are version 0.
+func documentVersion(doc map[string]interface{}) (int, error) {
+	raw, ok := doc["version"]
+	if !ok {
+		return 0, nil
+	}
+
+	version, ok := raw.(float64)
+	if !ok || version < 0 || version != float64(int(version)) {
+		return 0, fmt.Errorf("invalid state version: %v", raw)
+	}
+
+	return int(version), nil
+}
+
+// migrateServiceState upgrades a raw service state document in place to the
+// current version.
+func migrateServiceState(doc map[string]interface{}) error {
+	version, err := documentVersion(doc)
+	if err != nil {
+		return err
+	}
+
+	if version > currentVersion {
+		return fmt.Errorf(
+			"%w: found %d, supported %d",
+			ErrUnsupportedVersion,
+			version,
+			currentVersion,
+		)
+	}
+
+	for ; version < currentVersion; version++ {
+		if err := migrations[version](doc); err != nil {
+			return fmt.Errorf("migrating from version %d: %w", version, err)
+		}
+	}
+	doc["version"] = currentVersion
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_migrateServiceState(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     map[string]interface{}
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name: "unversioned",
+			doc: map[string]interface{}{
+				"deploymentID": float64(4),
+			},
+			want: map[string]interface{}{
+				"version":            currentVersion,
+				"deploymentID":       float64(4),
+				"activeDeploymentID": float64(4),
+			},
+		},
+		{
+			name: "unversioned with active deployment",
+			doc: map[string]interface{}{
+				"deploymentID":       float64(4),
+				"activeDeploymentID": float64(3),
+			},
+			want: map[string]interface{}{
+				"version":            currentVersion,
+				"deploymentID":       float64(4),
+				"activeDeploymentID": float64(3),
+			},
+		},
+		{
+			name: "current",
+			doc: map[string]interface{}{
+				"version":            float64(currentVersion),
+				"deploymentID":       float64(4),
+				"activeDeploymentID": float64(0),
+			},
+			want: map[string]interface{}{
+				"version":            currentVersion,
+				"deploymentID":       float64(4),
+				"activeDeploymentID": float64(0),
+			},
+		},
+		{
+			name: "invalid version",
+			doc: map[string]interface{}{
+				"version": "one",
+			},
+			wantErr: "invalid state version: one",
+		},
+		{
+			name: "newer version",
+			doc: map[string]interface{}{
+				"version": float64(currentVersion + 1),
+			},
+			wantErr: "state version is newer than supported: found 2, supported 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := migrateServiceState(tt.doc)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, tt.doc)
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// PortAllocation records a host port reserved for a container.
+type PortAllocation struct {
+	Port        int       `json:"port"`
+	Service     string    `json:"service"`
+	Container   string    `json:"container"`
+	AllocatedAt time.Time `json:"allocatedAt"`
+}
+
+// ErrNoFreePorts is returned when every port in the allocation range is
+// either allocated or in use.
+var ErrNoFreePorts = errors.New("no free ports in range")
+
+// selectPort returns the lowest port between min and max (inclusive) that is
+// not allocated and that available reports as free.
+func selectPort(
+	min, max int, allocated map[int]bool, available func(port int) bool,
+) (int, error) {
+	for port := min; port <= max; port++ {
+		if allocated[port] {
+			continue
+		}
+		if available != nil && !available(port) {
+			continue
+		}
+
+		return port, nil
+	}
+
+	return 0, fmt.Errorf("%w (%d-%d)", ErrNoFreePorts, min, max)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortPortAllocations(allocs []PortAllocation) {
+	sort.Slice(allocs, func(i, j int) bool {
+		return allocs[i].Port < allocs[j].Port
+	})
+}
+
+func (fbs *FileBasedStore) portsDir() string {
+	return path.Join(fbs.RootPath, "ports")
+}
+
+func (fbs *FileBasedStore) portsPath() string {
+	return path.Join(fbs.portsDir(), "allocations.json")
+}
+
+// updatePortAllocations reads the port allocations, passes them to fn and
+// writes back the allocations it returns. An flock is held throughout, so that
+// concurrent deployments of different services cannot allocate the same port.
+func (fbs *FileBasedStore) updatePortAllocations(
+	fn func([]PortAllocation) ([]PortAllocation, error),
+) error {
+	if err := os.MkdirAll(fbs.portsDir(), 0o755); err != nil {
+		return err
+	}
+
+	lockFile, err := os.OpenFile(
+		path.Join(fbs.portsDir(), "allocations.lock"), os.O_CREATE|os.O_RDWR, 0o644,
+	)
+	if err != nil {
+		return err
+	}
+	defer lockFile.Close()
+	if err := unix.Flock(int(lockFile.Fd()), unix.LOCK_EX); err != nil {
+		return fmt.Errorf("locking port allocations: %w", err)
+	}
+	defer unix.Flock(int(lockFile.Fd()), unix.LOCK_UN)
+
+	allocs, err := fbs.readPortAllocations()
+	if err != nil {
+		return err
+	}
+
+	allocs, err = fn(allocs)
+	if err != nil {
+		return err
+	}
+	sortPortAllocations(allocs)
+
+	data, err := json.MarshalIndent(allocs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(fbs.portsPath(), data, 0o644)
+}
+
+func (fbs *FileBasedStore) readPortAllocations() ([]PortAllocation, error) {
+	data, err := os.ReadFile(fbs.portsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return []PortAllocation{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	allocs := []PortAllocation{}
+	if err := json.Unmarshal(data, &allocs); err != nil {
+		return nil, fmt.Errorf("decoding port allocations: %w", err)
+	}
+
+	return allocs, nil
+}
+
+// AllocatePort reserves the lowest port between min and max (inclusive) that
+// is not already allocated and that available reports as free, recording it
+// against the container in alloc.
+func (fbs *FileBasedStore) AllocatePort(
+	min, max int, alloc PortAllocation, available func(port int) bool,
+) (int, error) {
+	err := fbs.updatePortAllocations(func(allocs []PortAllocation) ([]PortAllocation, error) {
+		allocated := map[int]bool{}
+		for _, existing := range allocs {
+			allocated[existing.Port] = true
+		}
+
+		port, err := selectPort(min, max, allocated, available)
+		if err != nil {
+			return nil, err
+		}
+		alloc.Port = port
+
+		return append(allocs, alloc), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	fbs.Log.Debug("allocated port",
+		zap.Int("port", alloc.Port),
+		zap.String("service", alloc.Service),
+		zap.String("container", alloc.Container),
+	)
+	return alloc.Port, nil
+}
+
+// ReleasePorts releases all ports allocated to the given containers of a
+// service.
+func (fbs *FileBasedStore) ReleasePorts(service string, containers []string) error {
+	return fbs.updatePortAllocations(func(allocs []PortAllocation) ([]PortAllocation, error) {
+		retained := make([]PortAllocation, 0, len(allocs))
+		for _, alloc := range allocs {
+			if alloc.Service == service && containsString(containers, alloc.Container) {
+				fbs.Log.Debug("released port",
+					zap.Int("port", alloc.Port),
+					zap.String("service", alloc.Service),
+					zap.String("container", alloc.Container),
+				)
+				continue
+			}
+			retained = append(retained, alloc)
+		}
+
+		return retained, nil
+	})
+}
+
+// ListPortAllocations returns all allocated ports, ordered by port.
+func (fbs *FileBasedStore) ListPortAllocations() ([]PortAllocation, error) {
+	allocs, err := fbs.readPortAllocations()
+	if err != nil {
+		return nil, err
+	}
+	sortPortAllocations(allocs)
+
+	return allocs, nil
+}
+
+func portKey(port int) []byte {
+	return deploymentKey(port)
+}
+
+// AllocatePort reserves the lowest port between min and max (inclusive) that
+// is not already allocated and that available reports as free, recording it
+// against the container in alloc.
+func (bs *BoltStore) AllocatePort(
+	min, max int, alloc PortAllocation, available func(port int) bool,
+) (int, error) {
+	err := bs.update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(portsBucket)
+		if err != nil {
+			return err
+		}
+
+		allocated := map[int]bool{}
+		err = bucket.ForEach(func(_, v []byte) error {
+			existing := PortAllocation{}
+			if err := json.Unmarshal(v, &existing); err != nil {
+				return fmt.Errorf("decoding port allocation: %w", err)
+			}
+			allocated[existing.Port] = true
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		port, err := selectPort(min, max, allocated, available)
+		if err != nil {
+			return err
+		}
+		alloc.Port = port
+
+		data, err := json.Marshal(alloc)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(portKey(port), data)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	bs.Log.Debug("allocated port",
+		zap.Int("port", alloc.Port),
+		zap.String("service", alloc.Service),
+		zap.String("container", alloc.Container),
+	)
+	return alloc.Port, nil
+}
+
+// ReleasePorts releases all ports allocated to the given containers of a
+// service.
+func (bs *BoltStore) ReleasePorts(service string, containers []string) error {
+	return bs.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(portsBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		toRelease := [][]byte{}
+		err := bucket.ForEach(func(k, v []byte) error {
+			alloc := PortAllocation{}
+			if err := json.Unmarshal(v, &alloc); err != nil {
+				return fmt.Errorf("decoding port allocation: %w", err)
+			}
+			if alloc.Service == service && containsString(containers, alloc.Container) {
+				bs.Log.Debug("released port",
+					zap.Int("port", alloc.Port),
+					zap.String("service", alloc.Service),
+					zap.String("container", alloc.Container),
+				)
+				toRelease = append(toRelease, k)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Keys cannot be deleted while iterating with ForEach.
+		for _, k := range toRelease {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ListPortAllocations returns all allocated ports, ordered by port.
+func (bs *BoltStore) ListPortAllocations() ([]PortAllocation, error) {
+	allocs := []PortAllocation{}
+	err := bs.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(portsBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(_, v []byte) error {
+			alloc := PortAllocation{}
+			if err := json.Unmarshal(v, &alloc); err != nil {
+				return fmt.Errorf("decoding port allocation: %w", err)
+			}
+			allocs = append(allocs, alloc)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return allocs, nil
+}
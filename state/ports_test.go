@@ -0,0 +1,96 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func testPortAllocation(t *testing.T, store Store) {
+	allocatedAt := time.Date(2000, 11, 2, 12, 0, 0, 0, time.UTC)
+	allocate := func(service, container string, available func(int) bool) (int, error) {
+		return store.AllocatePort(30000, 30003, PortAllocation{
+			Service:     service,
+			Container:   container,
+			AllocatedAt: allocatedAt,
+		}, available)
+	}
+
+	port, err := allocate("fizz", "fizz-web-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 30000, port)
+
+	// Ports reported as unavailable, e.g bound outside of guvnor, are skipped
+	port, err = allocate("fizz", "fizz-web-2", func(port int) bool {
+		return port != 30001
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 30002, port)
+
+	port, err = allocate("buzz", "buzz-web-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 30001, port)
+
+	port, err = allocate("buzz", "buzz-web-2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 30003, port)
+
+	_, err = allocate("buzz", "buzz-web-3", nil)
+	assert.ErrorIs(t, err, ErrNoFreePorts)
+
+	allocs, err := store.ListPortAllocations()
+	require.NoError(t, err)
+	assert.Equal(t, []PortAllocation{
+		{Port: 30000, Service: "fizz", Container: "fizz-web-1", AllocatedAt: allocatedAt},
+		{Port: 30001, Service: "buzz", Container: "buzz-web-1", AllocatedAt: allocatedAt},
+		{Port: 30002, Service: "fizz", Container: "fizz-web-2", AllocatedAt: allocatedAt},
+		{Port: 30003, Service: "buzz", Container: "buzz-web-2", AllocatedAt: allocatedAt},
+	}, allocs)
+
+	// Only the ports of the named containers of the service are released
+	require.NoError(t, store.ReleasePorts("fizz", []string{"fizz-web-1", "buzz-web-1"}))
+	allocs, err = store.ListPortAllocations()
+	require.NoError(t, err)
+	assert.Len(t, allocs, 3)
+
+	port, err = allocate("buzz", "buzz-web-3", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 30000, port)
+
+	require.NoError(t, store.Purge())
+	allocs, err = store.ListPortAllocations()
+	require.NoError(t, err)
+	assert.Empty(t, allocs)
+}
+
+func TestFileBasedStore_PortAllocation(t *testing.T) {
+	testPortAllocation(t, &FileBasedStore{
+		RootPath: t.TempDir(),
+		Log:      zaptest.NewLogger(t),
+	})
+}
+
+func TestBoltStore_PortAllocation(t *testing.T) {
+	testPortAllocation(t, newTestBoltStore(t))
+}
+
+func TestFileBasedStore_PortAllocation_notService(t *testing.T) {
+	fbs := &FileBasedStore{
+		RootPath: t.TempDir(),
+		Log:      zaptest.NewLogger(t),
+	}
+
+	_, err := fbs.AllocatePort(30000, 30000, PortAllocation{
+		Service:   "fizz",
+		Container: "fizz-web-1",
+	}, nil)
+	require.NoError(t, err)
+
+	// Port allocations must not be mistaken for the state of a service
+	services, err := fbs.ListServices()
+	require.NoError(t, err)
+	assert.Empty(t, services)
+}
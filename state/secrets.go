@@ -0,0 +1,305 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/sys/unix"
+)
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+const (
+	secretKeySize   = 32
+	secretNonceSize = 24
+	secretsVersion  = 1
+)
+
+// SecretInfo describes a stored secret, without its value.
+type SecretInfo struct {
+	// Service is the service the secret belongs to, or empty for secrets
+	// available to every service.
+	Service   string    `json:"service,omitempty"`
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type storedSecret struct {
+	SecretInfo
+	// Value is the nonce followed by the value sealed with secretbox, base64
+	// encoded.
+	Value string `json:"value"`
+}
+
+type secretsFile struct {
+	Version int            `json:"version"`
+	Secrets []storedSecret `json:"secrets"`
+}
+
+// SecretStore persists secrets in a single file, with each value encrypted
+// using NaCl secretbox. The key is read from KeyFile, which is generated when
+// the first secret is set.
+type SecretStore struct {
+	Path    string
+	KeyFile string
+	Log     *zap.Logger
+}
+
+// checkOwnerOnly ensures a file cannot be accessed by anyone other than its
+// owner.
+func checkOwnerOnly(name string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return fmt.Errorf(
+			"%s must only be accessible by its owner, but has mode %04o", name, perm,
+		)
+	}
+
+	return nil
+}
+
+// loadKey reads the key used to encrypt secrets. If the key does not exist
+// and create is true, a new random key is generated. Keys should only be
+// created while the secrets are locked by update.
+func (ss *SecretStore) loadKey(create bool) (*[secretKeySize]byte, error) {
+	data, err := os.ReadFile(ss.KeyFile)
+	if errors.Is(err, os.ErrNotExist) && create {
+		return ss.generateKey()
+	} else if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf(
+			"secrets key %s does not exist, it is created when a secret is first set",
+			ss.KeyFile,
+		)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := checkOwnerOnly(ss.KeyFile); err != nil {
+		return nil, err
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil || len(decoded) != secretKeySize {
+		return nil, fmt.Errorf("secrets key %s is not a valid key", ss.KeyFile)
+	}
+
+	key := &[secretKeySize]byte{}
+	copy(key[:], decoded)
+	return key, nil
+}
+
+func (ss *SecretStore) generateKey() (*[secretKeySize]byte, error) {
+	key := &[secretKeySize]byte{}
+	if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ss.KeyFile), 0o700); err != nil {
+		return nil, err
+	}
+
+	// Keys are only generated while the secrets are locked, so an existing
+	// key cannot be replaced by a concurrent update.
+	ss.Log.Info("generating secrets key", zap.String("path", ss.KeyFile))
+	err := WriteFileAtomic(
+		ss.KeyFile, []byte(base64.StdEncoding.EncodeToString(key[:])), 0o600,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (ss *SecretStore) read() (*secretsFile, error) {
+	data, err := os.ReadFile(ss.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &secretsFile{Version: secretsVersion}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	file := &secretsFile{}
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("decoding secrets: %w", err)
+	}
+	if file.Version > secretsVersion {
+		return nil, fmt.Errorf(
+			"secrets file is version %d, newer than supported version %d",
+			file.Version, secretsVersion,
+		)
+	}
+
+	return file, nil
+}
+
+// update reads the secrets, passes them to fn and writes them back. An flock
+// is held throughout so concurrent updates are not lost.
+func (ss *SecretStore) update(fn func(file *secretsFile) error) error {
+	if err := os.MkdirAll(filepath.Dir(ss.Path), 0o700); err != nil {
+		return err
+	}
+
+	lockFile, err := os.OpenFile(ss.Path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer lockFile.Close()
+	if err := unix.Flock(int(lockFile.Fd()), unix.LOCK_EX); err != nil {
+		return fmt.Errorf("locking secrets: %w", err)
+	}
+	defer unix.Flock(int(lockFile.Fd()), unix.LOCK_UN)
+
+	file, err := ss.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(file); err != nil {
+		return err
+	}
+	file.Version = secretsVersion
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(ss.Path, data, 0o600)
+}
+
+func findSecret(secrets []storedSecret, service, name string) int {
+	for i, secret := range secrets {
+		if secret.Service == service && secret.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Set encrypts and stores the value of a secret, replacing any existing value.
+// An empty service stores a secret available to every service.
+func (ss *SecretStore) Set(service, name, value string) error {
+	return ss.update(func(file *secretsFile) error {
+		// The key is loaded while the secrets are locked, so that concurrent
+		// calls cannot each generate a different key.
+		key, err := ss.loadKey(true)
+		if err != nil {
+			return err
+		}
+
+		nonce := [secretNonceSize]byte{}
+		if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+			return err
+		}
+		sealed := secretbox.Seal(nonce[:], []byte(value), &nonce, key)
+
+		secret := storedSecret{
+			SecretInfo: SecretInfo{
+				Service:   service,
+				Name:      name,
+				UpdatedAt: time.Now().UTC(),
+			},
+			Value: base64.StdEncoding.EncodeToString(sealed),
+		}
+
+		if i := findSecret(file.Secrets, service, name); i >= 0 {
+			file.Secrets[i] = secret
+		} else {
+			file.Secrets = append(file.Secrets, secret)
+		}
+
+		ss.Log.Debug("set secret",
+			zap.String("service", service),
+			zap.String("name", name),
+		)
+		return nil
+	})
+}
+
+// Get decrypts the value of a secret, returning ErrSecretNotFound if it has
+// not been set.
+func (ss *SecretStore) Get(service, name string) (string, error) {
+	file, err := ss.read()
+	if err != nil {
+		return "", err
+	}
+
+	i := findSecret(file.Secrets, service, name)
+	if i < 0 {
+		return "", ErrSecretNotFound
+	}
+
+	key, err := ss.loadKey(false)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(file.Secrets[i].Value)
+	if err != nil || len(sealed) < secretNonceSize {
+		return "", fmt.Errorf("secret %s is corrupt", name)
+	}
+	nonce := [secretNonceSize]byte{}
+	copy(nonce[:], sealed[:secretNonceSize])
+
+	value, ok := secretbox.Open(nil, sealed[secretNonceSize:], &nonce, key)
+	if !ok {
+		return "", fmt.Errorf(
+			"secret %s could not be decrypted, the secrets key may have changed",
+			name,
+		)
+	}
+
+	return string(value), nil
+}
+
+// List returns the secrets of a service, ordered by name. Secrets available to
+// every service are listed when service is empty.
+func (ss *SecretStore) List(service string) ([]SecretInfo, error) {
+	file, err := ss.read()
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := []SecretInfo{}
+	for _, secret := range file.Secrets {
+		if secret.Service == service {
+			secrets = append(secrets, secret.SecretInfo)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Name < secrets[j].Name
+	})
+
+	return secrets, nil
+}
+
+// Remove deletes a secret, returning ErrSecretNotFound if it has not been set.
+func (ss *SecretStore) Remove(service, name string) error {
+	return ss.update(func(file *secretsFile) error {
+		i := findSecret(file.Secrets, service, name)
+		if i < 0 {
+			return ErrSecretNotFound
+		}
+
+		file.Secrets = append(file.Secrets[:i], file.Secrets[i+1:]...)
+		ss.Log.Debug("removed secret",
+			zap.String("service", service),
+			zap.String("name", name),
+		)
+		return nil
+	})
+}
@@ -0,0 +1,115 @@
+package state
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func newTestSecretStore(t *testing.T) *SecretStore {
+	dir := t.TempDir()
+	return &SecretStore{
+		Path:    path.Join(dir, "secrets", "secrets.json"),
+		KeyFile: path.Join(dir, "secrets.key"),
+		Log:     zaptest.NewLogger(t),
+	}
+}
+
+func TestSecretStore(t *testing.T) {
+	ss := newTestSecretStore(t)
+
+	_, err := ss.Get("fizz", "API_KEY")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	require.NoError(t, ss.Set("fizz", "API_KEY", "hunter2"))
+	require.NoError(t, ss.Set("fizz", "DATABASE_PASSWORD", "correct horse"))
+	require.NoError(t, ss.Set("", "API_KEY", "global"))
+	require.NoError(t, ss.Set("fizz", "API_KEY", "hunter3"))
+
+	got, err := ss.Get("fizz", "API_KEY")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter3", got)
+	got, err = ss.Get("", "API_KEY")
+	require.NoError(t, err)
+	assert.Equal(t, "global", got)
+
+	// Values are never stored in plain text
+	data, err := os.ReadFile(ss.Path)
+	require.NoError(t, err)
+	assert.False(t, strings.Contains(string(data), "hunter"))
+	assert.False(t, strings.Contains(string(data), "correct horse"))
+
+	secrets, err := ss.List("fizz")
+	require.NoError(t, err)
+	require.Len(t, secrets, 2)
+	assert.Equal(t, "API_KEY", secrets[0].Name)
+	assert.Equal(t, "DATABASE_PASSWORD", secrets[1].Name)
+
+	require.NoError(t, ss.Remove("fizz", "API_KEY"))
+	assert.ErrorIs(t, ss.Remove("fizz", "API_KEY"), ErrSecretNotFound)
+	secrets, err = ss.List("fizz")
+	require.NoError(t, err)
+	assert.Len(t, secrets, 1)
+
+	info, err := os.Stat(ss.KeyFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestSecretStore_keyPermissions(t *testing.T) {
+	ss := newTestSecretStore(t)
+	require.NoError(t, ss.Set("fizz", "API_KEY", "hunter2"))
+
+	require.NoError(t, os.Chmod(ss.KeyFile, 0o644))
+	_, err := ss.Get("fizz", "API_KEY")
+	assert.EqualError(t, err, ss.KeyFile+
+		" must only be accessible by its owner, but has mode 0644")
+}
+
+func TestSecretStore_keyChanged(t *testing.T) {
+	ss := newTestSecretStore(t)
+	require.NoError(t, ss.Set("fizz", "API_KEY", "hunter2"))
+
+	require.NoError(t, os.Remove(ss.KeyFile))
+	_, err := ss.Get("fizz", "API_KEY")
+	assert.EqualError(t, err, "secrets key "+ss.KeyFile+
+		" does not exist, it is created when a secret is first set")
+
+	// Setting another secret generates a new key, which cannot decrypt
+	// the existing secret
+	require.NoError(t, ss.Set("fizz", "OTHER", "value"))
+	_, err = ss.Get("fizz", "API_KEY")
+	assert.EqualError(t, err,
+		"secret API_KEY could not be decrypted, the secrets key may have changed")
+}
+
+func TestSecretStore_concurrentFirstSet(t *testing.T) {
+	ss := newTestSecretStore(t)
+
+	// Each secret is set by a separate store, as if by a separate process,
+	// and all must be encrypted with the same key.
+	names := []string{"A", "B", "C", "D", "E", "F", "G", "H"}
+	wg := sync.WaitGroup{}
+	for _, name := range names {
+		name := name
+		store := *ss
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, store.Set("fizz", name, "value-"+name))
+		}()
+	}
+	wg.Wait()
+
+	for _, name := range names {
+		got, err := ss.Get("fizz", name)
+		require.NoError(t, err)
+		assert.Equal(t, "value-"+name, got)
+	}
+}
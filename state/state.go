@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -16,49 +18,293 @@ type DeploymentStatus string
 var (
 	StatusSuccess DeploymentStatus = "SUCCESS"
 	StatusFailure DeploymentStatus = "FAILURE"
+	// StatusRolledBack indicates the deployment failed and the previous
+	// deployment was restored.
+	StatusRolledBack DeploymentStatus = "ROLLED_BACK"
 )
 
+// maxHistory is the number of deployments that will be retained in the history
+// of a service. Older deployments are discarded.
+const maxHistory = 25
+
+var ErrDeploymentNotFound = errors.New("deployment not found in history")
+
 type FileBasedStore struct {
 	RootPath string
 	Log      *zap.Logger
 }
 
 type ServiceState struct {
+	// Version is the schema version of the stored state. It is set when the
+	// state is saved and state from older versions is migrated on load.
+	Version          int              `json:"version"`
 	DeploymentID     int              `json:"deploymentID"`
 	LastDeployedAt   time.Time        `json:"lastDeployedAt"`
 	DeploymentStatus DeploymentStatus `json:"deploymentStatus"`
+	// Tag is the default image tag that was used by the last deployment.
+	Tag string `json:"tag,omitempty"`
+	// ActiveDeploymentID is the deployment whose containers are currently
+	// running. This differs from DeploymentID when the last deployment was
+	// rolled back.
+	ActiveDeploymentID int `json:"activeDeploymentID"`
+}
+
+// Deployment is a record of a single deployment of a service, including
+// enough information to repeat it.
+type Deployment struct {
+	ID          int              `json:"id"`
+	Status      DeploymentStatus `json:"status"`
+	StartedAt   time.Time        `json:"startedAt"`
+	FinishedAt  time.Time        `json:"finishedAt"`
+	TriggeredBy string           `json:"triggeredBy"`
+	Tag         string           `json:"tag,omitempty"`
+	// Images is a map of process name to the image that process was deployed
+	// with.
+	Images map[string]string `json:"images"`
+	// Config is a YAML snapshot of the service configuration that was
+	// deployed.
+	Config string `json:"config"`
+	// RollbackOf is the ID of the deployment that this deployment restored,
+	// if it was triggered by a rollback.
+	RollbackOf int `json:"rollbackOf,omitempty"`
 }
 
 func (fbs *FileBasedStore) servicePath(service string) string {
 	return path.Join(fbs.RootPath, fmt.Sprintf("%s.json", service))
 }
 
+func (fbs *FileBasedStore) historyDir() string {
+	return path.Join(fbs.RootPath, "history")
+}
+
+func (fbs *FileBasedStore) historyPath(service string) string {
+	return path.Join(fbs.historyDir(), fmt.Sprintf("%s.json", service))
+}
+
 func (fbs *FileBasedStore) LoadServiceState(service string) (*ServiceState, error) {
-	data, err := os.ReadFile(fbs.servicePath(service))
+	out, _, err := fbs.readServiceState(fbs.servicePath(service))
 	if errors.Is(err, os.ErrNotExist) {
 		// Return default state
 		return &ServiceState{
+			Version:      currentVersion,
 			DeploymentID: 0,
 		}, nil
 	} else if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("loading state of service %s: %w", service, err)
 	}
 
+	return out, nil
+}
+
+// readServiceState reads and migrates a service state file, also returning
+// the version it was stored with.
+func (fbs *FileBasedStore) readServiceState(statePath string) (*ServiceState, int, error) {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return decodeServiceState(data)
+}
+
+// decodeServiceState parses and migrates a stored service state document,
+// also returning the version it was stored with.
+func decodeServiceState(data []byte) (*ServiceState, int, error) {
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+
+	storedVersion, err := documentVersion(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := migrateServiceState(doc); err != nil {
+		return nil, storedVersion, err
+	}
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, storedVersion, err
+	}
 	out := &ServiceState{}
-	if err := json.Unmarshal(data, out); err != nil {
+	if err := json.Unmarshal(migrated, out); err != nil {
+		return nil, storedVersion, err
+	}
+
+	return out, storedVersion, nil
+}
+
+// encodeServiceState serialises service state, stamping it with the current
+// version.
+func encodeServiceState(state *ServiceState) ([]byte, error) {
+	versioned := *state
+	versioned.Version = currentVersion
+
+	return json.Marshal(versioned)
+}
+
+func (fbs *FileBasedStore) SaveServiceState(service string, state *ServiceState) error {
+	data, err := encodeServiceState(state)
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(fbs.servicePath(service), data, 0o644)
+}
+
+// ListDeployments returns the retained deployment history for a service,
+// ordered from oldest to newest.
+func (fbs *FileBasedStore) ListDeployments(service string) ([]Deployment, error) {
+	data, err := os.ReadFile(fbs.historyPath(service))
+	if errors.Is(err, os.ErrNotExist) {
+		return []Deployment{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	out := []Deployment{}
+	if err := json.Unmarshal(data, &out); err != nil {
 		return nil, err
 	}
 
 	return out, nil
 }
 
-func (fbs *FileBasedStore) SaveServiceState(service string, state *ServiceState) error {
-	data, err := json.Marshal(state)
+// LoadDeployment returns a specific deployment from the history of a service.
+func (fbs *FileBasedStore) LoadDeployment(service string, id int) (*Deployment, error) {
+	deployments, err := fbs.ListDeployments(service)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, deployment := range deployments {
+		if deployment.ID == id {
+			return &deployment, nil
+		}
+	}
+
+	return nil, ErrDeploymentNotFound
+}
+
+// SaveDeployment adds a deployment to the history of a service, replacing any
+// existing record with the same ID.
+func (fbs *FileBasedStore) SaveDeployment(service string, deployment *Deployment) error {
+	deployments, err := fbs.ListDeployments(service)
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i := range deployments {
+		if deployments[i].ID == deployment.ID {
+			deployments[i] = *deployment
+			replaced = true
+		}
+	}
+	if !replaced {
+		deployments = append(deployments, *deployment)
+	}
+
+	sort.Slice(deployments, func(i, j int) bool {
+		return deployments[i].ID < deployments[j].ID
+	})
+	if len(deployments) > maxHistory {
+		deployments = deployments[len(deployments)-maxHistory:]
+	}
+
+	data, err := json.Marshal(deployments)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(fbs.servicePath(service), data, 0o644)
+	if err := os.MkdirAll(fbs.historyDir(), 0o755); err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(fbs.historyPath(service), data, 0o644)
+}
+
+// ListServices returns the names of all services that have stored state.
+func (fbs *FileBasedStore) ListServices() ([]string, error) {
+	files, err := os.ReadDir(fbs.RootPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	services := []string{}
+	for _, file := range files {
+		if file.IsDir() || path.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		services = append(services, strings.TrimSuffix(file.Name(), ".json"))
+	}
+
+	return services, nil
+}
+
+// FileReport is the result of verifying a single state file.
+type FileReport struct {
+	Service string
+	Path    string
+	// Version is the schema version the file was stored with. This is only
+	// populated for service state files.
+	Version int
+	// Err describes why the file could not be read, or is nil if it is
+	// valid.
+	Err error
+}
+
+// Verify reads every service state and history file, reporting any that are
+// corrupt or unreadable.
+func (fbs *FileBasedStore) Verify() ([]FileReport, error) {
+	services, err := fbs.ListServices()
+	if err != nil {
+		return nil, err
+	}
+
+	historyFiles, err := os.ReadDir(fbs.historyDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, file := range historyFiles {
+		if file.IsDir() || path.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		// Include services that only have history
+		service := strings.TrimSuffix(file.Name(), ".json")
+		found := false
+		for _, s := range services {
+			found = found || s == service
+		}
+		if !found {
+			services = append(services, service)
+		}
+	}
+	sort.Strings(services)
+
+	reports := []FileReport{}
+	for _, service := range services {
+		statePath := fbs.servicePath(service)
+		if _, err := os.Stat(statePath); !errors.Is(err, os.ErrNotExist) {
+			report := FileReport{Service: service, Path: statePath}
+			_, report.Version, report.Err = fbs.readServiceState(statePath)
+			reports = append(reports, report)
+		}
+
+		historyPath := fbs.historyPath(service)
+		if _, err := os.Stat(historyPath); !errors.Is(err, os.ErrNotExist) {
+			report := FileReport{Service: service, Path: historyPath}
+			_, report.Err = fbs.ListDeployments(service)
+			reports = append(reports, report)
+		}
+	}
+
+	return reports, nil
 }
 
 func (fbs *FileBasedStore) Purge() error {
@@ -80,5 +326,11 @@ func (fbs *FileBasedStore) Purge() error {
 		}
 	}
 
-	return nil
+	fbs.Log.Debug("purging port allocations", zap.String("path", fbs.portsDir()))
+	if err := os.RemoveAll(fbs.portsDir()); err != nil {
+		return err
+	}
+
+	fbs.Log.Debug("purging history", zap.String("path", fbs.historyDir()))
+	return os.RemoveAll(fbs.historyDir())
 }
@@ -0,0 +1,192 @@
+package state
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestFileBasedStore_ServiceState(t *testing.T) {
+	fbs := &FileBasedStore{
+		RootPath: t.TempDir(),
+		Log:      zaptest.NewLogger(t),
+	}
+
+	got, err := fbs.LoadServiceState("fizz")
+	require.NoError(t, err)
+	assert.Equal(t, &ServiceState{Version: currentVersion}, got)
+
+	want := &ServiceState{
+		Version:          currentVersion,
+		DeploymentID:     3,
+		LastDeployedAt:   time.Date(2000, 11, 2, 12, 0, 0, 0, time.UTC),
+		DeploymentStatus: StatusRolledBack,
+		Tag:              "v1",
+		// Ensure the active deployment can lag behind the latest deployment
+		ActiveDeploymentID: 2,
+	}
+	require.NoError(t, fbs.SaveServiceState("fizz", want))
+
+	got, err = fbs.LoadServiceState("fizz")
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestFileBasedStore_LoadServiceState_migrates(t *testing.T) {
+	fbs := &FileBasedStore{
+		RootPath: t.TempDir(),
+		Log:      zaptest.NewLogger(t),
+	}
+
+	err := os.WriteFile(
+		path.Join(fbs.RootPath, "fizz.json"),
+		[]byte(`{"deploymentID":7,"deploymentStatus":"SUCCESS"}`),
+		0o644,
+	)
+	require.NoError(t, err)
+
+	got, err := fbs.LoadServiceState("fizz")
+	require.NoError(t, err)
+	assert.Equal(t, currentVersion, got.Version)
+	assert.Equal(t, 7, got.ActiveDeploymentID)
+
+	// Ensure a rolled back first deployment stored by the current version is
+	// not mistaken for unversioned state.
+	require.NoError(t, fbs.SaveServiceState("fizz", &ServiceState{
+		DeploymentID:       1,
+		DeploymentStatus:   StatusRolledBack,
+		ActiveDeploymentID: 0,
+	}))
+	got, err = fbs.LoadServiceState("fizz")
+	require.NoError(t, err)
+	assert.Equal(t, 0, got.ActiveDeploymentID)
+}
+
+func TestFileBasedStore_LoadServiceState_newerVersion(t *testing.T) {
+	fbs := &FileBasedStore{
+		RootPath: t.TempDir(),
+		Log:      zaptest.NewLogger(t),
+	}
+
+	err := os.WriteFile(
+		path.Join(fbs.RootPath, "fizz.json"),
+		[]byte(`{"version":9999,"deploymentID":7}`),
+		0o644,
+	)
+	require.NoError(t, err)
+
+	_, err = fbs.LoadServiceState("fizz")
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestFileBasedStore_Verify(t *testing.T) {
+	fbs := &FileBasedStore{
+		RootPath: t.TempDir(),
+		Log:      zaptest.NewLogger(t),
+	}
+
+	require.NoError(t, fbs.SaveServiceState("good", &ServiceState{DeploymentID: 1}))
+	require.NoError(t, fbs.SaveDeployment("good", &Deployment{ID: 1}))
+	require.NoError(t, os.WriteFile(
+		path.Join(fbs.RootPath, "old.json"),
+		[]byte(`{"deploymentID":3}`),
+		0o644,
+	))
+	require.NoError(t, os.WriteFile(
+		path.Join(fbs.RootPath, "truncated.json"),
+		[]byte(`{"deploymentID":`),
+		0o644,
+	))
+	require.NoError(t, os.WriteFile(
+		path.Join(fbs.historyDir(), "orphan.json"),
+		[]byte(`nope`),
+		0o644,
+	))
+
+	reports, err := fbs.Verify()
+	require.NoError(t, err)
+	require.Len(t, reports, 5)
+
+	assert.Equal(t, "good", reports[0].Service)
+	assert.Equal(t, fbs.servicePath("good"), reports[0].Path)
+	assert.Equal(t, currentVersion, reports[0].Version)
+	assert.NoError(t, reports[0].Err)
+
+	assert.Equal(t, fbs.historyPath("good"), reports[1].Path)
+	assert.NoError(t, reports[1].Err)
+
+	assert.Equal(t, "old", reports[2].Service)
+	assert.Equal(t, 0, reports[2].Version)
+	assert.NoError(t, reports[2].Err)
+
+	assert.Equal(t, "orphan", reports[3].Service)
+	assert.Equal(t, fbs.historyPath("orphan"), reports[3].Path)
+	assert.Error(t, reports[3].Err)
+
+	assert.Equal(t, "truncated", reports[4].Service)
+	assert.Error(t, reports[4].Err)
+}
+
+func TestFileBasedStore_Deployments(t *testing.T) {
+	fbs := &FileBasedStore{
+		RootPath: t.TempDir(),
+		Log:      zaptest.NewLogger(t),
+	}
+
+	got, err := fbs.ListDeployments("fizz")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	for i := 1; i <= maxHistory+5; i++ {
+		require.NoError(t, fbs.SaveDeployment("fizz", &Deployment{
+			ID:     i,
+			Status: StatusFailure,
+		}))
+	}
+	// Replace an existing record
+	require.NoError(t, fbs.SaveDeployment("fizz", &Deployment{
+		ID:     maxHistory + 5,
+		Status: StatusSuccess,
+		Images: map[string]string{"web": "fizz:buzz"},
+	}))
+
+	got, err = fbs.ListDeployments("fizz")
+	require.NoError(t, err)
+	require.Len(t, got, maxHistory)
+	assert.Equal(t, 6, got[0].ID)
+	assert.Equal(t, maxHistory+5, got[len(got)-1].ID)
+
+	deployment, err := fbs.LoadDeployment("fizz", maxHistory+5)
+	require.NoError(t, err)
+	assert.Equal(t, &Deployment{
+		ID:     maxHistory + 5,
+		Status: StatusSuccess,
+		Images: map[string]string{"web": "fizz:buzz"},
+	}, deployment)
+
+	_, err = fbs.LoadDeployment("fizz", 1)
+	assert.ErrorIs(t, err, ErrDeploymentNotFound)
+}
+
+func TestFileBasedStore_Purge(t *testing.T) {
+	fbs := &FileBasedStore{
+		RootPath: t.TempDir(),
+		Log:      zaptest.NewLogger(t),
+	}
+
+	require.NoError(t, fbs.SaveServiceState("fizz", &ServiceState{}))
+	require.NoError(t, fbs.SaveDeployment("fizz", &Deployment{ID: 1}))
+
+	require.NoError(t, fbs.Purge())
+
+	entries, err := os.ReadDir(fbs.RootPath)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	_, err = os.Stat(path.Join(fbs.RootPath, "history"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
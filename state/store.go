@@ -0,0 +1,47 @@
+package state
+
+// Store persists the state, deployment history and locks of services.
+type Store interface {
+	LoadServiceState(service string) (*ServiceState, error)
+	SaveServiceState(service string, state *ServiceState) error
+	// ListServices returns the names of all services that have stored state.
+	ListServices() ([]string, error)
+
+	// ListDeployments returns the retained deployment history for a service,
+	// ordered from oldest to newest.
+	ListDeployments(service string) ([]Deployment, error)
+	// LoadDeployment returns a specific deployment from the history of a
+	// service, or ErrDeploymentNotFound.
+	LoadDeployment(service string, id int) (*Deployment, error)
+	// SaveDeployment adds a deployment to the history of a service, replacing
+	// any existing record with the same ID.
+	SaveDeployment(service string, deployment *Deployment) error
+
+	// Lock attempts to acquire an exclusive lock on a service without
+	// blocking. If another process holds the lock, a *LockHeldError is
+	// returned.
+	Lock(service string, info LockInfo) (Lock, error)
+	// ForceUnlock removes the lock of a service regardless of who holds it.
+	ForceUnlock(service string) error
+
+	// AllocatePort reserves the lowest port between min and max (inclusive)
+	// that is not already allocated and that available reports as free,
+	// recording it against the service and container in alloc.
+	AllocatePort(min, max int, alloc PortAllocation, available func(port int) bool) (int, error)
+	// ReleasePorts releases all ports allocated to the given containers of a
+	// service.
+	ReleasePorts(service string, containers []string) error
+	// ListPortAllocations returns all allocated ports, ordered by port.
+	ListPortAllocations() ([]PortAllocation, error)
+
+	// Verify reads the state of every service, reporting any that is corrupt
+	// or unreadable.
+	Verify() ([]FileReport, error)
+	// Purge removes the state, history and port allocations of all services.
+	Purge() error
+}
+
+var (
+	_ Store = &FileBasedStore{}
+	_ Store = &BoltStore{}
+)
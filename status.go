@@ -18,6 +18,43 @@ type ContainerStatus struct {
 	ContainerName string
 	ContainerID   string
 	Status        string
+	// Health is the health reported by the Docker healthcheck of the
+	// container (healthy, unhealthy or starting), or empty if it has none.
+	Health string
+	// RestartCount is the number of times Docker has restarted the container.
+	RestartCount int
+	// CrashLooping indicates the container keeps exiting shortly after it is
+	// restarted.
+	CrashLooping bool
+}
+
+// crashLoopRestarts is the number of restarts after which a container that
+// keeps exiting is considered to be crash looping.
+const crashLoopRestarts = 3
+
+// crashLoopWindow is how long a restarted container must stay up before it is
+// no longer considered to be crash looping.
+const crashLoopWindow = time.Minute
+
+// containerCrashLooping reports whether a container has been restarted
+// repeatedly and has not stayed up since its last restart.
+func containerCrashLooping(inspect types.ContainerJSON, now time.Time) bool {
+	if inspect.ContainerJSONBase == nil || inspect.State == nil {
+		return false
+	}
+	if inspect.RestartCount < crashLoopRestarts {
+		return false
+	}
+	if !inspect.State.Running || inspect.State.Restarting {
+		return true
+	}
+
+	startedAt, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+	if err != nil {
+		return false
+	}
+
+	return now.Sub(startedAt) < crashLoopWindow
 }
 
 type ProcessStatus struct {
@@ -76,11 +113,22 @@ func (e *Engine) Status(
 		for _, container := range containers {
 			containerProcess := container.Labels[processLabel]
 			if containerProcess == processName {
-				ps.Containers = append(ps.Containers, ContainerStatus{
+				inspect, err := e.docker.ContainerInspect(ctx, container.ID)
+				if err != nil {
+					return nil, err
+				}
+
+				cs := ContainerStatus{
 					ContainerName: container.Names[0],
 					ContainerID:   container.ID,
 					Status:        container.State,
-				})
+					Health:        containerHealth(inspect),
+					CrashLooping:  containerCrashLooping(inspect, time.Now()),
+				}
+				if inspect.ContainerJSONBase != nil {
+					cs.RestartCount = inspect.RestartCount
+				}
+				ps.Containers = append(ps.Containers, cs)
 			}
 		}
 
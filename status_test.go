@@ -2,7 +2,9 @@ package guvnor
 
 import (
 	"testing"
+	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,3 +20,68 @@ func TestProcessStatuses_OrderedKeys(t *testing.T) {
 	want := []string{"a", "b", "h", "z"}
 	assert.Equal(t, want, got)
 }
+
+func Test_containerCrashLooping(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	inspect := func(restarts int, state types.ContainerState) types.ContainerJSON {
+		return types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				RestartCount: restarts,
+				State:        &state,
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		inspect types.ContainerJSON
+		want    bool
+	}{
+		{
+			name:    "no state",
+			inspect: types.ContainerJSON{},
+		},
+		{
+			name: "few restarts",
+			inspect: inspect(2, types.ContainerState{
+				Restarting: true,
+			}),
+		},
+		{
+			name: "restarting",
+			inspect: inspect(5, types.ContainerState{
+				Restarting: true,
+			}),
+			want: true,
+		},
+		{
+			name: "exited",
+			inspect: inspect(5, types.ContainerState{
+				Status:   "exited",
+				ExitCode: 1,
+			}),
+			want: true,
+		},
+		{
+			name: "recently restarted",
+			inspect: inspect(5, types.ContainerState{
+				Running:   true,
+				StartedAt: now.Add(-10 * time.Second).Format(time.RFC3339Nano),
+			}),
+			want: true,
+		},
+		{
+			name: "stable since restart",
+			inspect: inspect(5, types.ContainerState{
+				Running:   true,
+				StartedAt: now.Add(-time.Hour).Format(time.RFC3339Nano),
+			}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, containerCrashLooping(tt.inspect, now))
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package guvnor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	templateDeployment = "deployment"
+	templateReplica    = "replica"
+)
+
+// templatePrefixes are the namespaces of template expressions. Any other
+// ${...}, such as a shell variable in a command, is left as written.
+var templatePrefixes = []string{"env.", "vars.", "guvnor."}
+
+func isTemplate(expr string) bool {
+	for _, prefix := range templatePrefixes {
+		if strings.HasPrefix(expr, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// interpolate replaces each ${expr} within s with the value returned by
+// resolve, and $${ with a literal ${. If resolve defers an expression, it is
+// left in place to be interpolated later, and escapes are preserved so that
+// they are only unescaped once. final is whether this is the last pass over
+// the value.
+func interpolate(
+	s string,
+	final bool,
+	resolve func(expr string) (value string, deferred bool, err error),
+) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	out := strings.Builder{}
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			out.WriteString(s)
+			break
+		}
+
+		if i > 0 && s[i-1] == '$' {
+			out.WriteString(s[:i-1])
+			if final {
+				out.WriteString("${")
+			} else {
+				out.WriteString("$${")
+			}
+			s = s[i+2:]
+			continue
+		}
+
+		out.WriteString(s[:i])
+		end := strings.Index(s[i:], "}")
+		if end < 0 {
+			if isTemplate(strings.TrimSpace(s[i+2:])) {
+				return "", errors.New("unterminated ${, use $${ for a literal ${")
+			}
+			out.WriteString(s[i:])
+			break
+		}
+		expr := strings.TrimSpace(s[i+2 : i+end])
+		if !isTemplate(expr) {
+			out.WriteString(s[i : i+end+1])
+			s = s[i+end+1:]
+			continue
+		}
+		s = s[i+end+1:]
+
+		value, deferred, err := resolve(expr)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case deferred:
+			out.WriteString("${" + expr + "}")
+		case final:
+			out.WriteString(value)
+		default:
+			// Ensure the value is not interpolated again by a later pass
+			out.WriteString(strings.ReplaceAll(value, "${", "$${"))
+		}
+	}
+
+	return out.String(), nil
+}
+
+// templateValues are the values available to templates when a service config
+// is loaded.
+type templateValues struct {
+	lookupEnv func(string) (string, bool)
+	vars      map[string]string
+	service   string
+}
+
+func (e *Engine) templateValues(serviceName string) templateValues {
+	return templateValues{
+		lookupEnv: os.LookupEnv,
+		vars:      e.config.Vars,
+		service:   serviceName,
+	}
+}
+
+// expand interpolates the values known when the config is loaded. late lists
+// the guvnor values that may be used in the field, which are only known when
+// a container is created, so are left in place.
+func (tv templateValues) expand(s string, late ...string) (string, error) {
+	return interpolate(s, len(late) == 0, func(expr string) (string, bool, error) {
+		switch {
+		case strings.HasPrefix(expr, "env."):
+			value, ok := tv.lookupEnv(strings.TrimPrefix(expr, "env."))
+			if !ok {
+				return "", false, fmt.Errorf("undefined variable ${%s}", expr)
+			}
+			return value, false, nil
+		case strings.HasPrefix(expr, "vars."):
+			value, ok := tv.vars[strings.TrimPrefix(expr, "vars.")]
+			if !ok {
+				return "", false, fmt.Errorf("undefined variable ${%s}", expr)
+			}
+			return value, false, nil
+		case expr == "guvnor.service":
+			return tv.service, false, nil
+		case expr == "guvnor."+templateDeployment, expr == "guvnor."+templateReplica:
+			name := strings.TrimPrefix(expr, "guvnor.")
+			for _, allowed := range late {
+				if name == allowed {
+					return "", true, nil
+				}
+			}
+			if name == templateReplica {
+				return "", false, fmt.Errorf(
+					"${%s} is only available in the env and command of processes", expr,
+				)
+			}
+			return "", false, fmt.Errorf(
+				"${%s} is only available in env and command", expr,
+			)
+		default:
+			return "", false, fmt.Errorf("unknown variable ${%s}", expr)
+		}
+	})
+}
+
+// expandString interpolates a value, reporting any error against the path of
+// its field, e.g env FOO.
+func (tv templateValues) expandString(path []string, s *string, late ...string) error {
+	expanded, err := tv.expand(*s, late...)
+	if err != nil {
+		return withPath(
+			fmt.Errorf("%s: %w", formatFieldPath(path), err), path...,
+		)
+	}
+
+	*s = expanded
+	return nil
+}
+
+func (tv templateValues) expandList(path []string, list []string, late ...string) error {
+	for i := range list {
+		if err := tv.expandString(path, &list[i], late...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expandMap interpolates the values of a map, in a stable order so the same
+// error is always reported.
+func (tv templateValues) expandMap(path []string, m map[string]string, late ...string) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		value := m[k]
+		keyPath := append(append([]string{}, path...), k)
+		if err := tv.expandString(keyPath, &value, late...); err != nil {
+			return err
+		}
+		m[k] = value
+	}
+
+	return nil
+}
+
+func (tv templateValues) expandMounts(mounts []ServiceMountConfig) error {
+	for i := range mounts {
+		mnt := &mounts[i]
+		fields := []struct {
+			name  string
+			value *string
+		}{
+			{name: "host", value: &mnt.Host},
+			{name: "container", value: &mnt.Container},
+			{name: "volume", value: &mnt.Volume},
+		}
+		for _, field := range fields {
+			err := tv.expandString(
+				[]string{"mounts", fmt.Sprintf("[%d]", i), field.name},
+				field.value,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (tv templateValues) expandImage(image, imageTag *string) error {
+	if err := tv.expandString([]string{"image"}, image); err != nil {
+		return err
+	}
+
+	return tv.expandString([]string{"imageTag"}, imageTag)
+}
+
+// applyTemplates interpolates the values of the service config that support
+// templates. Values that are only known when a container is created are left
+// in place, to be interpolated by expandLate.
+func (sc *ServiceConfig) applyTemplates(tv templateValues) error {
+	defaults := &sc.Defaults
+	err := tv.expandImage(&defaults.Image, &defaults.ImageTag)
+	if err == nil {
+		err = tv.expandMap([]string{"env"}, defaults.Env, templateDeployment)
+	}
+	if err == nil {
+		err = tv.expandList([]string{"envFiles"}, defaults.EnvFiles)
+	}
+	if err == nil {
+		err = tv.expandMounts(defaults.Mounts)
+	}
+	if err != nil {
+		return withPath(fmt.Errorf("default %w", err), "defaults")
+	}
+
+	for _, processName := range sc.orderedProcessNames() {
+		process := sc.Processes[processName]
+		err := tv.expandImage(&process.Image, &process.ImageTag)
+		if err == nil {
+			err = tv.expandList(
+				[]string{"command"}, process.Command,
+				templateDeployment, templateReplica,
+			)
+		}
+		if err == nil {
+			err = tv.expandMap(
+				[]string{"env"}, process.Env,
+				templateDeployment, templateReplica,
+			)
+		}
+		if err == nil {
+			err = tv.expandList([]string{"envFiles"}, process.EnvFiles)
+		}
+		if err == nil {
+			err = tv.expandMounts(process.Mounts)
+		}
+		if err == nil {
+			err = tv.expandList(
+				[]string{"caddy", "hostnames"}, process.Caddy.Hostnames,
+			)
+		}
+		if err == nil {
+			err = tv.expandString([]string{"caddy", "path"}, &process.Caddy.Path)
+		}
+		if err != nil {
+			return withPath(
+				fmt.Errorf("process (%s) %w", processName, err),
+				"processes", processName,
+			)
+		}
+		sc.Processes[processName] = process
+	}
+
+	for _, taskName := range sc.orderedTaskNames() {
+		task := sc.Tasks[taskName]
+		err := tv.expandImage(&task.Image, &task.ImageTag)
+		if err == nil {
+			err = tv.expandList(
+				[]string{"command"}, task.Command, templateDeployment,
+			)
+		}
+		if err == nil {
+			err = tv.expandMap([]string{"env"}, task.Env, templateDeployment)
+		}
+		if err == nil {
+			err = tv.expandList([]string{"envFiles"}, task.EnvFiles)
+		}
+		if err == nil {
+			err = tv.expandMounts(task.Mounts)
+		}
+		if err != nil {
+			return withPath(
+				fmt.Errorf("task (%s) %w", taskName, err), "tasks", taskName,
+			)
+		}
+		sc.Tasks[taskName] = task
+	}
+
+	return nil
+}
+
+// expandLate interpolates the guvnor values that are only known when a
+// container is created, e.g the deployment ID.
+func expandLate(s string, values map[string]string) (string, error) {
+	return interpolate(s, true, func(expr string) (string, bool, error) {
+		value, ok := values[strings.TrimPrefix(expr, "guvnor.")]
+		if !ok || !strings.HasPrefix(expr, "guvnor.") {
+			return "", false, fmt.Errorf("unknown variable ${%s}", expr)
+		}
+
+		return value, false, nil
+	})
+}
+
+// expandLateList interpolates late values into a copy of a list, such as a
+// command.
+func expandLateList(list []string, values map[string]string) ([]string, error) {
+	if list == nil {
+		return nil, nil
+	}
+
+	out := make([]string, 0, len(list))
+	for _, s := range list {
+		expanded, err := expandLate(s, values)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, expanded)
+	}
+
+	return out, nil
+}
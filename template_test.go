@@ -0,0 +1,276 @@
+package guvnor
+
+import (
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_templateValues_expand(t *testing.T) {
+	tv := templateValues{
+		lookupEnv: func(name string) (string, bool) {
+			value, ok := map[string]string{
+				"REGISTRY": "ghcr.io",
+				"TEMPLATE": "${env.REGISTRY}",
+			}[name]
+			return value, ok
+		},
+		vars:    map[string]string{"domain": "example.com"},
+		service: "fizz",
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		late    []string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "no templates",
+			value: "plain $HOME",
+			want:  "plain $HOME",
+		},
+		{
+			name:  "env, vars and service",
+			value: "${env.REGISTRY}/${guvnor.service}.${ vars.domain }",
+			want:  "ghcr.io/fizz.example.com",
+		},
+		{
+			name:  "shell variables are left as written",
+			value: "exec app -p ${PORT} ${HOME:-/root} ${env.REGISTRY} ${",
+			want:  "exec app -p ${PORT} ${HOME:-/root} ghcr.io ${",
+		},
+		{
+			name:  "shell variables are left as written when deferred",
+			value: "${PORT}-${guvnor.replica}",
+			late:  []string{templateReplica},
+			want:  "${PORT}-${guvnor.replica}",
+		},
+		{
+			name:  "escaped",
+			value: "$${env.REGISTRY} ${env.REGISTRY}",
+			want:  "${env.REGISTRY} ghcr.io",
+		},
+		{
+			name:  "values are not interpolated again",
+			value: "${env.TEMPLATE}",
+			want:  "${env.REGISTRY}",
+		},
+		{
+			name:  "late values are deferred",
+			value: "${guvnor.service}-${guvnor.deployment}-${guvnor.replica} $${x} ${env.TEMPLATE}",
+			late:  []string{templateDeployment, templateReplica},
+			want:  "fizz-${guvnor.deployment}-${guvnor.replica} $${x} $${env.REGISTRY}",
+		},
+		{
+			name:    "undefined env",
+			value:   "${env.MISSING}",
+			wantErr: "undefined variable ${env.MISSING}",
+		},
+		{
+			name:    "undefined var",
+			value:   "${vars.missing}",
+			wantErr: "undefined variable ${vars.missing}",
+		},
+		{
+			name:    "unknown variable",
+			value:   "${guvnor.process}",
+			wantErr: "unknown variable ${guvnor.process}",
+		},
+		{
+			name:    "unterminated",
+			value:   "${env.REGISTRY",
+			wantErr: "unterminated ${, use $${ for a literal ${",
+		},
+		{
+			name:    "late value not available",
+			value:   "${guvnor.deployment}",
+			wantErr: "${guvnor.deployment} is only available in env and command",
+		},
+		{
+			name:    "replica not available",
+			value:   "${guvnor.replica}",
+			late:    []string{templateDeployment},
+			wantErr: "${guvnor.replica} is only available in the env and command of processes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tv.expand(tt.value, tt.late...)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_expandLate(t *testing.T) {
+	late := map[string]string{templateDeployment: "7", templateReplica: "2"}
+
+	got, err := expandLate("web-${guvnor.deployment}-${guvnor.replica} $${x}", late)
+	require.NoError(t, err)
+	assert.Equal(t, "web-7-2 ${x}", got)
+
+	_, err = expandLate("${guvnor.replica}", map[string]string{templateDeployment: "7"})
+	assert.EqualError(t, err, "unknown variable ${guvnor.replica}")
+
+	gotList, err := expandLateList([]string{"run", "--id=${guvnor.replica}"}, late)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"run", "--id=2"}, gotList)
+}
+
+func Test_Engine_parseServiceConfig_templates(t *testing.T) {
+	t.Setenv("GUVNOR_TEST_TAG", "v1.2.3")
+	e := &Engine{
+		validate: validator.New(),
+		config: EngineConfig{
+			Vars: map[string]string{"domain": "example.com"},
+		},
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		got, err := e.parseServiceConfig("fizz", []byte(`
+defaults:
+  image: ghcr.io/krystal/${guvnor.service}
+  imageTag: ${env.GUVNOR_TEST_TAG}
+  env:
+    RELEASE: ${guvnor.deployment}
+processes:
+  web:
+    command: ["serve", "--replica=${guvnor.replica}"]
+    env:
+      HOSTNAME: ${guvnor.service}.${vars.domain}
+    mounts:
+      - host: /srv/${guvnor.service}/uploads
+        container: /uploads
+    caddy:
+      hostnames: ["${guvnor.service}.${vars.domain}"]
+  worker:
+    command: ["sh", "-c", "exec worker -p ${PORT}"]
+tasks:
+  migrate:
+    command: ["migrate", "--deployment=${guvnor.deployment}"]
+`))
+		require.NoError(t, err)
+
+		assert.Equal(t, "ghcr.io/krystal/fizz", got.Defaults.Image)
+		assert.Equal(t, "v1.2.3", got.Defaults.ImageTag)
+		assert.Equal(t, "${guvnor.deployment}", got.Defaults.Env["RELEASE"])
+		web := got.Processes["web"]
+		assert.Equal(t, []string{"serve", "--replica=${guvnor.replica}"}, web.Command)
+		assert.Equal(t, "fizz.example.com", web.Env["HOSTNAME"])
+		assert.Equal(t, "/srv/fizz/uploads", web.Mounts[0].Host)
+		assert.Equal(t, []string{"fizz.example.com"}, web.Caddy.Hostnames)
+		worker, err := expandLateList(got.Processes["worker"].Command, map[string]string{
+			templateDeployment: "7", templateReplica: "0",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sh", "-c", "exec worker -p ${PORT}"}, worker)
+		assert.Equal(t,
+			[]string{"migrate", "--deployment=${guvnor.deployment}"},
+			got.Tasks["migrate"].Command,
+		)
+	})
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "undefined env",
+			config: `
+defaults:
+  image: foo
+  imageTag: ${env.GUVNOR_TEST_MISSING}
+`,
+			wantErr: "default imageTag: undefined variable ${env.GUVNOR_TEST_MISSING}",
+		},
+		{
+			name: "undefined var",
+			config: `
+defaults:
+  image: foo
+processes:
+  web:
+    caddy:
+      hostnames: ["web.${vars.missing}"]
+`,
+			wantErr: "process (web) caddy.hostnames: undefined variable ${vars.missing}",
+		},
+		{
+			name: "replica in task",
+			config: `
+defaults:
+  image: foo
+tasks:
+  migrate:
+    env:
+      REPLICA: ${guvnor.replica}
+`,
+			wantErr: "task (migrate) env.REPLICA: ${guvnor.replica} is only " +
+				"available in the env and command of processes",
+		},
+		{
+			name: "deployment in mount",
+			config: `
+defaults:
+  image: foo
+processes:
+  web:
+    mounts:
+      - host: /srv/${guvnor.deployment}
+        container: /srv
+`,
+			wantErr: "process (web) mounts[0].host: ${guvnor.deployment} is " +
+				"only available in env and command",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := e.parseServiceConfig("fizz", []byte(tt.config))
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_ServiceConfig_snapshot(t *testing.T) {
+	t.Setenv("GUVNOR_TEST_PASSWORD", "hunter2")
+	e := &Engine{validate: validator.New()}
+
+	svc, err := e.parseServiceConfig("fizz", []byte(`
+defaults:
+  image: foo
+  imageTag: v1
+  env:
+    PASSWORD: ${env.GUVNOR_TEST_PASSWORD}
+processes:
+  web:
+    caddy:
+      hostnames: [example.com]
+      path: /$${x}/*
+`))
+	require.NoError(t, err)
+	require.NoError(t, svc.overrideImageTag("v2"))
+
+	snapshot, err := svc.snapshot()
+	require.NoError(t, err)
+	assert.NotContains(t, string(snapshot), "hunter2")
+	assert.Contains(t, string(snapshot), "${env.GUVNOR_TEST_PASSWORD}")
+
+	// Loading the snapshot applies the templates again, as a rollback would.
+	got, err := e.parseServiceConfig("fizz", snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", got.Defaults.ImageTag)
+	assert.Equal(t, "hunter2", got.Defaults.Env["PASSWORD"])
+	assert.Equal(t, "/${x}/*", got.Processes["web"].Caddy.Path)
+}
@@ -0,0 +1,496 @@
+package guvnor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationProblem is a problem with the config of a service. File, Line
+// and Column are set when the position of the problem is known.
+type ValidationProblem struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (vp ValidationProblem) String() string {
+	switch {
+	case vp.File == "":
+		return vp.Message
+	case vp.Line == 0:
+		return fmt.Sprintf("%s: %s", vp.File, vp.Message)
+	case vp.Column == 0:
+		return fmt.Sprintf("%s:%d: %s", vp.File, vp.Line, vp.Message)
+	default:
+		return fmt.Sprintf(
+			"%s:%d:%d: %s", vp.File, vp.Line, vp.Column, vp.Message,
+		)
+	}
+}
+
+type ServiceValidation struct {
+	ServiceName string
+	// File is the path to the config of the service.
+	File     string
+	Problems []ValidationProblem
+}
+
+type ValidateServiceArgs struct {
+	ServiceName string
+	// File is the path to a service config to validate instead of one in the
+	// config directory, e.g before it is installed. The service is named
+	// after the file, and any fragments it includes are read from the config
+	// directory.
+	File string
+	// All validates every service in the config directory.
+	All bool
+}
+
+type ValidateServiceResult struct {
+	Services []ServiceValidation
+}
+
+// ValidateService checks the config of services without deploying them,
+// reporting every problem found along with its position. As well as the
+// checks made when a service is loaded, hostnames that are routed to by more
+// than one process are reported.
+func (e *Engine) ValidateService(
+	ctx context.Context, args ValidateServiceArgs,
+) (*ValidateServiceResult, error) {
+	serviceNames, err := e.listServiceNames()
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]string{}
+	for _, serviceName := range serviceNames {
+		files[serviceName] = path.Join(
+			e.config.Paths.Config, serviceName+".yaml",
+		)
+	}
+
+	targets := []string{}
+	switch {
+	case args.File != "":
+		serviceName := strings.TrimSuffix(path.Base(args.File), ".yaml")
+		if _, ok := files[serviceName]; !ok {
+			serviceNames = append(serviceNames, serviceName)
+		}
+		files[serviceName] = args.File
+		targets = append(targets, serviceName)
+	case args.All:
+		targets = serviceNames
+	default:
+		targets = append(targets, args.ServiceName)
+		if _, ok := files[args.ServiceName]; !ok {
+			return nil, fmt.Errorf(
+				"service %s not found in %s",
+				args.ServiceName, e.config.Paths.Config,
+			)
+		}
+	}
+
+	// Every service is loaded so hostnames can be compared between them,
+	// but only problems with the targeted services are reported.
+	configs := map[string]*ServiceConfig{}
+	merged := map[string]*mergedServiceConfig{}
+	problems := map[string][]ValidationProblem{}
+	for _, serviceName := range serviceNames {
+		cfg, msc, serviceProblems := e.checkServiceConfig(
+			serviceName, files[serviceName],
+		)
+		if cfg != nil {
+			configs[serviceName] = cfg
+			merged[serviceName] = msc
+		}
+		problems[serviceName] = serviceProblems
+	}
+
+	res := &ValidateServiceResult{}
+	for _, serviceName := range targets {
+		if cfg, ok := configs[serviceName]; ok {
+			problems[serviceName] = append(
+				problems[serviceName],
+				hostnameConflicts(
+					cfg, merged[serviceName], files[serviceName], configs,
+				)...,
+			)
+		}
+
+		res.Services = append(res.Services, ServiceValidation{
+			ServiceName: serviceName,
+			File:        files[serviceName],
+			Problems:    problems[serviceName],
+		})
+	}
+
+	return res, nil
+}
+
+// checkServiceConfig loads the config of a service from filePath, returning
+// every problem found with it. The config is only returned if it is valid.
+func (e *Engine) checkServiceConfig(
+	serviceName string, filePath string,
+) (*ServiceConfig, *mergedServiceConfig, []ValidationProblem) {
+	msc, err := e.mergeServiceConfig(serviceName, filePath)
+	if err != nil {
+		return nil, nil, configFileProblems(filePath, err)
+	}
+
+	data, err := msc.encode()
+	if err != nil {
+		return nil, nil, []ValidationProblem{{File: filePath, Message: err.Error()}}
+	}
+
+	// The config is checked as it would be when deployed, but every problem
+	// is reported rather than just the first.
+	cfg, errs := e.decodeServiceConfig(serviceName, data)
+	problems := []ValidationProblem{}
+	for _, err := range errs {
+		validationErrs := validator.ValidationErrors{}
+		if errors.As(err, &validationErrs) {
+			for _, fieldErr := range validationErrs {
+				problems = append(problems, msc.fieldProblem(filePath, fieldErr))
+			}
+			continue
+		}
+
+		problems = append(problems, msc.problem(filePath, err))
+	}
+	if len(problems) > 0 {
+		return nil, nil, problems
+	}
+
+	return cfg, msc, nil
+}
+
+var yamlErrorRegex = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+var unknownFieldRegex = regexp.MustCompile(`^field (\S+) not found`)
+
+// configFileProblems converts an error merging a service config into
+// problems, finding the position of errors from decoding YAML.
+func configFileProblems(filePath string, err error) []ValidationProblem {
+	fileErr := &configFileError{}
+	if !errors.As(err, &fileErr) {
+		return []ValidationProblem{{File: filePath, Message: err.Error()}}
+	}
+
+	messages := []string{fileErr.err.Error()}
+	typeErr := &yaml.TypeError{}
+	if errors.As(fileErr.err, &typeErr) {
+		messages = typeErr.Errors
+	}
+
+	problems := []ValidationProblem{}
+	for _, message := range messages {
+		problem := ValidationProblem{File: fileErr.file, Message: message}
+		if match := yamlErrorRegex.FindStringSubmatch(message); match != nil {
+			problem.Line, _ = strconv.Atoi(match[1])
+			problem.Message = match[2]
+
+			key := ""
+			if field := unknownFieldRegex.FindStringSubmatch(match[2]); field != nil {
+				key = field[1]
+			}
+			problem.Column = columnOnLine(fileErr.doc, problem.Line, key)
+		}
+		problems = append(problems, problem)
+	}
+
+	return problems
+}
+
+// columnOnLine returns the column of the value key on a line of a document,
+// or of the first value on the line if key is empty or not found.
+func columnOnLine(doc *yaml.Node, line int, key string) int {
+	keyColumn, firstColumn := 0, 0
+
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		if node.Kind == yaml.ScalarNode && node.Line == line {
+			if key != "" && node.Value == key && keyColumn == 0 {
+				keyColumn = node.Column
+			}
+			if firstColumn == 0 || node.Column < firstColumn {
+				firstColumn = node.Column
+			}
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+	}
+	if doc != nil {
+		walk(doc)
+	}
+
+	if keyColumn != 0 {
+		return keyColumn
+	}
+	return firstColumn
+}
+
+// splitFieldPath splits a path to a field, such as
+// Processes[web].Mounts[0].Host, into its segments. Map keys and slice
+// indexes are kept in brackets, e.g [web] and [0].
+func splitFieldPath(fieldPath string) []string {
+	segments := []string{}
+	current := strings.Builder{}
+	flush := func() {
+		if current.Len() > 0 {
+			segments = append(segments, current.String())
+			current.Reset()
+		}
+	}
+
+	for i := 0; i < len(fieldPath); i++ {
+		switch c := fieldPath[i]; c {
+		case '.':
+			flush()
+		case '[':
+			flush()
+			end := strings.IndexByte(fieldPath[i:], ']')
+			if end < 0 {
+				end = len(fieldPath) - i - 1
+			}
+			segments = append(segments, fieldPath[i:i+end+1])
+			i += end
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+
+	return segments
+}
+
+// yamlFieldPath converts the namespace of a validation error, such as
+// ServiceConfig.Processes[web].Caddy.Hostnames[0], into the path of the field
+// within the YAML config, e.g processes [web] caddy hostnames [0].
+func yamlFieldPath(t reflect.Type, namespace string) []string {
+	segments := splitFieldPath(namespace)
+	if len(segments) > 0 {
+		// The first segment is the name of the struct being validated.
+		segments = segments[1:]
+	}
+
+	yamlPath := []string{}
+	for _, segment := range segments {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		if strings.HasPrefix(segment, "[") {
+			yamlPath = append(yamlPath, segment)
+			if t.Kind() == reflect.Map || t.Kind() == reflect.Slice {
+				t = t.Elem()
+			}
+			continue
+		}
+
+		if t.Kind() != reflect.Struct {
+			break
+		}
+		field, ok := t.FieldByName(segment)
+		if !ok {
+			break
+		}
+		t = field.Type
+
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		name := tag[0]
+		if name == "" && len(tag) > 1 && tag[1] == "inline" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		yamlPath = append(yamlPath, name)
+	}
+
+	return yamlPath
+}
+
+// formatFieldPath formats the path to a field for display, e.g
+// processes.web.mounts[0].host.
+func formatFieldPath(fieldPath []string) string {
+	out := strings.Builder{}
+	for i, segment := range fieldPath {
+		if i > 0 {
+			if strings.HasPrefix(segment, "[") {
+				if _, err := strconv.Atoi(strings.Trim(segment, "[]")); err != nil {
+					segment = "." + strings.Trim(segment, "[]")
+				}
+			} else {
+				out.WriteString(".")
+			}
+		}
+		out.WriteString(segment)
+	}
+
+	return out.String()
+}
+
+// find returns the node to report a problem at for a path through the merged
+// config. When the full path is not present, e.g for a missing field, the
+// closest parent is returned.
+func (msc *mergedServiceConfig) find(fieldPath []string) *yaml.Node {
+	node, at := msc.root, msc.root
+	for _, segment := range fieldPath {
+		key := strings.TrimSuffix(strings.TrimPrefix(segment, "["), "]")
+
+		var next, nextAt *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			if i := mappingIndex(node, key); i >= 0 {
+				next, nextAt = node.Content[i+1], node.Content[i+1]
+				// Mappings and sequences are reported at their key, rather
+				// than at their first entry.
+				if next.Kind == yaml.MappingNode || next.Kind == yaml.SequenceNode {
+					nextAt = node.Content[i]
+				}
+			}
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(key)
+			if err == nil && i >= 0 && i < len(node.Content) {
+				next, nextAt = node.Content[i], node.Content[i]
+			}
+		}
+		if next == nil {
+			break
+		}
+		node, at = next, nextAt
+	}
+
+	return at
+}
+
+// position returns a problem positioned at a path within the merged config.
+func (msc *mergedServiceConfig) position(
+	filePath string, fieldPath []string, message string,
+) ValidationProblem {
+	problem := ValidationProblem{File: filePath, Message: message}
+	if len(fieldPath) == 0 {
+		return problem
+	}
+	node := msc.find(fieldPath)
+	if file := msc.files[node]; file != "" {
+		problem.File = file
+		problem.Line = node.Line
+		problem.Column = node.Column
+	}
+
+	return problem
+}
+
+// fieldProblem converts an error from validating the tags of a field into a
+// problem positioned at the field.
+func (msc *mergedServiceConfig) fieldProblem(
+	filePath string, fieldErr validator.FieldError,
+) ValidationProblem {
+	fieldPath := yamlFieldPath(
+		reflect.TypeOf(ServiceConfig{}), fieldErr.Namespace(),
+	)
+
+	tag := fieldErr.Tag()
+	if fieldErr.Param() != "" {
+		tag = fmt.Sprintf("%s=%s", tag, fieldErr.Param())
+	}
+
+	return msc.position(filePath, fieldPath, fmt.Sprintf(
+		"%s: failed on the '%s' validation",
+		formatFieldPath(fieldPath), tag,
+	))
+}
+
+// problem converts an error from loading the config into a problem,
+// positioned at the field the error refers to where it is known.
+func (msc *mergedServiceConfig) problem(filePath string, err error) ValidationProblem {
+	return msc.position(filePath, errorPath(err), err.Error())
+}
+
+// hostnameConflicts finds the hostnames of processes in the service that are
+// also routed to, with the same path, by another process of any service.
+func hostnameConflicts(
+	svc *ServiceConfig,
+	msc *mergedServiceConfig,
+	filePath string,
+	configs map[string]*ServiceConfig,
+) []ValidationProblem {
+	type route struct {
+		hostname string
+		path     string
+	}
+	type owner struct {
+		service string
+		process string
+	}
+
+	owners := map[route][]owner{}
+	for serviceName, cfg := range configs {
+		for processName, process := range cfg.Processes {
+			for _, hostname := range process.Caddy.Hostnames {
+				r := route{strings.ToLower(hostname), process.Caddy.Path}
+				owners[r] = append(owners[r], owner{serviceName, processName})
+			}
+		}
+	}
+
+	problems := []ValidationProblem{}
+	for _, processName := range svc.orderedProcessNames() {
+		process := svc.Processes[processName]
+		for i, hostname := range process.Caddy.Hostnames {
+			r := route{strings.ToLower(hostname), process.Caddy.Path}
+
+			others := []string{}
+			for _, o := range owners[r] {
+				switch {
+				case o.service == svc.Name && o.process == processName:
+					continue
+				case o.service == svc.Name:
+					others = append(others, fmt.Sprintf("process %s", o.process))
+				default:
+					others = append(others, fmt.Sprintf(
+						"process %s of service %s", o.process, o.service,
+					))
+				}
+			}
+			if len(others) == 0 {
+				continue
+			}
+			sort.Strings(others)
+
+			message := fmt.Sprintf(
+				"process (%s) hostname %s is also used by %s",
+				processName, hostname, strings.Join(others, ", "),
+			)
+			if process.Caddy.Path != "" {
+				message = fmt.Sprintf(
+					"process (%s) hostname %s with path %s is also used by %s",
+					processName, hostname, process.Caddy.Path,
+					strings.Join(others, ", "),
+				)
+			}
+			problems = append(problems, msc.position(
+				filePath,
+				[]string{
+					"processes", processName,
+					"caddy", "hostnames", fmt.Sprintf("[%d]", i),
+				},
+				message,
+			))
+		}
+	}
+
+	return problems
+}
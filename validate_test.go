@@ -0,0 +1,303 @@
+package guvnor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Engine_ValidateService(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFiles(t, dir, map[string]string{
+		"fizz.yaml": `defaults:
+  image: ghcr.io/krystal/fizz
+  imageTag: latest
+processes:
+  web:
+    caddy:
+      hostnames: [fizz.example.com, www.example.com]
+  admin:
+    caddy:
+      hostnames: [fizz.example.com]
+      path: /admin/*
+`,
+		"buzz.yaml": `include: [shared/base.yaml]
+processes:
+  web:
+    caddy:
+      hostnames: [WWW.example.com]
+`,
+		"shared/base.yaml": `defaults:
+  image: ghcr.io/krystal/buzz
+  imageTag: latest
+`,
+		"decode.yaml": `defaults:
+  image: foo
+  imag: bar
+processes:
+  web:
+    deploymentStrategy: sideways
+`,
+		"tags.yaml": `defaults:
+  image: foo
+  mounts:
+    - type: nfs
+      container: /data
+processes:
+  web:
+    healthCheck:
+      command: []
+`,
+		"custom.yaml": `defaults:
+  imageTag: latest
+processes:
+  web:
+    restartPolicy:
+      maxRetries: 3
+tasks:
+  migrate:
+    image: ghcr.io/krystal/migrate
+callbacks:
+  preDeployment: [migrate, missing]
+`,
+		"template.yaml": `defaults:
+  image: foo
+processes:
+  web:
+    caddy:
+      hostnames: ["${vars.domain}"]
+`,
+	})
+
+	e := &Engine{
+		validate: validator.New(),
+		config:   EngineConfig{Paths: PathsConfig{Config: dir}},
+	}
+	file := func(name string) string {
+		return path.Join(dir, name)
+	}
+
+	tests := []struct {
+		name    string
+		args    ValidateServiceArgs
+		want    []ServiceValidation
+		wantErr string
+	}{
+		{
+			name: "hostname conflict",
+			args: ValidateServiceArgs{ServiceName: "fizz"},
+			want: []ServiceValidation{
+				{
+					ServiceName: "fizz",
+					File:        file("fizz.yaml"),
+					Problems: []ValidationProblem{
+						{
+							File:   file("fizz.yaml"),
+							Line:   7,
+							Column: 37,
+							Message: "process (web) hostname www.example.com " +
+								"is also used by process web of service buzz",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "hostname conflict differing in case",
+			args: ValidateServiceArgs{ServiceName: "buzz"},
+			want: []ServiceValidation{
+				{
+					ServiceName: "buzz",
+					File:        file("buzz.yaml"),
+					Problems: []ValidationProblem{
+						{
+							File:   file("buzz.yaml"),
+							Line:   5,
+							Column: 19,
+							Message: "process (web) hostname WWW.example.com " +
+								"is also used by process web of service fizz",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "decode errors",
+			args: ValidateServiceArgs{ServiceName: "decode"},
+			want: []ServiceValidation{
+				{
+					ServiceName: "decode",
+					File:        file("decode.yaml"),
+					Problems: []ValidationProblem{
+						{
+							File:    file("decode.yaml"),
+							Line:    3,
+							Column:  3,
+							Message: "field imag not found in type guvnor.ServiceDefaultsConfig",
+						},
+						{
+							File:    file("decode.yaml"),
+							Line:    6,
+							Column:  5,
+							Message: "deployment strategy 'sideways' not recognised",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "tag errors",
+			args: ValidateServiceArgs{ServiceName: "tags"},
+			want: []ServiceValidation{
+				{
+					ServiceName: "tags",
+					File:        file("tags.yaml"),
+					Problems: []ValidationProblem{
+						{
+							File:   file("tags.yaml"),
+							Line:   4,
+							Column: 13,
+							Message: "defaults.mounts[0].type: failed on the " +
+								"'oneof=bind volume tmpfs' validation",
+						},
+						{
+							File:   file("tags.yaml"),
+							Line:   9,
+							Column: 7,
+							Message: "processes.web.healthCheck.command: failed " +
+								"on the 'min=1' validation",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "custom errors",
+			args: ValidateServiceArgs{ServiceName: "custom"},
+			want: []ServiceValidation{
+				{
+					ServiceName: "custom",
+					File:        file("custom.yaml"),
+					Problems: []ValidationProblem{
+						{
+							File:    file("custom.yaml"),
+							Line:    4,
+							Column:  3,
+							Message: "process (web) image must be specified when there is no default image",
+						},
+						{
+							File:    file("custom.yaml"),
+							Line:    5,
+							Column:  5,
+							Message: "process (web) restart policy: maxRetries may only be set with the on-failure policy",
+						},
+						{
+							File:    file("custom.yaml"),
+							Line:    11,
+							Column:  28,
+							Message: "task (missing) specified in callback not found",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "template error",
+			args: ValidateServiceArgs{ServiceName: "template"},
+			want: []ServiceValidation{
+				{
+					ServiceName: "template",
+					File:        file("template.yaml"),
+					Problems: []ValidationProblem{
+						{
+							File:    file("template.yaml"),
+							Line:    6,
+							Column:  7,
+							Message: "process (web) caddy.hostnames: undefined variable ${vars.domain}",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "file",
+			args: ValidateServiceArgs{File: file("shared/base.yaml")},
+			want: []ServiceValidation{
+				{ServiceName: "base", File: file("shared/base.yaml")},
+			},
+		},
+		{
+			name:    "not found",
+			args:    ValidateServiceArgs{ServiceName: "missing"},
+			wantErr: "service missing not found in " + dir,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := e.ValidateService(context.Background(), tt.args)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.Services)
+		})
+	}
+
+	t.Run("all", func(t *testing.T) {
+		got, err := e.ValidateService(
+			context.Background(), ValidateServiceArgs{All: true},
+		)
+		require.NoError(t, err)
+
+		invalid := map[string]int{}
+		for _, svc := range got.Services {
+			invalid[svc.ServiceName] = len(svc.Problems)
+		}
+		assert.Equal(t, map[string]int{
+			"buzz":     1,
+			"custom":   3,
+			"decode":   2,
+			"fizz":     1,
+			"tags":     2,
+			"template": 1,
+		}, invalid)
+	})
+}
+
+func Test_withPath(t *testing.T) {
+	err := withPath(
+		fmt.Errorf("process (web) mounts: %w", withPath(
+			errors.New("container path is mounted more than once"),
+			"[1]", "container",
+		)),
+		"processes", "web", "mounts",
+	)
+
+	assert.EqualError(
+		t, err, "process (web) mounts: container path is mounted more than once",
+	)
+	assert.Equal(
+		t, []string{"processes", "web", "mounts", "[1]", "container"},
+		errorPath(err),
+	)
+	assert.Nil(t, errorPath(errors.New("no path")))
+}
+
+func Test_yamlFieldPath(t *testing.T) {
+	got := yamlFieldPath(
+		reflect.TypeOf(ServiceConfig{}),
+		"ServiceConfig.Processes[web].SecurityConfig.CapAdd[0]",
+	)
+	assert.Equal(t, []string{"processes", "[web]", "capAdd", "[0]"}, got)
+	assert.Equal(t, "processes.web.capAdd[0]", formatFieldPath(got))
+}
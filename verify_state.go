@@ -0,0 +1,24 @@
+package guvnor
+
+import (
+	"context"
+
+	"github.com/krystal/guvnor/state"
+)
+
+type VerifyStateResult struct {
+	Files []state.FileReport
+}
+
+// VerifyState checks that the stored state and history of every service can
+// be read.
+func (e *Engine) VerifyState(ctx context.Context) (*VerifyStateResult, error) {
+	reports, err := e.state.Verify()
+	if err != nil {
+		return nil, err
+	}
+
+	return &VerifyStateResult{
+		Files: reports,
+	}, nil
+}
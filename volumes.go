@@ -0,0 +1,146 @@
+package guvnor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/docker/docker/api/types/filters"
+	volumetypes "github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"go.uber.org/zap"
+)
+
+// volumeNameRegex restricts the names of volumes so that they cannot contain
+// the separator used in managedVolumeName.
+var volumeNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]*$`)
+
+// managedVolumeName returns the name of the Docker volume used for a volume
+// of a service. Volume names cannot contain underscores, so the name is
+// unique to the service and volume.
+func managedVolumeName(serviceName, volume string) string {
+	return fmt.Sprintf("guvnor-%s_%s", serviceName, volume)
+}
+
+// ensureVolumes creates any volumes used by the service that do not yet
+// exist. Volumes are labelled with the service so they can be found later.
+func (e *Engine) ensureVolumes(ctx context.Context, svc *ServiceConfig) error {
+	volumeOptions := svc.volumeOptions()
+
+	volumes := make([]string, 0, len(volumeOptions))
+	for volume := range volumeOptions {
+		volumes = append(volumes, volume)
+	}
+	sort.Strings(volumes)
+
+	for _, volume := range volumes {
+		name := managedVolumeName(svc.Name, volume)
+		existing, err := e.docker.VolumeInspect(ctx, name)
+		if err == nil {
+			// Volumes are only reused if guvnor created them for this
+			// volume of the service.
+			if existing.Labels[managedLabel] != "1" ||
+				existing.Labels[serviceLabel] != svc.Name ||
+				existing.Labels[volumeLabel] != volume {
+				return fmt.Errorf(
+					"volume %s already exists but was not created by guvnor for volume %s of service %s",
+					name, volume, svc.Name,
+				)
+			}
+			continue
+		} else if !client.IsErrNotFound(err) {
+			return err
+		}
+
+		opts := volumeOptions[volume]
+		e.log.Info("creating volume",
+			zap.String("service", svc.Name),
+			zap.String("volume", name),
+		)
+		_, err = e.docker.VolumeCreate(ctx, volumetypes.VolumeCreateBody{
+			Name:       name,
+			Driver:     opts.Driver,
+			DriverOpts: opts.DriverOptions,
+			Labels: map[string]string{
+				serviceLabel: svc.Name,
+				volumeLabel:  volume,
+				managedLabel: "1",
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("creating volume %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+type ListVolumesArgs struct {
+	// ServiceName limits the volumes to those of a single service. When
+	// empty, the volumes of all services are listed.
+	ServiceName string
+}
+
+type VolumeInfo struct {
+	// Name is the name of the volume in Docker.
+	Name string
+	// Service is the service that owns the volume.
+	Service string
+	// Volume is the name of the volume in the service config.
+	Volume     string
+	Driver     string
+	Mountpoint string
+	CreatedAt  string
+}
+
+type ListVolumesResult struct {
+	Volumes []VolumeInfo
+}
+
+func (e *Engine) listManagedVolumes(
+	ctx context.Context, serviceName string,
+) ([]VolumeInfo, error) {
+	args := filters.NewArgs(filters.Arg("label", managedLabel))
+	if serviceName != "" {
+		args.Add("label", fmt.Sprintf("%s=%s", serviceLabel, serviceName))
+	}
+
+	res, err := e.docker.VolumeList(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := []VolumeInfo{}
+	for _, volume := range res.Volumes {
+		volumes = append(volumes, VolumeInfo{
+			Name:       volume.Name,
+			Service:    volume.Labels[serviceLabel],
+			Volume:     volume.Labels[volumeLabel],
+			Driver:     volume.Driver,
+			Mountpoint: volume.Mountpoint,
+			CreatedAt:  volume.CreatedAt,
+		})
+	}
+	sort.Slice(volumes, func(i, j int) bool {
+		if volumes[i].Service != volumes[j].Service {
+			return volumes[i].Service < volumes[j].Service
+		}
+
+		return volumes[i].Volume < volumes[j].Volume
+	})
+
+	return volumes, nil
+}
+
+// ListVolumes returns the volumes that guvnor has created for services.
+func (e *Engine) ListVolumes(
+	ctx context.Context, args ListVolumesArgs,
+) (*ListVolumesResult, error) {
+	volumes, err := e.listManagedVolumes(ctx, args.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListVolumesResult{Volumes: volumes}, nil
+}
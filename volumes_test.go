@@ -0,0 +1,62 @@
+package guvnor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func Test_managedVolumeName(t *testing.T) {
+	// Names that would be ambiguous if joined with a hyphen remain distinct.
+	assert.Equal(t, "guvnor-app_data-x", managedVolumeName("app", "data-x"))
+	assert.Equal(t, "guvnor-app-data_x", managedVolumeName("app-data", "x"))
+}
+
+func Test_Engine_ensureVolumes(t *testing.T) {
+	svc := &ServiceConfig{
+		Name: "fizz",
+		Defaults: ServiceDefaultsConfig{
+			Mounts: []ServiceMountConfig{
+				{Type: MountTypeVolume, Volume: "data", Container: "/data"},
+			},
+		},
+	}
+
+	t.Run("creates missing volumes", func(t *testing.T) {
+		docker := &fakeDockerClient{}
+		e := &Engine{docker: docker, log: zap.NewNop()}
+
+		require.NoError(t, e.ensureVolumes(context.Background(), svc))
+		assert.Equal(t, map[string]string{
+			serviceLabel: "fizz",
+			volumeLabel:  "data",
+			managedLabel: "1",
+		}, docker.volumes["guvnor-fizz_data"].Labels)
+
+		// Existing volumes are reused.
+		require.NoError(t, e.ensureVolumes(context.Background(), svc))
+	})
+
+	t.Run("existing volume of another owner", func(t *testing.T) {
+		docker := &fakeDockerClient{
+			volumes: map[string]types.Volume{
+				"guvnor-fizz_data": {
+					Name:   "guvnor-fizz_data",
+					Labels: map[string]string{},
+				},
+			},
+		}
+		e := &Engine{docker: docker, log: zap.NewNop()}
+
+		err := e.ensureVolumes(context.Background(), svc)
+		assert.EqualError(
+			t, err,
+			"volume guvnor-fizz_data already exists but was not created by "+
+				"guvnor for volume data of service fizz",
+		)
+	})
+}